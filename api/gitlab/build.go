@@ -10,6 +10,7 @@ import (
 	"os"
 	"path/filepath"
 	"runtime"
+	"time"
 
 	"github.com/fatih/color"
 	"github.com/schollz/progressbar/v3"
@@ -21,11 +22,12 @@ import (
 
 // language=graphql
 const getLastSuccessfulJobQuery = `
-query($repo: ID!, $ref: String!, $job: String!) {
+query($repo: ID!, $ref: String, $sha: String, $job: String!, $count: Int!) {
   project(fullPath: $repo) {
-    pipelines(status: SUCCESS, ref: $ref, first: 1) {
+    pipelines(status: SUCCESS, ref: $ref, sha: $sha, first: $count) {
       nodes {
         sha
+        finishedAt
         job(name: $job) {
           webPath
         }
@@ -36,33 +38,84 @@ query($repo: ID!, $ref: String!, $job: String!) {
 `
 
 type lastSuccessfulJobQueryVariables struct {
-	Repo string `json:"repo"`
-	Ref  string `json:"ref"`
-	Job  string `json:"job"`
+	Repo  string `json:"repo"`
+	Ref   string `json:"ref,omitempty"`
+	SHA   string `json:"sha,omitempty"`
+	Job   string `json:"job"`
+	Count int    `json:"count"`
 }
 
+// How many recent pipelines to look through when searching for one that contains the requested job.
+const pipelineSearchDepth = 20
+
 type LastBuild struct {
-	Commit string
-	JobURL string
+	Commit     string
+	JobURL     string
+	FinishedAt time.Time
 }
 
-func GetLastBuild(domain, repo, mainBranch, job string) (*LastBuild, error) {
+// GetLastBuild finds the newest successful pipeline on the given ref (or commit, if sha is set)
+// which contains the given job. Pipelines that don't have the job at all are skipped, and if none of the
+// recent pipelines have it, an error wrapping ErrNotBuiltInCI is returned.
+func GetLastBuild(domain, repo, ref, sha, job string) (*LastBuild, error) {
 	resp, err := graphqlQuery(domain, getLastSuccessfulJobQuery, lastSuccessfulJobQueryVariables{
-		Repo: repo,
-		Ref:  mainBranch,
-		Job:  job,
+		Repo:  repo,
+		Ref:   ref,
+		SHA:   sha,
+		Job:   job,
+		Count: pipelineSearchDepth,
 	})
 	if err != nil {
 		return nil, err
 	}
-	res := gjson.GetBytes(resp, "project.pipelines.nodes.0")
+	res := gjson.GetBytes(resp, "project.pipelines.nodes")
 	if !res.Exists() {
 		return nil, fmt.Errorf("didn't get pipeline info in response")
 	}
-	return &LastBuild{
-		Commit: gjson.Get(res.Raw, "sha").Str,
-		JobURL: gjson.Get(res.Raw, "job.webPath").Str,
-	}, nil
+	pipelines := res.Array()
+	if len(pipelines) == 0 {
+		return nil, fmt.Errorf("no successful pipelines found")
+	}
+	for _, pipeline := range pipelines {
+		jobURL := pipeline.Get("job.webPath").Str
+		if jobURL == "" {
+			continue
+		}
+		finishedAt, _ := time.Parse(time.RFC3339, pipeline.Get("finishedAt").Str)
+		return &LastBuild{
+			Commit:     pipeline.Get("sha").Str,
+			JobURL:     jobURL,
+			FinishedAt: finishedAt,
+		}, nil
+	}
+	return nil, fmt.Errorf("none of the last %d successful pipelines have a %q job, binaries for this platform are likely %w", len(pipelines), job, ErrNotBuiltInCI)
+}
+
+// GetLastBridgeBuild finds the newest CI build of the given bridge for the given platform on the given channel.
+// If the platform is empty, the host platform is used.
+func GetLastBridgeBuild(bridge, platform string, v2 bool, channel Channel) (*LastBuild, error) {
+	ref, err := getRefFromBridge(bridge)
+	if err != nil {
+		return nil, err
+	}
+	if platform == "" {
+		platform = HostPlatform()
+	}
+	job, err := GetJobFromBridge(bridge, platform)
+	if err != nil {
+		return nil, err
+	}
+	if v2 {
+		job += " v2"
+	}
+	ref, sha := channel.queryRefs(ref)
+	return GetLastBuild(MautrixDomain, GetBridgeRepo(bridge), ref, sha, job)
+}
+
+const MautrixDomain = "mau.dev"
+
+func GetBridgeRepo(bridge string) string {
+	return fmt.Sprintf("mautrix/%s", bridge)
 }
 
 func getRefFromBridge(bridge string) (string, error) {
@@ -79,8 +132,13 @@ func getRefFromBridge(bridge string) (string, error) {
 
 var ErrNotBuiltInCI = errors.New("not built in the CI")
 
-func getJobFromBridge(bridge string) (string, error) {
-	osAndArch := fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH)
+// HostPlatform returns the OS and architecture of the current machine in the same format as GetJobFromBridge accepts.
+func HostPlatform() string {
+	return fmt.Sprintf("%s/%s", runtime.GOOS, runtime.GOARCH)
+}
+
+// GetJobFromBridge returns the name of the CI job that builds the given bridge for the given platform.
+func GetJobFromBridge(bridge, osAndArch string) (string, error) {
 	switch osAndArch {
 	case "linux/amd64":
 		return "build amd64", nil
@@ -113,7 +171,7 @@ func linkifyDiff(repo, fromCommit, toCommit string) string {
 	return hyper.Link(formattedDiff, fmt.Sprintf("https://github.com/%s/compare/%s...%s", repo, fromCommit, toCommit), false)
 }
 
-func makeArtifactURL(domain, jobURL, fileName string) string {
+func MakeArtifactURL(domain, jobURL, fileName string) string {
 	return (&url.URL{
 		Scheme: "https",
 		Host:   domain,
@@ -121,7 +179,7 @@ func makeArtifactURL(domain, jobURL, fileName string) string {
 	}).String()
 }
 
-func downloadFile(ctx context.Context, artifactURL, path string) error {
+func DownloadFile(ctx context.Context, artifactURL, path string) error {
 	fileName := filepath.Base(path)
 	file, err := os.CreateTemp(filepath.Dir(path), "tmp-"+fileName+"-*")
 	if err != nil {
@@ -163,42 +221,31 @@ func downloadFile(ctx context.Context, artifactURL, path string) error {
 	return nil
 }
 
-func needsLibolmDylib(bridge string) bool {
+// NeedsLibolmDylib returns true if the given bridge needs libolm to be installed next to the binary on the given OS.
+func NeedsLibolmDylib(bridge, goos string) bool {
 	switch bridge {
 	case "imessage", "whatsapp", "discord", "slack", "gmessages", "gvoice", "signal",
 		"imessagego", "meta", "twitter", "bluesky", "linkedin", "telegram":
-		return runtime.GOOS == "darwin"
+		return goos == "darwin"
 	default:
 		return false
 	}
 }
 
-func DownloadMautrixBridgeBinary(ctx context.Context, bridge, path string, v2, noUpdate bool, branchOverride, currentCommit string) error {
-	domain := "mau.dev"
-	repo := fmt.Sprintf("mautrix/%s", bridge)
+func DownloadMautrixBridgeBinary(ctx context.Context, bridge, path string, v2, noUpdate bool, channel Channel, currentCommit string) error {
+	domain := MautrixDomain
+	repo := GetBridgeRepo(bridge)
 	fileName := filepath.Base(path)
-	ref, err := getRefFromBridge(bridge)
-	if err != nil {
-		return err
-	}
-	if branchOverride != "" {
-		ref = branchOverride
-	}
-	job, err := getJobFromBridge(bridge)
-	if err != nil {
-		return err
-	}
-	if v2 {
-		job += " v2"
-	}
 
 	if currentCommit == "" {
 		log.Printf("Finding latest version of [cyan]%s[reset] from [cyan]%s[reset]", fileName, domain)
 	} else {
 		log.Printf("Checking for updates to [cyan]%s[reset] from [cyan]%s[reset]", fileName, domain)
 	}
-	build, err := GetLastBuild(domain, repo, ref, job)
-	if err != nil {
+	build, err := GetLastBridgeBuild(bridge, "", v2, channel)
+	if errors.Is(err, ErrNotBuiltInCI) {
+		return err
+	} else if err != nil {
 		return fmt.Errorf("failed to get last build info: %w", err)
 	}
 	if build.Commit == currentCommit {
@@ -207,24 +254,22 @@ func DownloadMautrixBridgeBinary(ctx context.Context, bridge, path string, v2, n
 	} else if currentCommit != "" && noUpdate {
 		log.Printf("[cyan]%s[reset] [yellow]is out of date, latest commit is %s (diff: %s)[reset]", fileName, linkifyCommit(repo, build.Commit), linkifyDiff(repo, currentCommit, build.Commit))
 		return nil
-	} else if build.JobURL == "" {
-		return fmt.Errorf("failed to find URL for job %q on branch %s of %s", job, ref, repo)
 	}
 	if currentCommit == "" {
 		log.Printf("Installing [cyan]%s[reset] (commit: %s)", fileName, linkifyCommit(repo, build.Commit))
 	} else {
 		log.Printf("Updating [cyan]%s[reset] (diff: %s)", fileName, linkifyDiff(repo, currentCommit, build.Commit))
 	}
-	artifactURL := makeArtifactURL(domain, build.JobURL, fileName)
-	err = downloadFile(ctx, artifactURL, path)
+	artifactURL := MakeArtifactURL(domain, build.JobURL, fileName)
+	err = DownloadFile(ctx, artifactURL, path)
 	if err != nil {
 		return err
 	}
-	if needsLibolmDylib(bridge) {
+	if NeedsLibolmDylib(bridge, runtime.GOOS) {
 		libolmPath := filepath.Join(filepath.Dir(path), "libolm.3.dylib")
 		// TODO redownload libolm if it's outdated?
 		if _, err = os.Stat(libolmPath); err != nil {
-			err = downloadFile(ctx, makeArtifactURL(domain, build.JobURL, "libolm.3.dylib"), libolmPath)
+			err = DownloadFile(ctx, MakeArtifactURL(domain, build.JobURL, "libolm.3.dylib"), libolmPath)
 			if err != nil {
 				return fmt.Errorf("failed to download libolm: %w", err)
 			}
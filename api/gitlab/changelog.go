@@ -0,0 +1,88 @@
+package gitlab
+
+import (
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+type Commit struct {
+	ID          string    `json:"id"`
+	Title       string    `json:"title"`
+	Message     string    `json:"message"`
+	AuthorName  string    `json:"author_name"`
+	AuthorEmail string    `json:"author_email"`
+	AuthoredAt  time.Time `json:"authored_date"`
+	WebURL      string    `json:"web_url"`
+}
+
+type Diff struct {
+	OldPath     string `json:"old_path"`
+	NewPath     string `json:"new_path"`
+	NewFile     bool   `json:"new_file"`
+	DeletedFile bool   `json:"deleted_file"`
+}
+
+type Comparison struct {
+	Commits []*Commit `json:"commits"`
+	Diffs   []*Diff   `json:"diffs"`
+}
+
+// CompareCommits returns the commits between two commits, newest first, and the files changed between them.
+func CompareCommits(domain, repo, fromCommit, toCommit string) (*Comparison, error) {
+	var comparison Comparison
+	_, err := projectRequest(domain, repo, []string{"repository", "compare"}, url.Values{
+		"from":     {fromCommit},
+		"to":       {toCommit},
+		"straight": {"false"},
+	}, &comparison)
+	if err != nil {
+		return nil, err
+	}
+	// GitLab returns commits in chronological order
+	for i, j := 0, len(comparison.Commits)-1; i < j; i, j = i+1, j-1 {
+		comparison.Commits[i], comparison.Commits[j] = comparison.Commits[j], comparison.Commits[i]
+	}
+	return &comparison, nil
+}
+
+// GetCommitDiff returns the list of files changed in the given commit.
+func GetCommitDiff(domain, repo, commit string) ([]*Diff, error) {
+	var allDiffs []*Diff
+	page := "1"
+	for page != "" {
+		var diffs []*Diff
+		var err error
+		page, err = projectRequest(domain, repo, []string{"repository", "commits", commit, "diff"}, url.Values{
+			"per_page": {"100"},
+			"page":     {page},
+		}, &diffs)
+		if err != nil {
+			return nil, err
+		}
+		allDiffs = append(allDiffs, diffs...)
+	}
+	return allDiffs, nil
+}
+
+// IsMigrationPath returns true if the given file path is in a database upgrade directory:
+// upgrades/*.sql or upgrades/*.go used by dbutil in Go bridges, or db/upgrade/*.py in Python bridges.
+func IsMigrationPath(filePath string) bool {
+	dir, base := path.Split(filePath)
+	switch path.Base(dir) {
+	case "upgrades":
+		return strings.HasSuffix(base, ".sql") || strings.HasSuffix(base, ".go")
+	case "upgrade":
+		return (dir == "db/upgrade/" || strings.HasSuffix(dir, "/db/upgrade/")) && strings.HasSuffix(base, ".py") && base != "__init__.py"
+	default:
+		return false
+	}
+}
+
+// IsConfigPath returns true if the given file path looks like the example config or config upgrader of a bridge.
+func IsConfigPath(filePath string) bool {
+	base := path.Base(filePath)
+	return strings.HasPrefix(base, "example-config") ||
+		(base == "upgrade.go" && strings.Contains(filePath, "config"))
+}
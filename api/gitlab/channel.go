@@ -0,0 +1,106 @@
+package gitlab
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+type ChannelType string
+
+const (
+	ChannelDefault ChannelType = ""
+	ChannelBranch  ChannelType = "branch"
+	ChannelTag     ChannelType = "tag"
+	ChannelCommit  ChannelType = "commit"
+)
+
+// Channel describes which builds of a bridge should be installed.
+// The zero value tracks the default branch of the bridge repo.
+type Channel struct {
+	Type ChannelType
+	Ref  string
+}
+
+var commitHashRegex = regexp.MustCompile("^[0-9a-f]{40}$")
+var shortCommitHashRegex = regexp.MustCompile("^[0-9a-f]{7,39}$")
+
+// ParseChannel parses a channel in the format returned by Channel.String,
+// i.e. `default`, `branch:<name>`, `tag:<name>` or `commit:<sha>`.
+func ParseChannel(val string) (Channel, error) {
+	if val == "" || val == "default" {
+		return Channel{}, nil
+	}
+	typ, ref, ok := strings.Cut(val, ":")
+	if !ok || ref == "" {
+		return Channel{}, fmt.Errorf("invalid channel %q", val)
+	}
+	switch ChannelType(typ) {
+	case ChannelBranch, ChannelTag:
+		return Channel{Type: ChannelType(typ), Ref: ref}, nil
+	case ChannelCommit:
+		if !commitHashRegex.MatchString(ref) {
+			return Channel{}, fmt.Errorf("invalid commit hash %q (must be the full 40-character hash)", ref)
+		}
+		return Channel{Type: ChannelCommit, Ref: ref}, nil
+	default:
+		return Channel{}, fmt.Errorf("invalid channel type %q", typ)
+	}
+}
+
+// BranchChannel returns the channel for following the given branch.
+// The empty string and `default` mean the default branch.
+func BranchChannel(branch string) Channel {
+	if branch == "" || branch == "default" {
+		return Channel{}
+	}
+	return Channel{Type: ChannelBranch, Ref: branch}
+}
+
+// PinChannel returns the channel for pinning to a tag or an exact commit.
+// Full 40-character hex strings are treated as commits, anything else as a tag.
+// Abbreviated commit hashes are rejected, as pipelines can only be looked up by the full hash.
+func PinChannel(ref string) (Channel, error) {
+	if commitHashRegex.MatchString(ref) {
+		return Channel{Type: ChannelCommit, Ref: ref}, nil
+	} else if shortCommitHashRegex.MatchString(ref) {
+		return Channel{}, fmt.Errorf("%q looks like an abbreviated commit hash, pinning to a commit requires the full 40-character hash", ref)
+	}
+	return Channel{Type: ChannelTag, Ref: ref}, nil
+}
+
+func (ch Channel) IsDefault() bool {
+	return ch.Type == ChannelDefault
+}
+
+func (ch Channel) String() string {
+	if ch.IsDefault() {
+		return "default"
+	}
+	return fmt.Sprintf("%s:%s", ch.Type, ch.Ref)
+}
+
+// DirName returns a file name that can be used to keep binaries from different channels apart.
+// The default channel returns an empty string, so its binaries stay in the top-level directory.
+func (ch Channel) DirName() string {
+	switch ch.Type {
+	case ChannelDefault:
+		return ""
+	case ChannelCommit:
+		return fmt.Sprintf("commit-%s", ch.Ref[:8])
+	default:
+		return fmt.Sprintf("%s-%s", ch.Type, strings.NewReplacer("/", "_", "\\", "_", ":", "_").Replace(ch.Ref))
+	}
+}
+
+// queryRefs returns the ref and sha to filter pipelines by.
+func (ch Channel) queryRefs(defaultBranch string) (ref, sha string) {
+	switch ch.Type {
+	case ChannelBranch, ChannelTag:
+		return ch.Ref, ""
+	case ChannelCommit:
+		return "", ch.Ref
+	default:
+		return defaultBranch, ""
+	}
+}
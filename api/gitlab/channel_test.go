@@ -0,0 +1,93 @@
+package gitlab
+
+import (
+	"testing"
+)
+
+func TestParseChannel(t *testing.T) {
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		input   string
+		want    Channel
+		wantErr bool
+	}{
+		{"", Channel{}, false},
+		{"default", Channel{}, false},
+		{"branch:main", Channel{Type: ChannelBranch, Ref: "main"}, false},
+		{"branch:feature/foo", Channel{Type: ChannelBranch, Ref: "feature/foo"}, false},
+		{"tag:v0.10.0", Channel{Type: ChannelTag, Ref: "v0.10.0"}, false},
+		{"commit:" + commit, Channel{Type: ChannelCommit, Ref: commit}, false},
+		{"commit:0123456", Channel{}, true},
+		{"commit:" + commit[:39] + "G", Channel{}, true},
+		{"branch:", Channel{}, true},
+		{"main", Channel{}, true},
+		{"release:v1", Channel{}, true},
+	}
+	for _, test := range tests {
+		got, err := ParseChannel(test.input)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ParseChannel(%q) error = %v, want error: %t", test.input, err, test.wantErr)
+		} else if got != test.want {
+			t.Errorf("ParseChannel(%q) = %+v, want %+v", test.input, got, test.want)
+		}
+	}
+}
+
+func TestChannel_StringRoundTrip(t *testing.T) {
+	channels := []Channel{
+		{},
+		{Type: ChannelBranch, Ref: "feature/foo"},
+		{Type: ChannelTag, Ref: "v0.10.0"},
+		{Type: ChannelCommit, Ref: "0123456789abcdef0123456789abcdef01234567"},
+	}
+	for _, ch := range channels {
+		parsed, err := ParseChannel(ch.String())
+		if err != nil {
+			t.Errorf("ParseChannel(%q) failed: %v", ch.String(), err)
+		} else if parsed != ch {
+			t.Errorf("ParseChannel(%q) = %+v, want %+v", ch.String(), parsed, ch)
+		}
+	}
+}
+
+func TestChannel_DirName(t *testing.T) {
+	tests := []struct {
+		channel Channel
+		want    string
+	}{
+		{Channel{}, ""},
+		{Channel{Type: ChannelBranch, Ref: "feature/foo"}, "branch-feature_foo"},
+		{Channel{Type: ChannelTag, Ref: "v0.10.0"}, "tag-v0.10.0"},
+		{Channel{Type: ChannelCommit, Ref: "0123456789abcdef0123456789abcdef01234567"}, "commit-01234567"},
+	}
+	for _, test := range tests {
+		if got := test.channel.DirName(); got != test.want {
+			t.Errorf("%s.DirName() = %q, want %q", test.channel, got, test.want)
+		}
+	}
+}
+
+func TestPinChannel(t *testing.T) {
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	tests := []struct {
+		ref     string
+		want    Channel
+		wantErr bool
+	}{
+		{commit, Channel{Type: ChannelCommit, Ref: commit}, false},
+		{"v0.10.0", Channel{Type: ChannelTag, Ref: "v0.10.0"}, false},
+		{"v0.2411.0", Channel{Type: ChannelTag, Ref: "v0.2411.0"}, false},
+		{"012345", Channel{Type: ChannelTag, Ref: "012345"}, false},
+		{commit[:7], Channel{}, true},
+		{commit[:12], Channel{}, true},
+		{commit[:39], Channel{}, true},
+	}
+	for _, test := range tests {
+		got, err := PinChannel(test.ref)
+		if (err != nil) != test.wantErr {
+			t.Errorf("PinChannel(%q) error = %v, want error: %t", test.ref, err, test.wantErr)
+		} else if got != test.want {
+			t.Errorf("PinChannel(%q) = %+v, want %+v", test.ref, got, test.want)
+		}
+	}
+}
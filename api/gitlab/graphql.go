@@ -7,6 +7,7 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"strings"
 	"time"
 
 	"maunium.net/go/mautrix"
@@ -48,41 +49,86 @@ type queryResponse struct {
 	Errors QueryError      `json:"errors"`
 }
 
-func graphqlQuery(domain, query string, args any) (json.RawMessage, error) {
+type errorResponse struct {
+	Message string     `json:"message"`
+	Error   string     `json:"error"`
+	Errors  QueryError `json:"errors"`
+}
+
+// apiRequest sends a request to the GitLab API on the given domain and decodes the JSON response into the given value.
+// The path parts are escaped individually, so they may contain slashes (like project paths in the REST API).
+// The response headers are returned so callers can read pagination info.
+func apiRequest(method, domain string, pathParts []string, query url.Values, body, into any) (http.Header, error) {
+	plainPath := []string{"api"}
+	rawPath := []string{"api"}
+	for _, part := range pathParts {
+		plainPath = append(plainPath, part)
+		rawPath = append(rawPath, url.PathEscape(part))
+	}
 	req := &http.Request{
 		URL: &url.URL{
-			Scheme: "https",
-			Host:   domain,
-			Path:   "/api/graphql",
+			Scheme:   "https",
+			Host:     domain,
+			Path:     "/" + strings.Join(plainPath, "/"),
+			RawPath:  "/" + strings.Join(rawPath, "/"),
+			RawQuery: query.Encode(),
 		},
-		Method: http.MethodPost,
+		Method: method,
 		Header: http.Header{
-			"User-Agent":   {mautrix.DefaultUserAgent},
-			"Content-Type": {"application/json"},
-			"Accept":       {"application/json"},
+			"User-Agent": {mautrix.DefaultUserAgent},
+			"Accept":     {"application/json"},
 		},
 	}
-	var buf bytes.Buffer
-	err := json.NewEncoder(&buf).Encode(queryRequestBody{
-		Query:     query,
-		Variables: args,
-	})
-	if err != nil {
-		return nil, fmt.Errorf("failed to encode request body: %w", err)
+	if body != nil {
+		var buf bytes.Buffer
+		err := json.NewEncoder(&buf).Encode(body)
+		if err != nil {
+			return nil, fmt.Errorf("failed to encode request body: %w", err)
+		}
+		req.Header.Set("Content-Type", "application/json")
+		req.Body = io.NopCloser(&buf)
 	}
-	req.Body = io.NopCloser(&buf)
 	resp, err := cli.Do(req)
 	if err != nil {
 		return nil, fmt.Errorf("failed to send request: %w", err)
 	}
 	defer resp.Body.Close()
-	var respData queryResponse
-	err = json.NewDecoder(resp.Body).Decode(&respData)
+	if resp.StatusCode != http.StatusOK {
+		var errResp errorResponse
+		_ = json.NewDecoder(resp.Body).Decode(&errResp)
+		if len(errResp.Errors) > 0 {
+			return nil, errResp.Errors
+		}
+		return nil, fmt.Errorf("unexpected response status %d: %s", resp.StatusCode, errResp.Message+errResp.Error)
+	}
+	err = json.NewDecoder(resp.Body).Decode(into)
 	if err != nil {
 		return nil, fmt.Errorf("failed to decode response body: %w", err)
 	}
+	return resp.Header, nil
+}
+
+func graphqlQuery(domain, query string, args any) (json.RawMessage, error) {
+	var respData queryResponse
+	_, err := apiRequest(http.MethodPost, domain, []string{"graphql"}, nil, queryRequestBody{
+		Query:     query,
+		Variables: args,
+	}, &respData)
+	if err != nil {
+		return nil, err
+	}
 	if len(respData.Errors) > 0 {
 		return nil, respData.Errors
 	}
 	return respData.Data, nil
 }
+
+// projectRequest sends a GET request to the REST API of a project and returns the next page number, if there is one.
+// GitLab's GraphQL API can't compare commits or list commit diffs, so the changelog needs the REST API.
+func projectRequest(domain, repo string, pathParts []string, query url.Values, into any) (string, error) {
+	header, err := apiRequest(http.MethodGet, domain, append([]string{"v4", "projects", repo}, pathParts...), query, nil, into)
+	if err != nil {
+		return "", err
+	}
+	return header.Get("X-Next-Page"), nil
+}
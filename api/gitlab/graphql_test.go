@@ -0,0 +1,81 @@
+package gitlab
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func useTestServer(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+	server := httptest.NewTLSServer(handler)
+	origCli := cli
+	cli = server.Client()
+	t.Cleanup(func() {
+		cli = origCli
+		server.Close()
+	})
+	return strings.TrimPrefix(server.URL, "https://")
+}
+
+func TestGraphqlQuery(t *testing.T) {
+	domain := useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		var body queryRequestBody
+		if r.URL.Path != "/api/graphql" || r.Method != http.MethodPost {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		} else if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		switch body.Query {
+		case "ok":
+			_, _ = w.Write([]byte(`{"data":{"project":{"id":"1"}}}`))
+		case "error":
+			_, _ = w.Write([]byte(`{"errors":[{"message":"field doesn't exist"}]}`))
+		default:
+			w.WriteHeader(http.StatusUnauthorized)
+			_, _ = w.Write([]byte(`{"errors":[{"message":"invalid token"}]}`))
+		}
+	})
+	data, err := graphqlQuery(domain, "ok", nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if string(data) != `{"project":{"id":"1"}}` {
+		t.Errorf("unexpected data %s", data)
+	}
+	for query, wantErr := range map[string]string{"error": "field doesn't exist", "unauthorized": "invalid token"} {
+		_, err = graphqlQuery(domain, query, nil)
+		var queryErr QueryError
+		if !errors.As(err, &queryErr) || err.Error() != wantErr {
+			t.Errorf("query %q: expected QueryError %q, got %v", query, wantErr, err)
+		}
+	}
+}
+
+func TestProjectRequest(t *testing.T) {
+	domain := useTestServer(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.EscapedPath() != "/api/v4/projects/mautrix%2Fwhatsapp/repository/commits/abc/diff" {
+			w.WriteHeader(http.StatusNotFound)
+			_, _ = w.Write([]byte(`{"message":"404 Project Not Found"}`))
+			return
+		}
+		w.Header().Set("X-Next-Page", "2")
+		_, _ = w.Write([]byte(`[{"new_path":"upgrades/01.sql"}]`))
+	})
+	var diffs []*Diff
+	nextPage, err := projectRequest(domain, "mautrix/whatsapp", []string{"repository", "commits", "abc", "diff"}, url.Values{"page": {"1"}}, &diffs)
+	if err != nil {
+		t.Fatal(err)
+	} else if nextPage != "2" || len(diffs) != 1 || diffs[0].NewPath != "upgrades/01.sql" {
+		t.Errorf("unexpected result: next page %q, diffs %+v", nextPage, diffs)
+	}
+	_, err = projectRequest(domain, "mautrix/signal", []string{"repository", "compare"}, nil, &diffs)
+	if err == nil || !strings.Contains(err.Error(), "404 Project Not Found") {
+		t.Errorf("expected error with message from GitLab, got %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package artifacts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/schollz/progressbar/v3"
+
+	"github.com/beeper/bridge-manager/log"
+)
+
+const libolmFileName = "libolm.3.dylib"
+
+// Suffix of the file that stores the build ID next to binaries installed from sources that don't provide commits.
+const buildIDFileSuffix = ".build-id"
+
+func shortCommit(commit string) string {
+	if commit == "" {
+		return "unknown"
+	} else if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
+
+// Install installs the given bridge binary for the given platform from an artifact source.
+// It works the same way as gitlab.DownloadMautrixBridgeBinary, but checksums are always verified,
+// either using the checksums in the manifest or by the source itself.
+func Install(ctx context.Context, src Source, bridge, platform, path string, noUpdate bool, currentCommit string) error {
+	fileName := filepath.Base(path)
+	if currentCommit == "" {
+		log.Printf("Finding [cyan]%s[reset] in [cyan]%s[reset]", fileName, src)
+	} else {
+		log.Printf("Checking for updates to [cyan]%s[reset] in [cyan]%s[reset]", fileName, src)
+	}
+	build, err := src.Lookup(ctx, bridge, platform)
+	if err != nil {
+		return err
+	}
+	buildIDPath := path + buildIDFileSuffix
+	if build.Commit == "" && build.ID != "" && currentCommit != "" {
+		if installedID, _ := os.ReadFile(buildIDPath); string(installedID) == build.ID {
+			log.Printf("[cyan]%s[reset] is up to date (commit: %s)", fileName, shortCommit(currentCommit))
+			return nil
+		}
+	}
+	if build.Commit != "" && build.Commit == currentCommit {
+		log.Printf("[cyan]%s[reset] is up to date (commit: %s)", fileName, shortCommit(currentCommit))
+		return nil
+	} else if currentCommit != "" && noUpdate {
+		log.Printf("[cyan]%s[reset] [yellow]is out of date, source has commit %s (installed: %s)[reset]", fileName, shortCommit(build.Commit), shortCommit(currentCommit))
+		return nil
+	} else if !build.HasFile(fileName) {
+		return fmt.Errorf("%s for %s %w", fileName, platform, ErrNotInSource)
+	}
+	if currentCommit == "" {
+		log.Printf("Installing [cyan]%s[reset] (commit: %s)", fileName, shortCommit(build.Commit))
+	} else {
+		log.Printf("Updating [cyan]%s[reset] (%s -> %s)", fileName, shortCommit(currentCommit), shortCommit(build.Commit))
+	}
+	if build.VerifiedBySource {
+		log.Printf("[yellow]%s doesn't provide file checksums, relying on its own content verification for %s[reset]", src, fileName)
+	}
+	err = InstallFile(ctx, src, bridge, platform, build, fileName, path)
+	if err != nil {
+		return err
+	}
+	if build.ID != "" {
+		_ = os.WriteFile(buildIDPath, []byte(build.ID), 0600)
+	} else {
+		_ = os.Remove(buildIDPath)
+	}
+	if _, ok := build.Files[libolmFileName]; ok {
+		libolmPath := filepath.Join(filepath.Dir(path), libolmFileName)
+		if _, err = os.Stat(libolmPath); err != nil {
+			err = InstallFile(ctx, src, bridge, platform, build, libolmFileName, libolmPath)
+			if err != nil {
+				return fmt.Errorf("failed to install libolm: %w", err)
+			}
+		}
+	}
+	log.Printf("Successfully installed [cyan]%s[reset] commit %s", fileName, shortCommit(build.Commit))
+	return nil
+}
+
+// InstallFile copies a single file from an artifact source to the given path and verifies its checksum.
+// The file is written to a temporary file first and only moved into place if the checksum matches.
+func InstallFile(ctx context.Context, src Source, bridge, platform string, build *Build, fileName, path string) error {
+	if !build.HasFile(fileName) {
+		return fmt.Errorf("%s %w", fileName, ErrNotInSource)
+	}
+	reader, size, err := src.Open(ctx, bridge, platform, fileName)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", fileName, err)
+	}
+	defer reader.Close()
+	file, err := os.CreateTemp(filepath.Dir(path), "tmp-"+filepath.Base(path)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to open temp file: %w", err)
+	}
+	defer func() {
+		_ = file.Close()
+		_ = os.Remove(file.Name())
+	}()
+	bar := progressbar.DefaultBytes(size, fmt.Sprintf("Copying %s", color.CyanString(fileName)))
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, hasher, bar), reader)
+	if err != nil {
+		return fmt.Errorf("failed to write file: %w", err)
+	}
+	_ = file.Close()
+	if !build.VerifiedBySource {
+		expectedHash := build.Files[fileName]
+		if expectedHash == "" {
+			return fmt.Errorf("no checksum for %s in manifest", fileName)
+		} else if actualHash := hex.EncodeToString(hasher.Sum(nil)); actualHash != expectedHash {
+			return ChecksumMismatchError{FileName: fileName, Expected: expectedHash, Actual: actualHash}
+		}
+	}
+	err = os.Rename(file.Name(), path)
+	if err != nil {
+		return fmt.Errorf("failed to move temp file: %w", err)
+	}
+	err = os.Chmod(path, 0755)
+	if err != nil {
+		return fmt.Errorf("failed to chmod binary: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,100 @@
+package artifacts
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const ManifestFileName = "manifest.json"
+
+// Manifest describes the contents of an artifact source. Files are stored in the same layout as CI artifacts,
+// with one directory per bridge and platform: <bridge>/<os>-<arch>/<file name>.
+type Manifest struct {
+	CreatedAt time.Time `json:"created_at"`
+	// Map from bridge type (as used in CI) to platform (os/arch) to build info.
+	Bridges map[string]map[string]*Build `json:"bridges"`
+}
+
+type Build struct {
+	Commit string `json:"commit"`
+	// Map from file name to hex-encoded SHA-256 checksum.
+	Files map[string]string `json:"files"`
+	// An opaque identifier for the build, used to detect updates when the source doesn't know the commit.
+	ID string `json:"-"`
+	// Set by sources that verify content themselves (like OCI registries) instead of listing checksums in Files.
+	// This can't be set in manifests, so manifest sources always have to provide checksums.
+	VerifiedBySource bool `json:"-"`
+}
+
+// HasFile returns true if the build may contain the given file.
+func (b *Build) HasFile(fileName string) bool {
+	if b.VerifiedBySource {
+		return true
+	}
+	_, ok := b.Files[fileName]
+	return ok
+}
+
+func (m *Manifest) Get(bridge, platform string) *Build {
+	if m == nil || m.Bridges == nil {
+		return nil
+	}
+	return m.Bridges[bridge][platform]
+}
+
+func (m *Manifest) Set(bridge, platform string, build *Build) {
+	if m.Bridges == nil {
+		m.Bridges = make(map[string]map[string]*Build)
+	}
+	if m.Bridges[bridge] == nil {
+		m.Bridges[bridge] = make(map[string]*Build)
+	}
+	m.Bridges[bridge][platform] = build
+}
+
+// FilePath returns the slash-separated path of a file inside an artifact source.
+func FilePath(bridge, platform, fileName string) string {
+	return path.Join(bridge, strings.ReplaceAll(platform, "/", "-"), fileName)
+}
+
+// HashFile returns the hex-encoded SHA-256 checksum of the given file.
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	hasher := sha256.New()
+	_, err = io.Copy(hasher, file)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+type ChecksumMismatchError struct {
+	FileName string
+	Expected string
+	Actual   string
+}
+
+func (cme ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum mismatch for %s: expected %s, got %s", cme.FileName, cme.Expected, cme.Actual)
+}
+
+// WriteManifest writes the manifest into the given directory.
+func WriteManifest(dir string, manifest *Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(dir, ManifestFileName), data, 0644)
+}
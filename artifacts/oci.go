@@ -0,0 +1,416 @@
+package artifacts
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/schollz/progressbar/v3"
+	"maunium.net/go/mautrix"
+)
+
+const (
+	mediaTypeOCIIndex          = "application/vnd.oci.image.index.v1+json"
+	mediaTypeOCIManifest       = "application/vnd.oci.image.manifest.v1+json"
+	mediaTypeDockerList        = "application/vnd.docker.distribution.manifest.list.v2+json"
+	mediaTypeDockerManifest    = "application/vnd.docker.distribution.manifest.v2+json"
+	mediaTypeOCILayerTar       = "application/vnd.oci.image.layer.v1.tar"
+	mediaTypeOCILayerGzip      = "application/vnd.oci.image.layer.v1.tar+gzip"
+	mediaTypeDockerLayerGzip   = "application/vnd.docker.image.rootfs.diff.tar.gzip"
+	labelRevision              = "org.opencontainers.image.revision"
+	bridgePlaceholder          = "{bridge}"
+	defaultOCITag              = "latest"
+	ociWhiteoutPrefix          = ".wh."
+	ociDefaultBinaryPathPrefix = "usr/"
+)
+
+// DefaultOCISource is the registry where the mautrix bridge images are published.
+const DefaultOCISource = "oci://dock.mau.dev/mautrix"
+
+type ociDescriptor struct {
+	MediaType string `json:"mediaType"`
+	Digest    string `json:"digest"`
+	Size      int64  `json:"size"`
+	Platform  *struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant"`
+	} `json:"platform,omitempty"`
+}
+
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Manifests []ociDescriptor `json:"manifests"`
+	Config    ociDescriptor   `json:"config"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+type ociImageConfig struct {
+	Config struct {
+		Labels map[string]string `json:"Labels"`
+	} `json:"config"`
+}
+
+type ociImage struct {
+	repo     string
+	manifest *ociManifest
+}
+
+// ociSource installs bridge binaries by extracting them from container images in an OCI registry.
+//
+// The location is oci://<registry>/<repository template>[:<tag>], where the repository template may contain
+// {bridge}, which is replaced with the bridge type. If there's no placeholder, /{bridge} is appended.
+// Use oci+http:// for registries that don't support TLS, like a local test registry.
+type ociSource struct {
+	scheme       string
+	registry     string
+	repoTemplate string
+	tag          string
+
+	tokens map[string]string
+	images map[string]*ociImage
+}
+
+func newOCISource(location string) (*ociSource, error) {
+	scheme := "https"
+	if strings.HasPrefix(location, "oci+http://") {
+		scheme = "http"
+	}
+	_, rest, _ := strings.Cut(location, "://")
+	registry, repoTemplate, ok := strings.Cut(rest, "/")
+	if !ok || registry == "" || repoTemplate == "" {
+		return nil, fmt.Errorf("invalid OCI location %q", location)
+	}
+	tag := defaultOCITag
+	if lastSlash := strings.LastIndexByte(repoTemplate, '/'); strings.LastIndexByte(repoTemplate, ':') > lastSlash {
+		repoTemplate, tag, _ = strings.Cut(repoTemplate, ":")
+	}
+	if !strings.Contains(repoTemplate, bridgePlaceholder) {
+		repoTemplate = path.Join(repoTemplate, bridgePlaceholder)
+	}
+	return &ociSource{
+		scheme:       scheme,
+		registry:     registry,
+		repoTemplate: repoTemplate,
+		tag:          tag,
+		tokens:       make(map[string]string),
+		images:       make(map[string]*ociImage),
+	}, nil
+}
+
+func (src *ociSource) String() string {
+	return fmt.Sprintf("%s/%s:%s", src.registry, src.repoTemplate, src.tag)
+}
+
+// getToken fetches an anonymous bearer token based on a WWW-Authenticate challenge.
+func (src *ociSource) getToken(ctx context.Context, challenge string) (string, error) {
+	scheme, params, _ := strings.Cut(challenge, " ")
+	if !strings.EqualFold(scheme, "Bearer") {
+		return "", fmt.Errorf("unsupported auth scheme %q", scheme)
+	}
+	values := make(map[string]string)
+	for _, part := range strings.Split(params, ",") {
+		key, value, _ := strings.Cut(strings.TrimSpace(part), "=")
+		values[key] = strings.Trim(value, `"`)
+	}
+	tokenURL, err := url.Parse(values["realm"])
+	if err != nil || values["realm"] == "" {
+		return "", fmt.Errorf("invalid auth realm %q", values["realm"])
+	}
+	query := tokenURL.Query()
+	if values["service"] != "" {
+		query.Set("service", values["service"])
+	}
+	if values["scope"] != "" {
+		query.Set("scope", values["scope"])
+	}
+	tokenURL.RawQuery = query.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, tokenURL.String(), nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", mautrix.DefaultUserAgent)
+	resp, err := noTimeoutCli.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected response status %d", resp.StatusCode)
+	}
+	var tokenResp struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&tokenResp)
+	if err != nil {
+		return "", err
+	}
+	if tokenResp.Token != "" {
+		return tokenResp.Token, nil
+	}
+	return tokenResp.AccessToken, nil
+}
+
+func (src *ociSource) request(ctx context.Context, repo, path string, accept ...string) (*http.Response, error) {
+	reqURL := (&url.URL{Scheme: src.scheme, Host: src.registry, Path: fmt.Sprintf("/v2/%s/%s", repo, path)}).String()
+	for attempt := 0; ; attempt++ {
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, reqURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("failed to prepare request: %w", err)
+		}
+		req.Header.Set("User-Agent", mautrix.DefaultUserAgent)
+		if len(accept) > 0 {
+			req.Header.Set("Accept", strings.Join(accept, ", "))
+		}
+		if token := src.tokens[repo]; token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		resp, err := noTimeoutCli.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("failed to send request: %w", err)
+		}
+		if resp.StatusCode == http.StatusUnauthorized && attempt == 0 {
+			_ = resp.Body.Close()
+			src.tokens[repo], err = src.getToken(ctx, resp.Header.Get("WWW-Authenticate"))
+			if err != nil {
+				return nil, fmt.Errorf("failed to get registry token: %w", err)
+			}
+			continue
+		} else if resp.StatusCode == http.StatusNotFound {
+			_ = resp.Body.Close()
+			return nil, fmt.Errorf("%s/%s %w", repo, path, ErrNotInSource)
+		} else if resp.StatusCode != http.StatusOK {
+			_ = resp.Body.Close()
+			return nil, fmt.Errorf("unexpected response status %d for %s/%s", resp.StatusCode, repo, path)
+		}
+		return resp, nil
+	}
+}
+
+func (src *ociSource) getManifest(ctx context.Context, repo, ref string) (*ociManifest, error) {
+	resp, err := src.request(ctx, repo, "manifests/"+ref, mediaTypeOCIIndex, mediaTypeDockerList, mediaTypeOCIManifest, mediaTypeDockerManifest)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	var manifest ociManifest
+	err = json.NewDecoder(resp.Body).Decode(&manifest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse manifest: %w", err)
+	}
+	if manifest.MediaType == "" {
+		manifest.MediaType = resp.Header.Get("Content-Type")
+	}
+	return &manifest, nil
+}
+
+func platformMatches(desc ociDescriptor, platform string) bool {
+	if desc.Platform == nil {
+		return false
+	}
+	goos, arch, _ := strings.Cut(platform, "/")
+	arch, variant, _ := strings.Cut(arch, "/")
+	return desc.Platform.OS == goos && desc.Platform.Architecture == arch && (variant == "" || desc.Platform.Variant == variant)
+}
+
+func (src *ociSource) resolveImage(ctx context.Context, bridge, platform string) (*ociImage, error) {
+	cacheKey := bridge + "@" + platform
+	if img, ok := src.images[cacheKey]; ok {
+		return img, nil
+	}
+	repo := strings.ReplaceAll(src.repoTemplate, bridgePlaceholder, bridge)
+	manifest, err := src.getManifest(ctx, repo, src.tag)
+	if err != nil {
+		return nil, err
+	}
+	if manifest.MediaType == mediaTypeOCIIndex || manifest.MediaType == mediaTypeDockerList || len(manifest.Manifests) > 0 {
+		var platformDigest string
+		for _, desc := range manifest.Manifests {
+			if platformMatches(desc, platform) {
+				platformDigest = desc.Digest
+				break
+			}
+		}
+		if platformDigest == "" {
+			return nil, fmt.Errorf("%s:%s for %s %w", repo, src.tag, platform, ErrNotInSource)
+		}
+		manifest, err = src.getManifest(ctx, repo, platformDigest)
+		if err != nil {
+			return nil, err
+		}
+	}
+	img := &ociImage{repo: repo, manifest: manifest}
+	src.images[cacheKey] = img
+	return img, nil
+}
+
+func (src *ociSource) Lookup(ctx context.Context, bridge, platform string) (*Build, error) {
+	img, err := src.resolveImage(ctx, bridge, platform)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := src.request(ctx, img.repo, "blobs/"+img.manifest.Config.Digest)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get image config: %w", err)
+	}
+	defer resp.Body.Close()
+	var cfg ociImageConfig
+	err = json.NewDecoder(resp.Body).Decode(&cfg)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse image config: %w", err)
+	}
+	// Layers are content-addressed, so the individual files don't need separate checksums.
+	return &Build{
+		Commit:           cfg.Config.Labels[labelRevision],
+		ID:               img.manifest.Config.Digest,
+		VerifiedBySource: true,
+	}, nil
+}
+
+// downloadBlob downloads a layer into a temporary file and verifies its digest.
+func (src *ociSource) downloadBlob(ctx context.Context, repo string, desc ociDescriptor, fileName string) (*tempFile, error) {
+	algorithm, expectedHash, _ := strings.Cut(desc.Digest, ":")
+	if algorithm != "sha256" {
+		return nil, fmt.Errorf("unsupported digest algorithm %q", algorithm)
+	}
+	resp, err := src.request(ctx, repo, "blobs/"+desc.Digest)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	file, err := createTempFile("bbctl-oci-layer-*")
+	if err != nil {
+		return nil, err
+	}
+	hasher := sha256.New()
+	bar := progressbar.DefaultBytes(desc.Size, fmt.Sprintf("Downloading %s layer", color.CyanString(fileName)))
+	var body io.Reader = resp.Body
+	if desc.Size > 0 {
+		// Anything past the declared size can't match the digest anyway
+		body = io.LimitReader(body, desc.Size)
+	}
+	_, err = io.Copy(io.MultiWriter(file, hasher, bar), body)
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("failed to download layer: %w", err)
+	}
+	if actualHash := hex.EncodeToString(hasher.Sum(nil)); actualHash != expectedHash {
+		_ = file.Close()
+		return nil, ChecksumMismatchError{FileName: desc.Digest, Expected: expectedHash, Actual: actualHash}
+	}
+	_, err = file.Seek(0, io.SeekStart)
+	if err != nil {
+		_ = file.Close()
+		return nil, err
+	}
+	return file, nil
+}
+
+var errWhiteout = errors.New("file was deleted in layer")
+
+// extractFromLayer looks for a binary with the given name in a layer and copies it into a new temporary file.
+func extractFromLayer(layer io.Reader, mediaType, fileName string) (*tempFile, error) {
+	switch mediaType {
+	case mediaTypeOCILayerGzip, mediaTypeDockerLayerGzip:
+		gzReader, err := gzip.NewReader(layer)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		defer gzReader.Close()
+		layer = gzReader
+	case mediaTypeOCILayerTar:
+	default:
+		return nil, fmt.Errorf("unsupported layer media type %q", mediaType)
+	}
+	tarReader := tar.NewReader(layer)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			return nil, nil
+		} else if err != nil {
+			return nil, fmt.Errorf("failed to read layer: %w", err)
+		}
+		name := strings.TrimPrefix(header.Name, "./")
+		if path.Base(name) == ociWhiteoutPrefix+fileName && strings.HasPrefix(name, ociDefaultBinaryPathPrefix) {
+			return nil, errWhiteout
+		} else if header.Typeflag != tar.TypeReg || path.Base(name) != fileName || !strings.HasPrefix(name, ociDefaultBinaryPathPrefix) {
+			continue
+		}
+		file, err := createTempFile("bbctl-oci-file-*")
+		if err != nil {
+			return nil, err
+		}
+		_, err = io.Copy(file, tarReader)
+		if err == nil {
+			_, err = file.Seek(0, io.SeekStart)
+		}
+		if err != nil {
+			_ = file.Close()
+			return nil, fmt.Errorf("failed to extract %s: %w", name, err)
+		}
+		return file, nil
+	}
+}
+
+// Open finds the given file in the image's /usr tree (e.g. /usr/bin/mautrix-whatsapp).
+// Layers are searched from the top, so files overwritten in later layers are handled correctly.
+func (src *ociSource) Open(ctx context.Context, bridge, platform, fileName string) (io.ReadCloser, int64, error) {
+	img, err := src.resolveImage(ctx, bridge, platform)
+	if err != nil {
+		return nil, 0, err
+	}
+	for i := len(img.manifest.Layers) - 1; i >= 0; i-- {
+		desc := img.manifest.Layers[i]
+		layer, err := src.downloadBlob(ctx, img.repo, desc, fileName)
+		if err != nil {
+			return nil, 0, err
+		}
+		file, err := extractFromLayer(layer, desc.MediaType, fileName)
+		_ = layer.Close()
+		if errors.Is(err, errWhiteout) {
+			break
+		} else if err != nil {
+			return nil, 0, err
+		} else if file != nil {
+			stat, err := file.Stat()
+			if err != nil {
+				_ = file.Close()
+				return nil, 0, err
+			}
+			return file, stat.Size(), nil
+		}
+	}
+	return nil, 0, fmt.Errorf("%s in %s %w", fileName, img.repo, ErrNotInSource)
+}
+
+// tempFile is a file that is deleted when closed.
+type tempFile struct {
+	*os.File
+}
+
+func createTempFile(pattern string) (*tempFile, error) {
+	file, err := os.CreateTemp("", pattern)
+	if err != nil {
+		return nil, fmt.Errorf("failed to create temp file: %w", err)
+	}
+	return &tempFile{file}, nil
+}
+
+func (tf *tempFile) Close() error {
+	err := tf.File.Close()
+	_ = os.Remove(tf.Name())
+	return err
+}
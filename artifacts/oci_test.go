@@ -0,0 +1,225 @@
+package artifacts
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testLayerFile struct {
+	name    string
+	content string
+}
+
+func makeTestLayer(t *testing.T, gzipped bool, files ...testLayerFile) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	var writer io.Writer = &buf
+	var gzWriter *gzip.Writer
+	if gzipped {
+		gzWriter = gzip.NewWriter(&buf)
+		writer = gzWriter
+	}
+	tarWriter := tar.NewWriter(writer)
+	for _, file := range files {
+		err := tarWriter.WriteHeader(&tar.Header{Name: file.name, Mode: 0755, Size: int64(len(file.content)), Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = tarWriter.Write([]byte(file.content))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tarWriter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if gzWriter != nil {
+		if err := gzWriter.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return buf.Bytes()
+}
+
+func testDigest(data []byte) string {
+	hash := sha256.Sum256(data)
+	return "sha256:" + hex.EncodeToString(hash[:])
+}
+
+// testRegistry is a minimal OCI registry that serves manifests and blobs from memory
+// and requires an anonymous bearer token like real registries do.
+type testRegistry struct {
+	t         *testing.T
+	server    *httptest.Server
+	manifests map[string][]byte
+	blobs     map[string][]byte
+}
+
+func newTestRegistry(t *testing.T) *testRegistry {
+	reg := &testRegistry{t: t, manifests: make(map[string][]byte), blobs: make(map[string][]byte)}
+	reg.server = httptest.NewServer(http.HandlerFunc(reg.serveHTTP))
+	t.Cleanup(reg.server.Close)
+	return reg
+}
+
+func (reg *testRegistry) serveHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.URL.Path == "/token" {
+		_ = json.NewEncoder(w).Encode(map[string]string{"token": "test-token"})
+		return
+	} else if r.Header.Get("Authorization") != "Bearer test-token" {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="`+reg.server.URL+`/token",service="test",scope="repository:pull"`)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if manifest, ok := reg.manifests[r.URL.Path]; ok {
+		var parsed ociManifest
+		_ = json.Unmarshal(manifest, &parsed)
+		w.Header().Set("Content-Type", parsed.MediaType)
+		_, _ = w.Write(manifest)
+	} else if blob, ok := reg.blobs[r.URL.Path]; ok {
+		_, _ = w.Write(blob)
+	} else {
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func (reg *testRegistry) addBlob(repo string, data []byte) ociDescriptor {
+	digest := testDigest(data)
+	reg.blobs["/v2/"+repo+"/blobs/"+digest] = data
+	return ociDescriptor{Digest: digest, Size: int64(len(data))}
+}
+
+func (reg *testRegistry) addManifest(repo, ref string, manifest *ociManifest) ociDescriptor {
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		reg.t.Fatal(err)
+	}
+	digest := testDigest(data)
+	reg.manifests["/v2/"+repo+"/manifests/"+ref] = data
+	reg.manifests["/v2/"+repo+"/manifests/"+digest] = data
+	return ociDescriptor{MediaType: manifest.MediaType, Digest: digest, Size: int64(len(data))}
+}
+
+// addImage adds a multi-platform image for linux/amd64 with the given layers, from bottom to top.
+func (reg *testRegistry) addImage(repo, revision string, layers ...[]byte) *ociManifest {
+	config := ociImageConfig{}
+	config.Config.Labels = map[string]string{labelRevision: revision}
+	configData, _ := json.Marshal(config)
+	manifest := &ociManifest{
+		MediaType: mediaTypeOCIManifest,
+		Config:    reg.addBlob(repo, configData),
+	}
+	for i, layer := range layers {
+		desc := reg.addBlob(repo, layer)
+		desc.MediaType = mediaTypeOCILayerGzip
+		if i%2 == 1 {
+			desc.MediaType = mediaTypeOCILayerTar
+		}
+		manifest.Layers = append(manifest.Layers, desc)
+	}
+	platformDesc := reg.addManifest(repo, "amd64-only", manifest)
+	platformDesc.Platform = &struct {
+		OS           string `json:"os"`
+		Architecture string `json:"architecture"`
+		Variant      string `json:"variant"`
+	}{OS: "linux", Architecture: "amd64"}
+	reg.addManifest(repo, defaultOCITag, &ociManifest{
+		MediaType: mediaTypeOCIIndex,
+		Manifests: []ociDescriptor{platformDesc},
+	})
+	return manifest
+}
+
+func (reg *testRegistry) openSource(t *testing.T) Source {
+	src, err := OpenSource("oci+http://" + strings.TrimPrefix(reg.server.URL, "http://") + "/mautrix")
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func readSourceFile(t *testing.T, src Source, bridge, fileName string) (string, error) {
+	t.Helper()
+	file, _, err := src.Open(context.Background(), bridge, "linux/amd64", fileName)
+	if err != nil {
+		return "", err
+	}
+	defer file.Close()
+	data, err := io.ReadAll(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(data), nil
+}
+
+func TestOCISource_Extract(t *testing.T) {
+	reg := newTestRegistry(t)
+	reg.addImage("mautrix/whatsapp", "0123456789abcdef",
+		makeTestLayer(t, true, testLayerFile{"usr/bin/mautrix-whatsapp", "old binary"}, testLayerFile{"etc/passwd", "root"}),
+		makeTestLayer(t, false, testLayerFile{"./usr/bin/mautrix-whatsapp", "new binary"}),
+	)
+	src := reg.openSource(t)
+
+	build, err := src.Lookup(context.Background(), "whatsapp", "linux/amd64")
+	if err != nil {
+		t.Fatalf("Lookup failed: %v", err)
+	} else if build.Commit != "0123456789abcdef" {
+		t.Errorf("expected commit from image label, got %q", build.Commit)
+	}
+	content, err := readSourceFile(t, src, "whatsapp", "mautrix-whatsapp")
+	if err != nil {
+		t.Fatalf("Open failed: %v", err)
+	} else if content != "new binary" {
+		t.Errorf("expected file from the top layer, got %q", content)
+	}
+	_, err = readSourceFile(t, src, "whatsapp", "mautrix-signal")
+	if !errors.Is(err, ErrNotInSource) {
+		t.Errorf("expected ErrNotInSource for missing file, got %v", err)
+	}
+	_, err = src.Lookup(context.Background(), "whatsapp", "linux/arm64")
+	if !errors.Is(err, ErrNotInSource) {
+		t.Errorf("expected ErrNotInSource for missing platform, got %v", err)
+	}
+	_, err = src.Lookup(context.Background(), "discord", "linux/amd64")
+	if !errors.Is(err, ErrNotInSource) {
+		t.Errorf("expected ErrNotInSource for missing repository, got %v", err)
+	}
+}
+
+func TestOCISource_Whiteout(t *testing.T) {
+	reg := newTestRegistry(t)
+	reg.addImage("mautrix/signal", "fedcba9876543210",
+		makeTestLayer(t, true, testLayerFile{"usr/bin/mautrix-signal", "deleted binary"}),
+		makeTestLayer(t, false, testLayerFile{"usr/bin/.wh.mautrix-signal", ""}),
+	)
+	_, err := readSourceFile(t, reg.openSource(t), "signal", "mautrix-signal")
+	if !errors.Is(err, ErrNotInSource) {
+		t.Errorf("expected ErrNotInSource for whited out file, got %v", err)
+	}
+}
+
+func TestOCISource_DigestMismatch(t *testing.T) {
+	reg := newTestRegistry(t)
+	manifest := reg.addImage("mautrix/whatsapp", "0123456789abcdef",
+		makeTestLayer(t, true, testLayerFile{"usr/bin/mautrix-whatsapp", "binary"}),
+	)
+	reg.blobs["/v2/mautrix/whatsapp/blobs/"+manifest.Layers[0].Digest] = makeTestLayer(t, true, testLayerFile{"usr/bin/mautrix-whatsapp", "tampered binary"})
+	_, err := readSourceFile(t, reg.openSource(t), "whatsapp", "mautrix-whatsapp")
+	var mismatchErr ChecksumMismatchError
+	if !errors.As(err, &mismatchErr) {
+		t.Fatalf("expected checksum mismatch error, got %v", err)
+	} else if "sha256:"+mismatchErr.Expected != manifest.Layers[0].Digest {
+		t.Errorf("expected mismatch for layer %s, got %s", manifest.Layers[0].Digest, mismatchErr.Expected)
+	}
+}
@@ -0,0 +1,233 @@
+package artifacts
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"maunium.net/go/mautrix"
+)
+
+var ErrNotInSource = errors.New("not found in artifact source")
+
+// Source is a place bridge binaries can be installed from instead of the mau.dev CI.
+type Source interface {
+	// Lookup returns the build of the given bridge for the given platform.
+	Lookup(ctx context.Context, bridge, platform string) (*Build, error)
+	// Open opens a file from the build of the given bridge for the given platform.
+	// The returned size is -1 if it's not known in advance.
+	Open(ctx context.Context, bridge, platform, fileName string) (io.ReadCloser, int64, error)
+	String() string
+}
+
+// OpenSource parses the location of an artifact source. The location can be a local directory,
+// a tarball (.tar, .tar.gz or .tgz), a http(s) URL of a mirror using the same layout as a directory,
+// or an oci:// or oci+http:// URL of a container image registry.
+func OpenSource(location string) (Source, error) {
+	if strings.HasPrefix(location, "oci://") || strings.HasPrefix(location, "oci+http://") {
+		return newOCISource(location)
+	}
+	if strings.HasPrefix(location, "http://") || strings.HasPrefix(location, "https://") {
+		parsed, err := url.Parse(location)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse mirror URL: %w", err)
+		}
+		return &httpSource{baseURL: parsed}, nil
+	}
+	stat, err := os.Stat(location)
+	if err != nil {
+		return nil, err
+	} else if stat.IsDir() {
+		return &dirSource{root: location}, nil
+	} else if isTarball(location) {
+		return &tarSource{path: location}, nil
+	}
+	return nil, fmt.Errorf("%s is not a directory or tarball", location)
+}
+
+func isTarball(path string) bool {
+	return strings.HasSuffix(path, ".tar") || strings.HasSuffix(path, ".tar.gz") || strings.HasSuffix(path, ".tgz")
+}
+
+func lookupInManifest(manifest *Manifest, bridge, platform string) (*Build, error) {
+	build := manifest.Get(bridge, platform)
+	if build == nil {
+		return nil, fmt.Errorf("%s for %s %w", bridge, platform, ErrNotInSource)
+	} else if len(build.Files) == 0 {
+		return nil, fmt.Errorf("manifest entry of %s for %s doesn't list any files with checksums", bridge, platform)
+	}
+	return build, nil
+}
+
+type dirSource struct {
+	root     string
+	manifest *Manifest
+}
+
+func (ds *dirSource) String() string {
+	return ds.root
+}
+
+func (ds *dirSource) Lookup(_ context.Context, bridge, platform string) (*Build, error) {
+	if ds.manifest == nil {
+		file, err := os.Open(filepath.Join(ds.root, ManifestFileName))
+		if err != nil {
+			return nil, fmt.Errorf("failed to open manifest: %w", err)
+		}
+		defer file.Close()
+		err = json.NewDecoder(file).Decode(&ds.manifest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+	}
+	return lookupInManifest(ds.manifest, bridge, platform)
+}
+
+func (ds *dirSource) Open(_ context.Context, bridge, platform, fileName string) (io.ReadCloser, int64, error) {
+	file, err := os.Open(filepath.Join(ds.root, filepath.FromSlash(FilePath(bridge, platform, fileName))))
+	if err != nil {
+		return nil, 0, err
+	}
+	stat, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, 0, err
+	}
+	return file, stat.Size(), nil
+}
+
+type tarSource struct {
+	path     string
+	manifest *Manifest
+}
+
+func (ts *tarSource) String() string {
+	return ts.path
+}
+
+type tarFile struct {
+	io.Reader
+	closers []io.Closer
+}
+
+func (tf *tarFile) Close() error {
+	for i := len(tf.closers) - 1; i >= 0; i-- {
+		_ = tf.closers[i].Close()
+	}
+	return nil
+}
+
+// find scans the tarball for the given file. Tarballs aren't seekable, so every lookup reads the archive from the start.
+func (ts *tarSource) find(name string) (*tarFile, int64, error) {
+	file, err := os.Open(ts.path)
+	if err != nil {
+		return nil, 0, err
+	}
+	tf := &tarFile{closers: []io.Closer{file}}
+	var reader io.Reader = file
+	if !strings.HasSuffix(ts.path, ".tar") {
+		gzReader, err := gzip.NewReader(file)
+		if err != nil {
+			_ = tf.Close()
+			return nil, 0, fmt.Errorf("failed to open gzip stream: %w", err)
+		}
+		tf.closers = append(tf.closers, gzReader)
+		reader = gzReader
+	}
+	tarReader := tar.NewReader(reader)
+	for {
+		header, err := tarReader.Next()
+		if errors.Is(err, io.EOF) {
+			_ = tf.Close()
+			return nil, 0, fmt.Errorf("%s %w", name, ErrNotInSource)
+		} else if err != nil {
+			_ = tf.Close()
+			return nil, 0, fmt.Errorf("failed to read tarball: %w", err)
+		}
+		if header.Typeflag == tar.TypeReg && strings.TrimPrefix(header.Name, "./") == name {
+			tf.Reader = tarReader
+			return tf, header.Size, nil
+		}
+	}
+}
+
+func (ts *tarSource) Lookup(_ context.Context, bridge, platform string) (*Build, error) {
+	if ts.manifest == nil {
+		file, _, err := ts.find(ManifestFileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to open manifest: %w", err)
+		}
+		defer file.Close()
+		err = json.NewDecoder(file).Decode(&ts.manifest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+	}
+	return lookupInManifest(ts.manifest, bridge, platform)
+}
+
+func (ts *tarSource) Open(_ context.Context, bridge, platform, fileName string) (io.ReadCloser, int64, error) {
+	return ts.find(FilePath(bridge, platform, fileName))
+}
+
+type httpSource struct {
+	baseURL  *url.URL
+	manifest *Manifest
+}
+
+var noTimeoutCli = &http.Client{}
+
+func (hs *httpSource) String() string {
+	return hs.baseURL.String()
+}
+
+func (hs *httpSource) get(ctx context.Context, path string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, hs.baseURL.JoinPath(path).String(), nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to prepare request: %w", err)
+	}
+	req.Header.Set("User-Agent", mautrix.DefaultUserAgent)
+	resp, err := noTimeoutCli.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %w", err)
+	} else if resp.StatusCode == http.StatusNotFound {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("%s %w", path, ErrNotInSource)
+	} else if resp.StatusCode != http.StatusOK {
+		_ = resp.Body.Close()
+		return nil, fmt.Errorf("unexpected response status %d for %s", resp.StatusCode, path)
+	}
+	return resp, nil
+}
+
+func (hs *httpSource) Lookup(ctx context.Context, bridge, platform string) (*Build, error) {
+	if hs.manifest == nil {
+		resp, err := hs.get(ctx, ManifestFileName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get manifest: %w", err)
+		}
+		defer resp.Body.Close()
+		err = json.NewDecoder(resp.Body).Decode(&hs.manifest)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse manifest: %w", err)
+		}
+	}
+	return lookupInManifest(hs.manifest, bridge, platform)
+}
+
+func (hs *httpSource) Open(ctx context.Context, bridge, platform, fileName string) (io.ReadCloser, int64, error) {
+	resp, err := hs.get(ctx, FilePath(bridge, platform, fileName))
+	if err != nil {
+		return nil, 0, err
+	}
+	return resp.Body, resp.ContentLength, nil
+}
@@ -0,0 +1,63 @@
+package artifacts
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestDirSource_Checksums(t *testing.T) {
+	const content = "#!/bin/sh\necho bridge\n"
+	hash := sha256.Sum256([]byte(content))
+	validHash := hex.EncodeToString(hash[:])
+	tests := []struct {
+		name    string
+		files   map[string]string
+		wantErr string
+	}{
+		{"valid checksum", map[string]string{"mautrix-test": validHash}, ""},
+		{"missing files", nil, "doesn't list any files"},
+		{"empty files", map[string]string{}, "doesn't list any files"},
+		{"missing checksum", map[string]string{"mautrix-test": ""}, "no checksum"},
+		{"wrong checksum", map[string]string{"mautrix-test": strings.Repeat("0", 64)}, "checksum mismatch"},
+		{"other file only", map[string]string{"mautrix-other": validHash}, ErrNotInSource.Error()},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dir := t.TempDir()
+			filePath := filepath.Join(dir, filepath.FromSlash(FilePath("test", "linux/amd64", "mautrix-test")))
+			if err := os.MkdirAll(filepath.Dir(filePath), 0755); err != nil {
+				t.Fatal(err)
+			} else if err = os.WriteFile(filePath, []byte(content), 0755); err != nil {
+				t.Fatal(err)
+			}
+			manifest := &Manifest{}
+			manifest.Set("test", "linux/amd64", &Build{Commit: "abc", Files: test.files})
+			if err := WriteManifest(dir, manifest); err != nil {
+				t.Fatal(err)
+			}
+			src, err := OpenSource(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			installPath := filepath.Join(t.TempDir(), "mautrix-test")
+			err = Install(context.Background(), src, "test", "linux/amd64", installPath, false, "")
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			} else if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+			}
+			if _, statErr := os.Stat(installPath); !errors.Is(statErr, os.ErrNotExist) {
+				t.Errorf("unverified binary was installed")
+			}
+		})
+	}
+}
@@ -4,6 +4,7 @@ import (
 	"embed"
 	"fmt"
 	"reflect"
+	"slices"
 	"strings"
 	"text/template"
 
@@ -24,6 +25,10 @@ type BridgeV2Name struct {
 type Params struct {
 	HungryAddress string
 	BeeperDomain  string
+	// The server name of the homeserver, which bridges on Beeper always see as beeper.local.
+	HomeserverDomain string
+	// Standalone is set when the bridge connects to a standard Matrix homeserver instead of Beeper.
+	Standalone bool
 
 	Websocket  bool
 	ListenAddr string
@@ -39,6 +44,8 @@ type Params struct {
 	ProvisioningSecret string
 
 	DatabasePrefix string
+	// If set, the bridge uses this PostgreSQL database instead of SQLite.
+	PostgresURI string
 
 	BridgeV2Name
 
@@ -60,29 +67,83 @@ var tplFuncs = template.FuncMap{
 		val.FieldByName(field).Set(reflect.ValueOf(value))
 		return ""
 	},
+	// Marks a value as secret so it's redacted when printing the config. Replaced for each Generate call.
+	"secret": func(value any) string {
+		return fmt.Sprint(value)
+	},
+	// Formats a value as a YAML string, quoting it if necessary. Replaced for each Generate call.
+	"yaml": func(value any) string {
+		return YAMLString(stringify(value))
+	},
 }
 
-func init() {
-	var err error
-	tpl, err = template.New("configs").Funcs(tplFuncs).ParseFS(configs, "*")
-	if err != nil {
-		panic(fmt.Errorf("failed to parse bridge config templates: %w", err))
-	}
-	for _, sub := range tpl.Templates() {
-		SupportedBridges = append(SupportedBridges, strings.TrimSuffix(sub.Name(), ".tpl.yaml"))
+// stringify converts a template value to a string. Missing map keys are nil, which becomes an empty string.
+func stringify(value any) string {
+	if value == nil {
+		return ""
 	}
+	return fmt.Sprint(value)
 }
 
-func templateName(bridgeName string) string {
-	return fmt.Sprintf("%s.tpl.yaml", bridgeName)
+func init() {
+	err := loadTemplates("")
+	if err != nil {
+		panic(fmt.Errorf("failed to load bridge config templates: %w", err))
+	}
 }
 
 func IsSupported(bridgeName string) bool {
 	return tpl.Lookup(templateName(bridgeName)) != nil
 }
 
-func Generate(bridgeName string, params Params) (string, error) {
+// Generate renders the config template of a bridge. It also returns the secret values in the config, i.e. values
+// marked with the secret template function and the values of params that the template declares as secret.
+func Generate(bridgeName string, params Params) (string, []string, error) {
+	var secrets []string
+	addSecret := func(value string) {
+		if value != "" && !slices.Contains(secrets, value) {
+			secrets = append(secrets, value)
+		}
+	}
+	if meta := GetMetadata(bridgeName); meta != nil {
+		for _, param := range meta.Params {
+			if param.Secret {
+				addSecret(params.Params[param.Name])
+			}
+		}
+	}
+	if params.HomeserverDomain == "" {
+		params.HomeserverDomain = "beeper.local"
+	}
+	genTpl, err := tpl.Clone()
+	if err != nil {
+		return "", nil, err
+	}
+	genTpl.Funcs(template.FuncMap{
+		// The values are untyped so that missing params don't cause an error
+		"secret": func(value any) string {
+			str := stringify(value)
+			addSecret(str)
+			return str
+		},
+		"yaml": func(value any) string {
+			str := stringify(value)
+			quoted := YAMLString(str)
+			if quoted != str && slices.Contains(secrets, str) {
+				// Escaping may change the secret, so redact the quoted version too
+				addSecret(strings.TrimSuffix(strings.TrimPrefix(quoted, `"`), `"`))
+			}
+			return quoted
+		},
+	})
 	var out strings.Builder
-	err := tpl.ExecuteTemplate(&out, templateName(bridgeName), &params)
-	return out.String(), err
+	err = genTpl.ExecuteTemplate(&out, templateName(bridgeName), &params)
+	if err != nil {
+		return "", nil, err
+	}
+	err = ValidateConfig(bridgeName, out.String())
+	if err != nil {
+		return out.String(), secrets, fmt.Errorf("generated config is invalid: %w", err)
+	}
+	return out.String(), secrets, nil
 }
@@ -0,0 +1,229 @@
+package bridgeconfig
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type ChangeType string
+
+const (
+	ChangeAdded   ChangeType = "added"
+	ChangeRemoved ChangeType = "removed"
+	ChangeChanged ChangeType = "changed"
+)
+
+// Change is a difference between two configs. Old is empty for added keys and New is empty for removed keys.
+type Change struct {
+	Path string
+	Type ChangeType
+	Old  string
+	New  string
+}
+
+// Conflict is a value that was changed both in the user's config and in the template.
+type Conflict struct {
+	Path    string
+	Base    string
+	Current string
+	Updated string
+}
+
+func parseConfigRoot(config, name string) (*yaml.Node, *yaml.Node, error) {
+	var root yaml.Node
+	err := yaml.Unmarshal([]byte(config), &root)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to parse %s: %w", name, err)
+	} else if len(root.Content) == 0 || root.Content[0].Kind != yaml.MappingNode {
+		return nil, nil, fmt.Errorf("%s is not a YAML mapping", name)
+	}
+	return &root, root.Content[0], nil
+}
+
+func nodesEqual(a, b *yaml.Node) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	var aVal, bVal any
+	if a.Decode(&aVal) != nil || b.Decode(&bVal) != nil {
+		return false
+	}
+	return reflect.DeepEqual(aVal, bVal)
+}
+
+// formatValue formats a YAML node on a single line for diffs.
+func formatValue(node *yaml.Node) string {
+	if node == nil {
+		return ""
+	} else if node.Kind == yaml.ScalarNode {
+		return node.Value
+	}
+	var val any
+	if node.Decode(&val) == nil {
+		if data, err := json.Marshal(val); err == nil {
+			return string(data)
+		}
+	}
+	data, _ := yaml.Marshal(node)
+	return strings.TrimSpace(string(data))
+}
+
+// DiffConfigs returns the structural differences between two YAML configs.
+// Mappings are compared key by key, while other values, including lists, are compared as a whole.
+func DiffConfigs(oldConfig, newConfig string) ([]Change, error) {
+	_, oldNode, err := parseConfigRoot(oldConfig, "old config")
+	if err != nil {
+		return nil, err
+	}
+	_, newNode, err := parseConfigRoot(newConfig, "new config")
+	if err != nil {
+		return nil, err
+	}
+	var changes []Change
+	diffNodes(oldNode, newNode, "", &changes)
+	return changes, nil
+}
+
+func diffNodes(oldNode, newNode *yaml.Node, path string, changes *[]Change) {
+	if oldNode.Kind != yaml.MappingNode || newNode.Kind != yaml.MappingNode {
+		if !nodesEqual(oldNode, newNode) {
+			*changes = append(*changes, Change{Path: path, Type: ChangeChanged, Old: formatValue(oldNode), New: formatValue(newNode)})
+		}
+		return
+	}
+	for i := 0; i+1 < len(newNode.Content); i += 2 {
+		key := newNode.Content[i].Value
+		keyPath := joinPath(path, key)
+		if oldValue := findMappingValue(oldNode, key); oldValue == nil {
+			*changes = append(*changes, Change{Path: keyPath, Type: ChangeAdded, New: formatValue(newNode.Content[i+1])})
+		} else {
+			diffNodes(oldValue, newNode.Content[i+1], keyPath, changes)
+		}
+	}
+	for i := 0; i+1 < len(oldNode.Content); i += 2 {
+		key := oldNode.Content[i].Value
+		if findMappingValue(newNode, key) == nil {
+			*changes = append(*changes, Change{Path: joinPath(path, key), Type: ChangeRemoved, Old: formatValue(oldNode.Content[i+1])})
+		}
+	}
+}
+
+type merger struct {
+	baseKnown     bool
+	preferUpdated bool
+	conflicts     []Conflict
+}
+
+// MergeConfigs does a three-way merge between the last generated config (base), the user's config (current)
+// and a freshly generated config (updated). Changes made by the user are kept, while changes in the template
+// are applied to values the user hasn't touched. Values changed on both sides are returned as conflicts and
+// resolved based on preferUpdated.
+//
+// If the base config is empty (i.e. it wasn't stored), new keys are added, but nothing else is changed.
+// The result keeps the comments of the user's config, and new keys get the comments from the template.
+func MergeConfigs(base, current, updated string, preferUpdated bool) (string, []Conflict, error) {
+	m := &merger{preferUpdated: preferUpdated}
+	var baseNode *yaml.Node
+	if base != "" {
+		var err error
+		_, baseNode, err = parseConfigRoot(base, "last generated config")
+		if err != nil {
+			return "", nil, err
+		}
+		m.baseKnown = true
+	}
+	currentRoot, currentNode, err := parseConfigRoot(current, "current config")
+	if err != nil {
+		return "", nil, err
+	}
+	_, updatedNode, err := parseConfigRoot(updated, "new config")
+	if err != nil {
+		return "", nil, err
+	}
+	m.mergeMapping(baseNode, currentNode, updatedNode, "")
+	merged, err := encodeConfig(currentRoot)
+	if err != nil {
+		return "", nil, err
+	}
+	return merged, m.conflicts, nil
+}
+
+func (m *merger) mergeMapping(base, current, updated *yaml.Node, path string) {
+	if base != nil && base.Kind != yaml.MappingNode {
+		base = nil
+	}
+	childBase := func(key string) *yaml.Node {
+		if base == nil {
+			return nil
+		}
+		return findMappingValue(base, key)
+	}
+	prevKey := ""
+	for i := 0; i+1 < len(updated.Content); i += 2 {
+		key := updated.Content[i].Value
+		keyPath := joinPath(path, key)
+		updatedValue := updated.Content[i+1]
+		currentValue := findMappingValue(current, key)
+		if currentValue != nil && currentValue.Kind == yaml.MappingNode && updatedValue.Kind == yaml.MappingNode {
+			m.mergeMapping(childBase(key), currentValue, updatedValue, keyPath)
+		} else if m.takeUpdated(childBase(key), currentValue, updatedValue, keyPath) {
+			if currentValue == nil {
+				insertMappingPair(current, prevKey, updated.Content[i], updatedValue)
+			} else {
+				replaceNode(currentValue, updatedValue)
+			}
+		}
+		if findMappingValue(current, key) != nil {
+			prevKey = key
+		}
+	}
+	for i := 0; i+1 < len(current.Content); {
+		key := current.Content[i].Value
+		if findMappingValue(updated, key) == nil && m.takeUpdated(childBase(key), current.Content[i+1], nil, joinPath(path, key)) {
+			current.Content = append(current.Content[:i], current.Content[i+2:]...)
+		} else {
+			i += 2
+		}
+	}
+}
+
+// takeUpdated decides whether the current value should be replaced with the updated value (which may be nil to remove the key).
+func (m *merger) takeUpdated(base, current, updated *yaml.Node, path string) bool {
+	switch {
+	case nodesEqual(current, updated):
+		return false
+	case !m.baseKnown:
+		return current == nil
+	case nodesEqual(base, current):
+		// The user didn't change the value, so the template change can be applied
+		return true
+	case nodesEqual(base, updated):
+		// The template didn't change the value, so the user's change is kept
+		return false
+	default:
+		m.conflicts = append(m.conflicts, Conflict{
+			Path:    path,
+			Base:    formatValue(base),
+			Current: formatValue(current),
+			Updated: formatValue(updated),
+		})
+		return m.preferUpdated
+	}
+}
+
+func insertMappingPair(mapping *yaml.Node, afterKey string, key, value *yaml.Node) {
+	index := 0
+	if afterKey != "" {
+		for i := 0; i+1 < len(mapping.Content); i += 2 {
+			if mapping.Content[i].Value == afterKey {
+				index = i + 2
+				break
+			}
+		}
+	}
+	mapping.Content = append(mapping.Content[:index], append([]*yaml.Node{key, value}, mapping.Content[index:]...)...)
+}
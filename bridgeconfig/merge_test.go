@@ -0,0 +1,167 @@
+package bridgeconfig
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	testMergeBase = `network:
+    displayname: "{{.PushName}}"
+    history_sync: false
+bridge:
+    command_prefix: '!wa'
+    old_option: true
+`
+	testMergeCurrent = `network:
+    # My custom display name
+    displayname: "{{.FullName}}"
+    history_sync: false
+bridge:
+    command_prefix: '!whatsapp'
+    old_option: true
+`
+	testMergeUpdated = `network:
+    displayname: "{{.PushName}}"
+    history_sync: true
+    new_option: 5
+bridge:
+    command_prefix: '!wa2'
+`
+)
+
+func lookupTestValue(t *testing.T, config, path string) any {
+	t.Helper()
+	var value any
+	if err := yaml.Unmarshal([]byte(config), &value); err != nil {
+		t.Fatalf("failed to parse merged config: %v", err)
+	}
+	for _, key := range strings.Split(path, ".") {
+		mapping, ok := value.(map[string]any)
+		if !ok {
+			return nil
+		}
+		value = mapping[key]
+	}
+	return value
+}
+
+func TestMergeConfigs(t *testing.T) {
+	tests := []struct {
+		name          string
+		base          string
+		preferUpdated bool
+		want          map[string]any
+		wantConflicts []Conflict
+	}{
+		{
+			name: "prefer current",
+			base: testMergeBase,
+			want: map[string]any{
+				// Changed by the user only
+				"network.displayname": "{{.FullName}}",
+				// Changed in the template only
+				"network.history_sync": true,
+				"network.new_option":   5,
+				"bridge.old_option":    nil,
+				// Changed on both sides
+				"bridge.command_prefix": "!whatsapp",
+			},
+			wantConflicts: []Conflict{{Path: "bridge.command_prefix", Base: "!wa", Current: "!whatsapp", Updated: "!wa2"}},
+		},
+		{
+			name:          "prefer updated",
+			base:          testMergeBase,
+			preferUpdated: true,
+			want: map[string]any{
+				"network.displayname":   "{{.FullName}}",
+				"network.history_sync":  true,
+				"bridge.command_prefix": "!wa2",
+			},
+			wantConflicts: []Conflict{{Path: "bridge.command_prefix", Base: "!wa", Current: "!whatsapp", Updated: "!wa2"}},
+		},
+		{
+			name: "unknown base",
+			base: "",
+			want: map[string]any{
+				// Only new keys are added when it's not known what the user changed
+				"network.new_option":    5,
+				"network.displayname":   "{{.FullName}}",
+				"network.history_sync":  false,
+				"bridge.command_prefix": "!whatsapp",
+				"bridge.old_option":     true,
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			merged, conflicts, err := MergeConfigs(test.base, testMergeCurrent, testMergeUpdated, test.preferUpdated)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for path, want := range test.want {
+				if got := lookupTestValue(t, merged, path); !reflect.DeepEqual(got, want) {
+					t.Errorf("%s = %#v, want %#v", path, got, want)
+				}
+			}
+			if !reflect.DeepEqual(conflicts, test.wantConflicts) {
+				t.Errorf("conflicts = %+v, want %+v", conflicts, test.wantConflicts)
+			}
+			if !strings.Contains(merged, "# My custom display name") {
+				t.Errorf("comment of the current config was lost:\n%s", merged)
+			}
+		})
+	}
+}
+
+func TestMergeConfigs_NewKeyPosition(t *testing.T) {
+	merged, _, err := MergeConfigs(testMergeBase, testMergeCurrent, testMergeUpdated, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	historySync := strings.Index(merged, "history_sync:")
+	newOption := strings.Index(merged, "new_option:")
+	bridge := strings.Index(merged, "bridge:")
+	if !(historySync < newOption && newOption < bridge) {
+		t.Errorf("new key wasn't inserted after its predecessor in the template:\n%s", merged)
+	}
+}
+
+func TestMergeConfigs_Invalid(t *testing.T) {
+	tests := []struct {
+		name                   string
+		base, current, updated string
+	}{
+		{"invalid base", "bridge: [", testMergeCurrent, testMergeUpdated},
+		{"invalid current", testMergeBase, "- not a mapping", testMergeUpdated},
+		{"empty updated", testMergeBase, testMergeCurrent, ""},
+	}
+	for _, test := range tests {
+		if _, _, err := MergeConfigs(test.base, test.current, test.updated, false); err == nil {
+			t.Errorf("%s: expected error", test.name)
+		}
+	}
+}
+
+func TestDiffConfigs(t *testing.T) {
+	changes, err := DiffConfigs(testMergeBase, testMergeUpdated)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]ChangeType{
+		"network.history_sync":  ChangeChanged,
+		"network.new_option":    ChangeAdded,
+		"bridge.command_prefix": ChangeChanged,
+		"bridge.old_option":     ChangeRemoved,
+	}
+	got := make(map[string]ChangeType, len(changes))
+	for _, change := range changes {
+		got[change.Path] = change.Type
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("changes = %v, want %v", got, want)
+	}
+}
@@ -0,0 +1,133 @@
+package bridgeconfig
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Metadata is declared in a YAML comment at the start of a template:
+//
+//	{{- /* bbctl:
+//	min_bridge_version: v0.7.0
+//	max_bridge_version: v0.7
+//	*/ -}}
+//
+// Templates that include the shared bridgev2 template inherit its metadata for fields they don't set,
+// except for the bridge version range, which is specific to each bridge.
+type Metadata struct {
+	// The range of bridge versions the config template is known to work with.
+	// The maximum only limits the major and minor version.
+	MinBridgeVersion string `yaml:"min_bridge_version"`
+	MaxBridgeVersion string `yaml:"max_bridge_version"`
+	// The range of mautrix-go versions the config template is known to work with,
+	// which determines the format of the shared bridgev2 config sections.
+	MinMautrixVersion string `yaml:"min_mautrix_version"`
+	MaxMautrixVersion string `yaml:"max_mautrix_version"`
+	// Bridge-specific params that can be passed with --param.
+	Params []*Param `yaml:"params"`
+	// The database types the bridge supports (sqlite and/or postgres). Defaults to both.
+	Databases []string `yaml:"databases"`
+	// Required keys and value types that generated configs are checked against.
+	Schema Schema `yaml:"schema"`
+
+	declared bool
+	bridgeV2 bool
+}
+
+const metadataPrefix = "{{- /* bbctl:"
+const metadataSuffix = "*/ -}}"
+const bridgev2Include = `{{ template "bridgev2.tpl.yaml" . }}`
+
+var metadata map[string]*Metadata
+
+func parseMetadata(content string) (*Metadata, error) {
+	if !strings.HasPrefix(content, metadataPrefix) {
+		return nil, nil
+	}
+	end := strings.Index(content, metadataSuffix)
+	if end < 0 {
+		return nil, fmt.Errorf("unterminated metadata comment")
+	}
+	meta := Metadata{declared: true}
+	err := yaml.Unmarshal([]byte(content[len(metadataPrefix):end]), &meta)
+	if err != nil {
+		return nil, err
+	}
+	err = meta.validateParams()
+	if err != nil {
+		return nil, err
+	}
+	err = meta.Schema.validate()
+	if err != nil {
+		return nil, err
+	}
+	return &meta, nil
+}
+
+func (meta *Metadata) inherit(parent *Metadata) {
+	if parent == nil {
+		return
+	}
+	if meta.MinMautrixVersion == "" {
+		meta.MinMautrixVersion = parent.MinMautrixVersion
+	}
+	if meta.MaxMautrixVersion == "" {
+		meta.MaxMautrixVersion = parent.MaxMautrixVersion
+	}
+	if len(meta.Databases) == 0 {
+		meta.Databases = parent.Databases
+	}
+	for path, typ := range parent.Schema {
+		if _, ok := meta.Schema[path]; !ok {
+			if meta.Schema == nil {
+				meta.Schema = make(Schema)
+			}
+			meta.Schema[path] = typ
+		}
+	}
+	for _, param := range parent.Params {
+		if meta.GetParam(param.Name) == nil {
+			meta.Params = append(meta.Params, param)
+		}
+	}
+	meta.declared = meta.declared || parent.declared
+}
+
+// SupportsPostgres returns true if the bridge can use a PostgreSQL database.
+func (meta *Metadata) SupportsPostgres() bool {
+	return meta == nil || len(meta.Databases) == 0 || slices.Contains(meta.Databases, "postgres")
+}
+
+// IsBridgeV2 returns true if the config template of the bridge is based on the shared bridgev2 template.
+func (meta *Metadata) IsBridgeV2() bool {
+	return meta != nil && meta.bridgeV2
+}
+
+func loadMetadata(infos map[string]*TemplateInfo) (map[string]*Metadata, error) {
+	loaded := make(map[string]*Metadata, len(infos))
+	for name, info := range infos {
+		meta, err := parseMetadata(info.Content)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse metadata of %s: %w", name, err)
+		}
+		if meta == nil {
+			meta = &Metadata{}
+		}
+		loaded[name] = meta
+	}
+	for name, info := range infos {
+		if strings.Contains(info.Content, bridgev2Include) {
+			loaded[name].inherit(loaded[templateName("bridgev2")])
+			loaded[name].bridgeV2 = true
+		}
+	}
+	return loaded, nil
+}
+
+// GetMetadata returns the metadata declared in the config template of the given bridge type.
+func GetMetadata(bridgeName string) *Metadata {
+	return metadata[templateName(bridgeName)]
+}
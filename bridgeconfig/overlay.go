@@ -0,0 +1,178 @@
+package bridgeconfig
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// ReplaceTag can be used on a value in an overlay to replace the value in the config entirely instead of merging into it.
+// This is the only way to add keys that aren't in the template, e.g. new entries in the permissions map.
+const ReplaceTag = "!replace"
+
+var ErrUnknownPath = errors.New("doesn't exist in the generated config")
+
+// ApplyOverlay deep-merges a YAML overlay into a generated config, then applies path.to.key=value assignments.
+// Comments in the generated config are preserved, but the config is reformatted if there's anything to apply.
+func ApplyOverlay(config string, overlay []byte, sets []string) (string, error) {
+	if len(bytes.TrimSpace(overlay)) == 0 && len(sets) == 0 {
+		return config, nil
+	}
+	var root yaml.Node
+	err := yaml.Unmarshal([]byte(config), &root)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse generated config: %w", err)
+	} else if len(root.Content) == 0 {
+		return "", fmt.Errorf("generated config is empty")
+	}
+	doc := root.Content[0]
+	if len(bytes.TrimSpace(overlay)) > 0 {
+		var overlayRoot yaml.Node
+		err = yaml.Unmarshal(overlay, &overlayRoot)
+		if err != nil {
+			return "", fmt.Errorf("failed to parse overlay: %w", err)
+		}
+		if len(overlayRoot.Content) > 0 {
+			err = mergeNode(doc, overlayRoot.Content[0], "")
+			if err != nil {
+				return "", err
+			}
+		}
+	}
+	for _, set := range sets {
+		err = setValue(doc, set)
+		if err != nil {
+			return "", err
+		}
+	}
+	return encodeConfig(&root)
+}
+
+// encodeConfig encodes a YAML document with the same indentation as the config templates.
+func encodeConfig(root *yaml.Node) (string, error) {
+	var buf bytes.Buffer
+	enc := yaml.NewEncoder(&buf)
+	enc.SetIndent(4)
+	err := enc.Encode(root)
+	if err == nil {
+		err = enc.Close()
+	}
+	if err != nil {
+		return "", fmt.Errorf("failed to encode config: %w", err)
+	}
+	return buf.String(), nil
+}
+
+func joinPath(path, key string) string {
+	key = strings.ReplaceAll(key, ".", `\.`)
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// splitPath splits a dot-separated path. Dots that are part of a key can be escaped with a backslash.
+func splitPath(path string) []string {
+	var parts []string
+	var current strings.Builder
+	for i := 0; i < len(path); i++ {
+		if path[i] == '\\' && i+1 < len(path) && path[i+1] == '.' {
+			current.WriteByte('.')
+			i++
+		} else if path[i] == '.' {
+			parts = append(parts, current.String())
+			current.Reset()
+		} else {
+			current.WriteByte(path[i])
+		}
+	}
+	return append(parts, current.String())
+}
+
+func findMappingValue(node *yaml.Node, key string) *yaml.Node {
+	for i := 0; i+1 < len(node.Content); i += 2 {
+		if node.Content[i].Value == key {
+			return node.Content[i+1]
+		}
+	}
+	return nil
+}
+
+// replaceNode replaces the value of a node while keeping the comments of the original node.
+func replaceNode(target, value *yaml.Node) {
+	if value.Tag == ReplaceTag {
+		value.Tag = ""
+	}
+	head, line, foot := target.HeadComment, target.LineComment, target.FootComment
+	*target = *value
+	if target.HeadComment == "" {
+		target.HeadComment = head
+	}
+	if target.LineComment == "" {
+		target.LineComment = line
+	}
+	if target.FootComment == "" {
+		target.FootComment = foot
+	}
+}
+
+func mergeNode(target, overlay *yaml.Node, path string) error {
+	if overlay.Tag == ReplaceTag || target.Kind != yaml.MappingNode || overlay.Kind != yaml.MappingNode {
+		replaceNode(target, overlay)
+		return nil
+	}
+	for i := 0; i+1 < len(overlay.Content); i += 2 {
+		key := overlay.Content[i].Value
+		keyPath := joinPath(path, key)
+		existing := findMappingValue(target, key)
+		if existing == nil {
+			return fmt.Errorf("%s %w (use %s on the parent to replace it entirely)", keyPath, ErrUnknownPath, ReplaceTag)
+		}
+		err := mergeNode(existing, overlay.Content[i+1], keyPath)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func setValue(doc *yaml.Node, set string) error {
+	path, rawValue, ok := strings.Cut(set, "=")
+	if !ok || path == "" {
+		return fmt.Errorf("invalid assignment %q, expected path.to.key=value", set)
+	}
+	var value yaml.Node
+	err := yaml.Unmarshal([]byte(rawValue), &value)
+	if err != nil {
+		return fmt.Errorf("failed to parse value of %s: %w", path, err)
+	}
+	newNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: ""}
+	if len(value.Content) > 0 {
+		newNode = value.Content[0]
+	}
+	target := doc
+	for _, key := range splitPath(path) {
+		switch target.Kind {
+		case yaml.MappingNode:
+			target = findMappingValue(target, key)
+		case yaml.SequenceNode:
+			index, err := strconv.Atoi(key)
+			if err != nil || index < 0 || index >= len(target.Content) {
+				target = nil
+			} else {
+				target = target.Content[index]
+			}
+		default:
+			target = nil
+		}
+		if target == nil {
+			return fmt.Errorf("%s %w", path, ErrUnknownPath)
+		}
+	}
+	replaceNode(target, newNode)
+	return nil
+}
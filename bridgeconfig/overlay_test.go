@@ -0,0 +1,124 @@
+package bridgeconfig
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const testOverlayConfig = `homeserver:
+    # The address of the homeserver
+    address: https://matrix.example.com
+    domain: example.com
+bridge:
+    permissions:
+        '*': relay
+        example.com: user
+    relay:
+        enabled: false
+logging:
+    writers:
+        - type: stdout
+          format: pretty-colored
+        - type: file
+          format: json
+`
+
+func TestApplyOverlay(t *testing.T) {
+	tests := []struct {
+		name    string
+		overlay string
+		sets    []string
+		want    []string
+		notWant []string
+		wantErr error
+	}{
+		{
+			name:    "nested merge",
+			overlay: "bridge:\n    relay:\n        enabled: true\n",
+			want:    []string{"enabled: true", "'*': relay", "# The address of the homeserver"},
+		},
+		{
+			name:    "replace tag adds keys",
+			overlay: "bridge:\n    permissions: !replace\n        '@admin:example.com': admin\n",
+			want:    []string{"'@admin:example.com': admin"},
+			notWant: []string{"'*': relay"},
+		},
+		{
+			name: "set scalar",
+			sets: []string{"homeserver.address=http://localhost:8008"},
+			want: []string{"address: http://localhost:8008", "# The address of the homeserver"},
+		},
+		{
+			name: "set escaped key",
+			sets: []string{`bridge.permissions.example\.com=admin`},
+			want: []string{"example.com: admin"},
+		},
+		{
+			name: "set sequence item",
+			sets: []string{"logging.writers.1.format=pretty"},
+			want: []string{"format: pretty\n"},
+		},
+		{
+			name:    "set after overlay",
+			overlay: "bridge:\n    relay:\n        enabled: true\n",
+			sets:    []string{"bridge.relay.enabled=false"},
+			want:    []string{"enabled: false"},
+		},
+		{
+			name:    "unknown overlay key",
+			overlay: "bridge:\n    unknown: true\n",
+			wantErr: ErrUnknownPath,
+		},
+		{
+			name:    "unknown set path",
+			sets:    []string{"bridge.relay.unknown=true"},
+			wantErr: ErrUnknownPath,
+		},
+		{
+			name:    "sequence index out of range",
+			sets:    []string{"logging.writers.2.format=json"},
+			wantErr: ErrUnknownPath,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, err := ApplyOverlay(testOverlayConfig, []byte(test.overlay), test.sets)
+			if test.wantErr != nil {
+				if !errors.Is(err, test.wantErr) {
+					t.Fatalf("expected %v, got %v", test.wantErr, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			for _, want := range test.want {
+				if !strings.Contains(got, want) {
+					t.Errorf("expected output to contain %q, got:\n%s", want, got)
+				}
+			}
+			for _, notWant := range test.notWant {
+				if strings.Contains(got, notWant) {
+					t.Errorf("expected output not to contain %q, got:\n%s", notWant, got)
+				}
+			}
+		})
+	}
+}
+
+func TestApplyOverlay_Empty(t *testing.T) {
+	got, err := ApplyOverlay(testOverlayConfig, []byte("  \n"), nil)
+	if err != nil {
+		t.Fatal(err)
+	} else if got != testOverlayConfig {
+		t.Errorf("config was changed without an overlay:\n%s", got)
+	}
+}
+
+func TestApplyOverlay_InvalidAssignment(t *testing.T) {
+	for _, set := range []string{"no-equals-sign", "=value"} {
+		if _, err := ApplyOverlay(testOverlayConfig, nil, []string{set}); err == nil {
+			t.Errorf("expected error for %q", set)
+		}
+	}
+}
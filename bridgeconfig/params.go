@@ -0,0 +1,139 @@
+package bridgeconfig
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strconv"
+)
+
+type ParamType string
+
+const (
+	ParamTypeString ParamType = "string"
+	ParamTypeInt    ParamType = "int"
+	ParamTypeBool   ParamType = "bool"
+)
+
+// Param is a bridge-specific config generation option declared in the metadata of a template:
+//
+//	params:
+//	- name: bluebubbles_url
+//	  required: true
+//	  when: {imessage_platform: [bluebubbles]}
+//	  validator: url
+//	  help: BlueBubbles API address
+type Param struct {
+	Name string    `yaml:"name"`
+	Type ParamType `yaml:"type"`
+	// If set, the value must be one of these.
+	Values []string `yaml:"values"`
+	// Descriptions of the allowed values, shown when asking the user to pick one.
+	ValueHelp map[string]string `yaml:"value_help"`
+	Default   string            `yaml:"default"`
+	// Required params are asked interactively if they're not specified.
+	Required bool `yaml:"required"`
+	// Secret params aren't echoed when asked interactively.
+	Secret bool   `yaml:"secret"`
+	Help   string `yaml:"help"`
+	// The param is only used if the other params have one of the listed values.
+	When map[string][]string `yaml:"when"`
+	// Name of a ParamValidator that checks the value when it's entered, see RegisterParamValidator.
+	Validator string `yaml:"validator"`
+}
+
+// AppliesTo returns true if the conditions of the param are met by the other params.
+func (p *Param) AppliesTo(params map[string]string) bool {
+	for name, values := range p.When {
+		if !slices.Contains(values, params[name]) {
+			return false
+		}
+	}
+	return true
+}
+
+// IsSecretRef returns true if the value is a secret reference that must be resolved before it's used.
+// Only secret params can reference secrets, values of other params are always used as-is.
+func (p *Param) IsSecretRef(value string) bool {
+	return p != nil && p.Secret && IsSecretRef(value)
+}
+
+// Validate checks that a value is valid for the param. Empty values are only allowed for optional params.
+func (p *Param) Validate(value string) error {
+	if value == "" {
+		if p.Required {
+			return fmt.Errorf("%s is required", p.Name)
+		}
+		return nil
+	}
+	if len(p.Values) > 0 && !slices.Contains(p.Values, value) {
+		return fmt.Errorf("invalid value %q for %s (allowed values: %v)", value, p.Name, p.Values)
+	}
+	var err error
+	switch p.Type {
+	case ParamTypeInt:
+		_, err = strconv.Atoi(value)
+	case ParamTypeBool:
+		_, err = strconv.ParseBool(value)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value %q for %s (expected %s)", value, p.Name, p.Type)
+	}
+	return nil
+}
+
+// Check validates the value and runs the validator of the param, which may connect to external services.
+// The other params are passed to the validator.
+func (p *Param) Check(ctx context.Context, value string, params map[string]string) error {
+	err := p.Validate(value)
+	if err != nil || value == "" || p.Validator == "" {
+		return err
+	}
+	err = paramValidators[p.Validator](ctx, value, params)
+	if err != nil {
+		return fmt.Errorf("invalid value for %s: %w", p.Name, err)
+	}
+	return nil
+}
+
+func (meta *Metadata) validateParams() error {
+	seen := make(map[string]bool, len(meta.Params))
+	for _, param := range meta.Params {
+		if param.Name == "" {
+			return fmt.Errorf("param without name")
+		} else if seen[param.Name] {
+			return fmt.Errorf("duplicate param %s", param.Name)
+		}
+		seen[param.Name] = true
+		switch param.Type {
+		case "":
+			param.Type = ParamTypeString
+		case ParamTypeString, ParamTypeInt, ParamTypeBool:
+		default:
+			return fmt.Errorf("unknown type %q for param %s", param.Type, param.Name)
+		}
+		if _, ok := paramValidators[param.Validator]; param.Validator != "" && !ok {
+			return fmt.Errorf("unknown validator %q for param %s", param.Validator, param.Name)
+		}
+	}
+	return nil
+}
+
+// GetParam returns the declared param with the given name.
+func (meta *Metadata) GetParam(name string) *Param {
+	if meta == nil {
+		return nil
+	}
+	for _, param := range meta.Params {
+		if param.Name == name {
+			return param
+		}
+	}
+	return nil
+}
+
+// DeclaresParams returns true if the template declares its params, which means that other params aren't allowed.
+// Templates without a metadata header (e.g. old user templates) accept any params.
+func (meta *Metadata) DeclaresParams() bool {
+	return meta != nil && meta.declared
+}
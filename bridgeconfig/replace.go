@@ -0,0 +1,141 @@
+package bridgeconfig
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+type valueEdit struct {
+	line, column int
+	oldText      string
+	newText      string
+}
+
+// ReplaceValues replaces all scalar values in a config that are equal to one of the keys in replacements.
+// Unlike ApplyOverlay, the config isn't reformatted: only the replaced values are changed.
+// It returns the new config and the number of values that were replaced.
+func ReplaceValues(config string, replacements map[string]string) (string, int, error) {
+	return ReplaceValuesAt(config, "", replacements)
+}
+
+// ReplaceValuesAt is like ReplaceValues, but only replaces values whose path ends with pathSuffix, so that
+// e.g. provisioning.shared_secret matches both provisioning.shared_secret and bridge.provisioning.shared_secret.
+func ReplaceValuesAt(config, pathSuffix string, replacements map[string]string) (string, int, error) {
+	var root yaml.Node
+	err := yaml.Unmarshal([]byte(config), &root)
+	if err != nil {
+		return "", 0, fmt.Errorf("%w: %w", ErrInvalidYAML, err)
+	}
+	var edits []valueEdit
+	err = collectValueEdits(&root, pathSuffix, replacements, &edits)
+	if err != nil {
+		return "", 0, err
+	} else if len(edits) == 0 {
+		return config, 0, nil
+	}
+	// Apply edits from the end so that earlier columns on the same line stay valid
+	sort.Slice(edits, func(i, j int) bool {
+		if edits[i].line != edits[j].line {
+			return edits[i].line > edits[j].line
+		}
+		return edits[i].column > edits[j].column
+	})
+	lines := strings.Split(config, "\n")
+	for _, edit := range edits {
+		if edit.line < 1 || edit.line > len(lines) {
+			return "", 0, fmt.Errorf("line %d is out of range", edit.line)
+		}
+		line := []rune(lines[edit.line-1])
+		start := edit.column - 1
+		if start < 0 || start > len(line) || !strings.HasPrefix(string(line[start:]), edit.oldText) {
+			return "", 0, fmt.Errorf("line %d: can't replace %s", edit.line, edit.oldText)
+		}
+		lines[edit.line-1] = string(line[:start]) + edit.newText + string(line[start:])[len(edit.oldText):]
+	}
+	return strings.Join(lines, "\n"), len(edits), nil
+}
+
+// walkStrings calls fn for every string value in a config with its path. Mapping keys are skipped.
+func walkStrings(node *yaml.Node, path string, fn func(node *yaml.Node, path string) error) error {
+	switch node.Kind {
+	case yaml.DocumentNode:
+		for _, child := range node.Content {
+			if err := walkStrings(child, path, fn); err != nil {
+				return err
+			}
+		}
+	case yaml.SequenceNode:
+		for i, child := range node.Content {
+			if err := walkStrings(child, joinPath(path, strconv.Itoa(i)), fn); err != nil {
+				return err
+			}
+		}
+	case yaml.MappingNode:
+		for i := 1; i < len(node.Content); i += 2 {
+			if err := walkStrings(node.Content[i], joinPath(path, node.Content[i-1].Value), fn); err != nil {
+				return err
+			}
+		}
+	case yaml.ScalarNode:
+		if node.ShortTag() == "!!str" {
+			return fn(node, path)
+		}
+	}
+	return nil
+}
+
+func pathHasSuffix(path, suffix string) bool {
+	return suffix == "" || path == suffix || strings.HasSuffix(path, "."+suffix)
+}
+
+// FindValuesAt returns the string values in a config whose path ends with pathSuffix.
+func FindValuesAt(config, pathSuffix string) ([]string, error) {
+	var root yaml.Node
+	err := yaml.Unmarshal([]byte(config), &root)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrInvalidYAML, err)
+	}
+	var values []string
+	_ = walkStrings(&root, "", func(node *yaml.Node, path string) error {
+		if pathHasSuffix(path, pathSuffix) {
+			values = append(values, node.Value)
+		}
+		return nil
+	})
+	return values, nil
+}
+
+func collectValueEdits(node *yaml.Node, pathSuffix string, replacements map[string]string, edits *[]valueEdit) error {
+	return walkStrings(node, "", func(node *yaml.Node, path string) error {
+		newValue, ok := replacements[node.Value]
+		if !ok || !pathHasSuffix(path, pathSuffix) {
+			return nil
+		}
+		edit := valueEdit{line: node.Line, column: node.Column}
+		switch node.Style {
+		case 0:
+			edit.oldText = node.Value
+			edit.newText = YAMLString(newValue)
+		case yaml.DoubleQuotedStyle:
+			edit.oldText = `"` + node.Value + `"`
+			edit.newText = YAMLString(newValue)
+			if !strings.HasPrefix(edit.newText, `"`) {
+				edit.newText = `"` + edit.newText + `"`
+			}
+		case yaml.SingleQuotedStyle:
+			edit.oldText = "'" + strings.ReplaceAll(node.Value, "'", "''") + "'"
+			edit.newText = "'" + strings.ReplaceAll(newValue, "'", "''") + "'"
+		default:
+			return fmt.Errorf("line %d: can't replace multi-line value", node.Line)
+		}
+		if strings.Contains(edit.oldText, "\n") {
+			return fmt.Errorf("line %d: can't replace multi-line value", node.Line)
+		}
+		*edits = append(*edits, edit)
+		return nil
+	})
+}
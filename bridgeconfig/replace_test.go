@@ -0,0 +1,138 @@
+package bridgeconfig
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestReplaceValues(t *testing.T) {
+	const oldURL = "https://matrix.example.com/_hungryserv/alice"
+	const newURL = "https://matrix.example.com/_hungryserv/alice2"
+	tests := []struct {
+		name         string
+		config       string
+		replacements map[string]string
+		want         string
+		wantCount    int
+		wantErr      bool
+	}{
+		{
+			name:         "plain value keeps comments",
+			config:       "homeserver:\n    # The address\n    address: " + oldURL + " # inline\n",
+			replacements: map[string]string{oldURL: newURL},
+			want:         "homeserver:\n    # The address\n    address: " + newURL + " # inline\n",
+			wantCount:    1,
+		},
+		{
+			name:         "quoted values",
+			config:       "a: \"" + oldURL + "\"\nb: '" + oldURL + "'\n",
+			replacements: map[string]string{oldURL: newURL},
+			want:         "a: \"" + newURL + "\"\nb: '" + newURL + "'\n",
+			wantCount:    2,
+		},
+		{
+			name:         "plain value that needs quoting",
+			config:       "secret: abc\n",
+			replacements: map[string]string{"abc": "x: y"},
+			want:         "secret: \"x: y\"\n",
+			wantCount:    1,
+		},
+		{
+			name:         "single quote in new value",
+			config:       "secret: 'abc'\n",
+			replacements: map[string]string{"abc": "it's"},
+			want:         "secret: 'it''s'\n",
+			wantCount:    1,
+		},
+		{
+			name:         "keys and non-strings are left alone",
+			config:       "abc: abc\nnum: 123\nlist: [abc, 123]\n",
+			replacements: map[string]string{"abc": "def", "123": "456"},
+			want:         "abc: def\nnum: 123\nlist: [def, 123]\n",
+			wantCount:    2,
+		},
+		{
+			name:         "multiple values on one line",
+			config:       "list: [aa, aa, b]\n",
+			replacements: map[string]string{"aa": "cccc"},
+			want:         "list: [cccc, cccc, b]\n",
+			wantCount:    2,
+		},
+		{
+			name:         "no match",
+			config:       "a: b\n",
+			replacements: map[string]string{"c": "d"},
+			want:         "a: b\n",
+		},
+		{
+			name:         "multi-line value",
+			config:       "a: |\n    abc\n",
+			replacements: map[string]string{"abc\n": "def"},
+			wantErr:      true,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			got, count, err := ReplaceValues(test.config, test.replacements)
+			if test.wantErr {
+				if err == nil {
+					t.Errorf("expected error, got %q", got)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != test.want || count != test.wantCount {
+				t.Errorf("got %d replacements:\n%s\nwant %d replacements:\n%s", count, got, test.wantCount, test.want)
+			}
+		})
+	}
+}
+
+func TestReplaceValues_InvalidYAML(t *testing.T) {
+	_, _, err := ReplaceValues("a: [", map[string]string{"a": "b"})
+	if !errors.Is(err, ErrInvalidYAML) {
+		t.Errorf("expected ErrInvalidYAML, got %v", err)
+	}
+}
+
+func TestReplaceValuesAt(t *testing.T) {
+	const config = `provisioning:
+    shared_secret: token
+bridge:
+    provisioning:
+        shared_secret: token
+appservice:
+    as_token: token
+`
+	got, count, err := ReplaceValuesAt(config, "provisioning.shared_secret", map[string]string{"token": "new"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `provisioning:
+    shared_secret: new
+bridge:
+    provisioning:
+        shared_secret: new
+appservice:
+    as_token: token
+`
+	if got != want || count != 2 {
+		t.Errorf("got %d replacements:\n%s", count, got)
+	}
+
+	values, err := FindValuesAt(config, "provisioning.shared_secret")
+	if err != nil {
+		t.Fatal(err)
+	} else if !reflect.DeepEqual(values, []string{"token", "token"}) {
+		t.Errorf("FindValuesAt returned %v", values)
+	}
+	// Suffixes must match whole keys
+	values, err = FindValuesAt(config, "secret")
+	if err != nil {
+		t.Fatal(err)
+	} else if len(values) != 0 {
+		t.Errorf("FindValuesAt matched a partial key: %v", values)
+	}
+}
@@ -0,0 +1,214 @@
+package bridgeconfig
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Schema maps dot-separated config paths to the type of the value, which is one of string, int, bool, number, map,
+// list or any. Values are required unless the type ends with ?, in which case they may also be missing or null.
+//
+//	schema:
+//	  appservice.as_token: string
+//	  network.api_id: int
+//	  network.proxy: string?
+type Schema map[string]string
+
+var schemaTypes = []string{"string", "int", "bool", "number", "map", "list", "any"}
+
+func (s Schema) validate() error {
+	for path, typ := range s {
+		typ = strings.TrimSuffix(typ, "?")
+		found := false
+		for _, known := range schemaTypes {
+			if typ == known {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return fmt.Errorf("unknown type %q for %s in schema", typ, path)
+		}
+	}
+	return nil
+}
+
+// ValidationError is a problem with a single value in a config.
+type ValidationError struct {
+	Path    string
+	Line    int
+	Message string
+}
+
+func (ve *ValidationError) Error() string {
+	if ve.Line > 0 {
+		return fmt.Sprintf("line %d: %s: %s", ve.Line, ve.Path, ve.Message)
+	}
+	return fmt.Sprintf("%s: %s", ve.Path, ve.Message)
+}
+
+// ValidationErrors contains all problems found in a config.
+type ValidationErrors []*ValidationError
+
+func (ve ValidationErrors) Error() string {
+	messages := make([]string, len(ve))
+	for i, err := range ve {
+		messages[i] = err.Error()
+	}
+	return strings.Join(messages, "\n")
+}
+
+// ErrInvalidYAML is returned by ValidateConfig if the config can't be parsed at all.
+var ErrInvalidYAML = errors.New("invalid YAML")
+
+// ValidateConfig parses a config and checks it against the schema of the bridge type. The returned error is either
+// ErrInvalidYAML (wrapped with the parser error) or ValidationErrors.
+func ValidateConfig(bridgeName, config string) error {
+	var doc yaml.Node
+	err := yaml.Unmarshal([]byte(config), &doc)
+	if err != nil {
+		return fmt.Errorf("%w: %w", ErrInvalidYAML, err)
+	}
+	meta := GetMetadata(bridgeName)
+	if meta == nil || len(meta.Schema) == 0 {
+		return nil
+	}
+	var root *yaml.Node
+	if len(doc.Content) > 0 {
+		root = doc.Content[0]
+	}
+	paths := make([]string, 0, len(meta.Schema))
+	for path := range meta.Schema {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	var errs ValidationErrors
+	for _, path := range paths {
+		if err := checkSchemaValue(root, path, meta.Schema[path]); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		return errs[i].Line < errs[j].Line
+	})
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// lookupNode finds the value at a dot-separated path. It returns the value (or nil if it's missing)
+// and the deepest mapping node that was found, which is used for pointing at the right line.
+func lookupNode(root *yaml.Node, path string) (value, parent *yaml.Node) {
+	node := root
+	for _, key := range strings.Split(path, ".") {
+		if node == nil || node.Kind != yaml.MappingNode {
+			return nil, parent
+		}
+		parent = node
+		var next *yaml.Node
+		for i := 0; i+1 < len(node.Content); i += 2 {
+			if node.Content[i].Value == key {
+				next = node.Content[i+1]
+				break
+			}
+		}
+		node = next
+	}
+	return node, parent
+}
+
+func describeNode(node *yaml.Node) string {
+	switch node.Kind {
+	case yaml.MappingNode:
+		return "map"
+	case yaml.SequenceNode:
+		return "list"
+	case yaml.AliasNode:
+		return "alias"
+	}
+	switch node.ShortTag() {
+	case "!!str":
+		return "string"
+	case "!!int":
+		return "int"
+	case "!!bool":
+		return "bool"
+	case "!!float":
+		return "number"
+	case "!!null":
+		return "null"
+	default:
+		return node.ShortTag()
+	}
+}
+
+func checkSchemaValue(root *yaml.Node, path, typ string) *ValidationError {
+	typ, optional := strings.CutSuffix(typ, "?")
+	node, parent := lookupNode(root, path)
+	if node != nil && node.Kind == yaml.AliasNode {
+		node = node.Alias
+	}
+	if node == nil || (node.Kind == yaml.ScalarNode && node.ShortTag() == "!!null") {
+		if optional {
+			return nil
+		}
+		err := &ValidationError{Path: path, Message: "required value is missing"}
+		if node != nil {
+			err.Line = node.Line
+		} else if parent != nil && parent != root {
+			err.Line = parent.Line
+		}
+		return err
+	}
+	var ok bool
+	switch typ {
+	case "any":
+		ok = true
+	case "map":
+		ok = node.Kind == yaml.MappingNode
+	case "list":
+		ok = node.Kind == yaml.SequenceNode
+	case "string":
+		// YAML parsers decode any scalar into string fields
+		ok = node.Kind == yaml.ScalarNode
+	case "int":
+		ok = node.Kind == yaml.ScalarNode && node.ShortTag() == "!!int"
+	case "bool":
+		ok = node.Kind == yaml.ScalarNode && node.ShortTag() == "!!bool"
+	case "number":
+		ok = node.Kind == yaml.ScalarNode && (node.ShortTag() == "!!int" || node.ShortTag() == "!!float")
+	}
+	if ok {
+		return nil
+	}
+	return &ValidationError{Path: path, Line: node.Line, Message: fmt.Sprintf("expected %s, got %s", typ, describeNode(node))}
+}
+
+// YAMLString formats a string as a YAML scalar. Values that would be parsed as something else than the same string
+// (e.g. because they contain a colon followed by a space, a comment or a newline) are quoted. Empty strings are
+// returned as-is, so that they're parsed as null.
+func YAMLString(value string) string {
+	if value == "" {
+		return ""
+	}
+	var node yaml.Node
+	err := yaml.Unmarshal([]byte("v: "+value), &node)
+	if err == nil && len(node.Content) == 1 && len(node.Content[0].Content) == 2 {
+		scalar := node.Content[0].Content[1]
+		if scalar.Kind == yaml.ScalarNode && scalar.Style == 0 && scalar.ShortTag() == "!!str" && scalar.Value == value {
+			return value
+		}
+	}
+	// JSON strings are valid double-quoted YAML scalars
+	var quoted strings.Builder
+	enc := json.NewEncoder(&quoted)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(value)
+	return strings.TrimSuffix(quoted.String(), "\n")
+}
@@ -0,0 +1,157 @@
+package bridgeconfig
+
+import (
+	"errors"
+	"testing"
+
+	"gopkg.in/yaml.v3"
+)
+
+// useTestSchema registers a bridge type with the given schema for the duration of a test.
+func useTestSchema(t *testing.T, schema Schema) string {
+	t.Helper()
+	const name = "schematest"
+	metadata[templateName(name)] = &Metadata{Schema: schema}
+	t.Cleanup(func() {
+		delete(metadata, templateName(name))
+	})
+	return name
+}
+
+func TestValidateConfig(t *testing.T) {
+	bridge := useTestSchema(t, Schema{
+		"homeserver.address":  "string",
+		"appservice.port":     "int",
+		"bridge.permissions":  "map",
+		"bridge.relay":        "bool?",
+		"logging.writers":     "list",
+		"network.timeout":     "number",
+		"network.anything":    "any",
+		"network.displayname": "string?",
+	})
+	const valid = `homeserver:
+    address: https://example.com
+appservice:
+    port: 29318
+bridge:
+    permissions:
+        '*': relay
+logging:
+    writers: []
+network:
+    timeout: 1.5
+    anything: [1, 2]
+`
+	tests := []struct {
+		name      string
+		config    string
+		wantPaths []string
+		wantLines []int
+	}{
+		{"valid", valid, nil, nil},
+		{
+			name: "wrong types",
+			config: `homeserver:
+    address: https://example.com
+appservice:
+    port: "29318"
+bridge:
+    permissions: []
+    relay: yes please
+logging:
+    writers: {}
+network:
+    timeout: soon
+    anything: null
+`,
+			wantPaths: []string{"appservice.port", "bridge.permissions", "bridge.relay", "logging.writers", "network.timeout", "network.anything"},
+			wantLines: []int{4, 6, 7, 9, 11, 12},
+		},
+		{
+			name: "missing values",
+			config: `homeserver: {}
+appservice:
+    port: 29318
+bridge:
+    permissions: {}
+network:
+    timeout: 1
+    anything: x
+`,
+			// Errors without a line come first
+			wantPaths: []string{"logging.writers", "homeserver.address"},
+			wantLines: []int{0, 1},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateConfig(bridge, test.config)
+			if test.wantPaths == nil {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			var errs ValidationErrors
+			if !errors.As(err, &errs) {
+				t.Fatalf("expected ValidationErrors, got %v", err)
+			} else if len(errs) != len(test.wantPaths) {
+				t.Fatalf("expected %d errors, got %d:\n%v", len(test.wantPaths), len(errs), err)
+			}
+			for i, verr := range errs {
+				if verr.Path != test.wantPaths[i] || verr.Line != test.wantLines[i] {
+					t.Errorf("error %d: got %s at line %d, want %s at line %d", i, verr.Path, verr.Line, test.wantPaths[i], test.wantLines[i])
+				}
+			}
+		})
+	}
+}
+
+func TestValidateConfig_InvalidYAML(t *testing.T) {
+	bridge := useTestSchema(t, Schema{"homeserver.address": "string"})
+	err := ValidateConfig(bridge, "homeserver: [")
+	if !errors.Is(err, ErrInvalidYAML) {
+		t.Errorf("expected ErrInvalidYAML, got %v", err)
+	}
+	if err = ValidateConfig("no-such-bridge", "anything: goes"); err != nil {
+		t.Errorf("expected no error for bridge without schema, got %v", err)
+	}
+}
+
+func TestYAMLString(t *testing.T) {
+	tests := []struct {
+		input string
+		want  string
+	}{
+		{"", ""},
+		{"plain", "plain"},
+		{"https://example.com/path", "https://example.com/path"},
+		{"with space", "with space"},
+		{"key: value", `"key: value"`},
+		{"value # comment", `"value # comment"`},
+		{"true", `"true"`},
+		{"123", `"123"`},
+		{"null", `"null"`},
+		{"*alias", `"*alias"`},
+		{"!tag", `"!tag"`},
+		{"'quoted'", `"'quoted'"`},
+		{"multi\nline", `"multi\nline"`},
+		{"<html> & stuff", "<html> & stuff"},
+	}
+	for _, test := range tests {
+		got := YAMLString(test.input)
+		if got != test.want {
+			t.Errorf("YAMLString(%q) = %s, want %s", test.input, got, test.want)
+		}
+		if test.input == "" {
+			continue
+		}
+		// The output must always be parsed back into the same string
+		var parsed map[string]string
+		if err := yaml.Unmarshal([]byte("v: "+got), &parsed); err != nil {
+			t.Errorf("YAMLString(%q) = %s isn't valid YAML: %v", test.input, got, err)
+		} else if parsed["v"] != test.input {
+			t.Errorf("YAMLString(%q) = %s is parsed as %q", test.input, got, parsed["v"])
+		}
+	}
+}
@@ -0,0 +1,101 @@
+package bridgeconfig
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"slices"
+	"strings"
+)
+
+// Redacted is shown instead of secret values when printing configs.
+const Redacted = "<redacted>"
+
+// Prefixes of param values that reference a secret instead of containing it directly.
+const (
+	SecretRefEnv  = "env:"
+	SecretRefFile = "file:"
+	SecretRefCmd  = "cmd:"
+)
+
+// IsSecretRef returns true if the value references a secret that must be resolved with ResolveSecretRef.
+func IsSecretRef(value string) bool {
+	return strings.HasPrefix(value, SecretRefEnv) || strings.HasPrefix(value, SecretRefFile) || strings.HasPrefix(value, SecretRefCmd)
+}
+
+// ResolveSecretRef returns the value of a secret reference:
+//
+//   - env:NAME reads an environment variable
+//   - file:/path/to/file reads a file
+//   - cmd:command runs a shell command and uses its output
+//
+// Trailing newlines are removed from files and command output. Values that aren't references are returned as-is.
+func ResolveSecretRef(value string) (string, error) {
+	switch {
+	case strings.HasPrefix(value, SecretRefEnv):
+		name := strings.TrimPrefix(value, SecretRefEnv)
+		resolved, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s is not set", name)
+		}
+		return resolved, nil
+	case strings.HasPrefix(value, SecretRefFile):
+		data, err := os.ReadFile(strings.TrimPrefix(value, SecretRefFile))
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case strings.HasPrefix(value, SecretRefCmd):
+		cmd := exec.Command("sh", "-c", strings.TrimPrefix(value, SecretRefCmd))
+		cmd.Stdin = os.Stdin
+		cmd.Stderr = os.Stderr
+		output, err := cmd.Output()
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return "", fmt.Errorf("command exited with code %d", exitErr.ExitCode())
+		} else if err != nil {
+			return "", err
+		}
+		return strings.TrimRight(string(output), "\r\n"), nil
+	default:
+		return value, nil
+	}
+}
+
+// Redactor replaces secret values in configs and diffs.
+type Redactor struct {
+	secrets  []string
+	replacer *strings.Replacer
+}
+
+func NewRedactor(secrets []string) *Redactor {
+	secrets = slices.Clone(secrets)
+	// Replace longer secrets first in case one secret contains another
+	slices.SortFunc(secrets, func(a, b string) int {
+		return len(b) - len(a)
+	})
+	replacements := make([]string, 0, len(secrets)*2)
+	for _, secret := range secrets {
+		replacements = append(replacements, secret, Redacted)
+	}
+	return &Redactor{secrets: secrets, replacer: strings.NewReplacer(replacements...)}
+}
+
+// Contains returns true if the string contains any secret.
+func (r *Redactor) Contains(s string) bool {
+	for _, secret := range r.secrets {
+		if strings.Contains(s, secret) {
+			return true
+		}
+	}
+	return false
+}
+
+// Redact replaces all secrets in the string.
+func (r *Redactor) Redact(s string) string {
+	if len(r.secrets) == 0 {
+		return s
+	}
+	return r.replacer.Replace(s)
+}
@@ -0,0 +1,95 @@
+package bridgeconfig
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestResolveSecretRef(t *testing.T) {
+	t.Setenv("BBCTL_TEST_SECRET", "from-env")
+	t.Setenv("BBCTL_TEST_EMPTY", "")
+	dir := t.TempDir()
+	secretFile := filepath.Join(dir, "secret")
+	err := os.WriteFile(secretFile, []byte("from-file\r\n\n"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		value   string
+		want    string
+		wantErr string
+	}{
+		{"plain value", "plain value", ""},
+		{"environment:BBCTL_TEST_SECRET", "environment:BBCTL_TEST_SECRET", ""},
+		{"env:BBCTL_TEST_SECRET", "from-env", ""},
+		{"env:BBCTL_TEST_EMPTY", "", ""},
+		{"env:BBCTL_TEST_MISSING", "", "BBCTL_TEST_MISSING is not set"},
+		{"file:" + secretFile, "from-file", ""},
+		{"file:" + filepath.Join(dir, "missing"), "", "no such file"},
+		{"cmd:echo from-cmd", "from-cmd", ""},
+		{"cmd:printf 'a\\nb\\n'", "a\nb", ""},
+		{"cmd:exit 3", "", "exited with code 3"},
+	}
+	for _, test := range tests {
+		got, err := ResolveSecretRef(test.value)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("ResolveSecretRef(%q) error = %v, want error containing %q", test.value, err, test.wantErr)
+			}
+		} else if err != nil {
+			t.Errorf("ResolveSecretRef(%q) failed: %v", test.value, err)
+		} else if got != test.want {
+			t.Errorf("ResolveSecretRef(%q) = %q, want %q", test.value, got, test.want)
+		}
+		if IsSecretRef(test.value) == (test.value == "plain value" || strings.HasPrefix(test.value, "environment:")) {
+			t.Errorf("IsSecretRef(%q) = %t", test.value, IsSecretRef(test.value))
+		}
+	}
+}
+
+func TestParam_IsSecretRef(t *testing.T) {
+	secret := &Param{Name: "token", Secret: true}
+	plain := &Param{Name: "displayname"}
+	tests := []struct {
+		param *Param
+		value string
+		want  bool
+	}{
+		{secret, "env:TOKEN", true},
+		{secret, "cmd:pass show token", true},
+		{secret, "literal", false},
+		{plain, "env:TOKEN", false},
+		{plain, "file:name", false},
+		{nil, "env:TOKEN", false},
+	}
+	for _, test := range tests {
+		if got := test.param.IsSecretRef(test.value); got != test.want {
+			t.Errorf("%+v.IsSecretRef(%q) = %t, want %t", test.param, test.value, got, test.want)
+		}
+	}
+}
+
+func TestRedactor(t *testing.T) {
+	redactor := NewRedactor([]string{"secret", "longer-secret"})
+	tests := []struct {
+		input        string
+		want         string
+		wantContains bool
+	}{
+		{"nothing to hide", "nothing to hide", false},
+		{"token: secret", "token: " + Redacted, true},
+		{"token: longer-secret", "token: " + Redacted, true},
+		{"secret and secret", Redacted + " and " + Redacted, true},
+	}
+	for _, test := range tests {
+		if got := redactor.Redact(test.input); got != test.want {
+			t.Errorf("Redact(%q) = %q, want %q", test.input, got, test.want)
+		}
+		if got := redactor.Contains(test.input); got != test.wantContains {
+			t.Errorf("Contains(%q) = %t, want %t", test.input, got, test.wantContains)
+		}
+	}
+}
@@ -0,0 +1,237 @@
+package bridgeconfig
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"text/template"
+	"text/template/parse"
+)
+
+type TemplateOrigin string
+
+const (
+	OriginEmbedded TemplateOrigin = "embedded"
+	OriginUser     TemplateOrigin = "user"
+)
+
+const (
+	bridgeTemplateSuffix  = ".tpl.yaml"
+	partialTemplateSuffix = ".partial.yaml"
+)
+
+// TemplateInfo describes a loaded template file.
+//
+// Bridge templates (<type>.tpl.yaml) define the bridge types that configs can be generated for.
+// Partial templates (<name>.partial.yaml) don't define bridge types, but can be included in other templates
+// with {{ template "<name>.partial.yaml" . }}. Any template can also define named templates with {{ define }}.
+type TemplateInfo struct {
+	Name     string
+	FileName string
+	Origin   TemplateOrigin
+	// The path of the file for user templates.
+	Path string
+	// Whether this user template replaces an embedded template with the same name.
+	Overrides bool
+	Partial   bool
+	Content   string
+}
+
+var templates map[string]*TemplateInfo
+
+// UserTemplateDir is the directory user templates were loaded from, if any.
+var UserTemplateDir string
+
+func templateName(bridgeName string) string {
+	return bridgeName + bridgeTemplateSuffix
+}
+
+func parseTemplateFileName(fileName string) (name string, partial, ok bool) {
+	if name, ok = strings.CutSuffix(fileName, bridgeTemplateSuffix); ok {
+		return name, false, true
+	} else if name, ok = strings.CutSuffix(fileName, partialTemplateSuffix); ok {
+		return name, true, true
+	}
+	return "", false, false
+}
+
+func addTemplate(set *template.Template, infos map[string]*TemplateInfo, info *TemplateInfo) error {
+	_, err := set.New(info.FileName).Parse(info.Content)
+	if err != nil {
+		return err
+	}
+	if existing, ok := infos[info.FileName]; ok && existing.Origin == OriginEmbedded {
+		info.Overrides = true
+	}
+	infos[info.FileName] = info
+	return nil
+}
+
+// loadTemplates parses the embedded templates and the templates in the given user directory.
+// The global state is only replaced if all templates are parsed successfully.
+func loadTemplates(userDir string) error {
+	set := template.New("configs").Funcs(tplFuncs)
+	infos := make(map[string]*TemplateInfo)
+	entries, err := fs.ReadDir(configs, ".")
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		name, partial, ok := parseTemplateFileName(entry.Name())
+		if !ok {
+			continue
+		}
+		data, err := configs.ReadFile(entry.Name())
+		if err != nil {
+			return err
+		}
+		err = addTemplate(set, infos, &TemplateInfo{
+			Name:     name,
+			FileName: entry.Name(),
+			Origin:   OriginEmbedded,
+			Partial:  partial,
+			Content:  string(data),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to parse embedded template %s: %w", entry.Name(), err)
+		}
+	}
+	if userDir != "" {
+		entries, err = os.ReadDir(userDir)
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("failed to read template directory: %w", err)
+		}
+		for _, entry := range entries {
+			name, partial, ok := parseTemplateFileName(entry.Name())
+			if !ok || entry.IsDir() {
+				continue
+			}
+			path := filepath.Join(userDir, entry.Name())
+			data, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("failed to read %s: %w", path, err)
+			}
+			err = addTemplate(set, infos, &TemplateInfo{
+				Name:     name,
+				FileName: entry.Name(),
+				Origin:   OriginUser,
+				Path:     path,
+				Partial:  partial,
+				Content:  string(data),
+			})
+			if err != nil {
+				return fmt.Errorf("failed to parse %s: %w", path, err)
+			}
+		}
+	}
+	newMetadata, err := loadMetadata(infos)
+	if err != nil {
+		return err
+	}
+	var supported []string
+	for _, info := range infos {
+		if !info.Partial {
+			supported = append(supported, info.Name)
+		}
+	}
+	sort.Strings(supported)
+	tpl = set
+	templates = infos
+	metadata = newMetadata
+	SupportedBridges = supported
+	UserTemplateDir = userDir
+	return nil
+}
+
+// LoadUserTemplates loads templates from the given directory in addition to the embedded templates.
+// User templates replace embedded templates with the same file name. The directory doesn't have to exist.
+func LoadUserTemplates(dir string) error {
+	return loadTemplates(dir)
+}
+
+// ListTemplates returns all loaded templates sorted by file name.
+func ListTemplates() []*TemplateInfo {
+	list := make([]*TemplateInfo, 0, len(templates))
+	for _, info := range templates {
+		list = append(list, info)
+	}
+	sort.Slice(list, func(i, j int) bool {
+		return list[i].FileName < list[j].FileName
+	})
+	return list
+}
+
+// GetTemplate returns a loaded template by bridge type or file name.
+func GetTemplate(name string) *TemplateInfo {
+	if info, ok := templates[name]; ok {
+		return info
+	}
+	return templates[templateName(name)]
+}
+
+// GetEmbeddedTemplate returns the content of an embedded template by bridge type or file name,
+// even if it has been overridden by a user template.
+func GetEmbeddedTemplate(name string) (string, bool) {
+	if _, _, ok := parseTemplateFileName(name); !ok {
+		name = templateName(name)
+	}
+	data, err := configs.ReadFile(name)
+	if err != nil {
+		return "", false
+	}
+	return string(data), true
+}
+
+// TemplateHash returns a SHA-256 hash of the config template of a bridge type and the templates it includes,
+// which identifies the template version a config was generated with.
+func TemplateHash(bridgeName string) string {
+	hash := sha256.New()
+	seen := make(map[string]bool)
+	var walk func(node parse.Node)
+	addTemplate := func(name string) {
+		if seen[name] {
+			return
+		}
+		seen[name] = true
+		t := tpl.Lookup(name)
+		if info, ok := templates[name]; ok {
+			hash.Write([]byte(info.Content))
+		} else if t != nil && t.Tree != nil {
+			// Templates created with {{ define }} inside another file
+			hash.Write([]byte(t.Tree.Root.String()))
+		}
+		if t != nil && t.Tree != nil {
+			walk(t.Tree.Root)
+		}
+	}
+	walk = func(node parse.Node) {
+		switch typedNode := node.(type) {
+		case *parse.ListNode:
+			if typedNode == nil {
+				return
+			}
+			for _, child := range typedNode.Nodes {
+				walk(child)
+			}
+		case *parse.IfNode:
+			walk(typedNode.List)
+			walk(typedNode.ElseList)
+		case *parse.RangeNode:
+			walk(typedNode.List)
+			walk(typedNode.ElseList)
+		case *parse.WithNode:
+			walk(typedNode.List)
+			walk(typedNode.ElseList)
+		case *parse.TemplateNode:
+			addTemplate(typedNode.Name)
+		}
+	}
+	addTemplate(templateName(bridgeName))
+	return hex.EncodeToString(hash.Sum(nil))
+}
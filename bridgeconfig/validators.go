@@ -0,0 +1,207 @@
+package bridgeconfig
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ParamValidator checks a param value more thoroughly than its type, e.g. by connecting to the service it points at.
+// The other params are passed for validators that need them (e.g. the BlueBubbles password is checked against the URL).
+type ParamValidator func(ctx context.Context, value string, params map[string]string) error
+
+// ValidatorTimeout is the maximum time validators that make network requests can take.
+var ValidatorTimeout = 10 * time.Second
+
+// ValidatorHTTPClient is used by validators that make HTTP requests.
+var ValidatorHTTPClient = &http.Client{Timeout: ValidatorTimeout}
+
+var paramValidators = map[string]ParamValidator{
+	"url":                  ValidateURL,
+	"executable":           ValidateExecutable,
+	"proxy":                ValidateProxy,
+	"bluebubbles_password": ValidateBlueBubblesPassword,
+	"telegram_api_id":      ValidateTelegramAPIID,
+	"telegram_api_hash":    ValidateTelegramAPIHash,
+}
+
+// RegisterParamValidator adds a validator that templates can refer to with `validator: <name>` in param declarations.
+func RegisterParamValidator(name string, validator ParamValidator) {
+	paramValidators[name] = validator
+}
+
+// ValidateURL checks that the value is an absolute http(s) URL.
+func ValidateURL(_ context.Context, value string, _ map[string]string) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return err
+	} else if parsed.Scheme != "http" && parsed.Scheme != "https" {
+		return fmt.Errorf("URL must start with http:// or https://")
+	} else if parsed.Host == "" {
+		return fmt.Errorf("URL doesn't have a host")
+	}
+	return nil
+}
+
+type bridgeDirContextKey struct{}
+
+// WithBridgeDir returns a context that tells validators which directory the bridge runs in.
+func WithBridgeDir(ctx context.Context, dir string) context.Context {
+	return context.WithValue(ctx, bridgeDirContextKey{}, dir)
+}
+
+// ValidateExecutable checks that the value is an executable file, or the name of an executable in $PATH.
+// Relative paths are resolved against the bridge directory (see WithBridgeDir), like the bridge itself does.
+func ValidateExecutable(ctx context.Context, value string, _ map[string]string) error {
+	if !filepath.IsAbs(value) && strings.ContainsRune(value, filepath.Separator) {
+		bridgeDir, ok := ctx.Value(bridgeDirContextKey{}).(string)
+		if !ok {
+			return nil
+		}
+		value = filepath.Join(bridgeDir, value)
+	}
+	_, err := exec.LookPath(value)
+	if errors.Is(err, exec.ErrNotFound) {
+		return fmt.Errorf("%s not found in $PATH", value)
+	} else if errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%s doesn't exist", value)
+	} else if errors.Is(err, os.ErrPermission) {
+		return fmt.Errorf("%s is not executable", value)
+	} else if err != nil {
+		return err
+	}
+	return nil
+}
+
+// ValidateProxy checks that a proxy URL is valid and that the proxy accepts connections.
+// For SOCKS5 proxies, the handshake is done to make sure the server actually speaks SOCKS.
+func ValidateProxy(ctx context.Context, value string, _ map[string]string) error {
+	parsed, err := url.Parse(value)
+	if err != nil {
+		return err
+	}
+	var defaultPort string
+	switch parsed.Scheme {
+	case "socks5", "socks5h":
+		defaultPort = "1080"
+	case "http":
+		defaultPort = "80"
+	case "https":
+		defaultPort = "443"
+	default:
+		return fmt.Errorf("unsupported proxy scheme %q (expected socks5, socks5h, http or https)", parsed.Scheme)
+	}
+	if parsed.Hostname() == "" {
+		return fmt.Errorf("proxy URL doesn't have a host")
+	}
+	port := parsed.Port()
+	if port == "" {
+		port = defaultPort
+	}
+	ctx, cancel := context.WithTimeout(ctx, ValidatorTimeout)
+	defer cancel()
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", net.JoinHostPort(parsed.Hostname(), port))
+	if err != nil {
+		return fmt.Errorf("failed to connect to proxy: %w", err)
+	}
+	defer conn.Close()
+	if !strings.HasPrefix(parsed.Scheme, "socks5") {
+		return nil
+	}
+	if deadline, ok := ctx.Deadline(); ok {
+		_ = conn.SetDeadline(deadline)
+	}
+	return socks5Handshake(conn, parsed.User != nil)
+}
+
+const (
+	socks5Version      = 0x05
+	socks5AuthNone     = 0x00
+	socks5AuthPassword = 0x02
+	socks5NoAcceptable = 0xff
+)
+
+// socks5Handshake sends the SOCKS5 greeting and checks that the server accepts one of the offered auth methods.
+func socks5Handshake(conn net.Conn, withPassword bool) error {
+	greeting := []byte{socks5Version, 1, socks5AuthNone}
+	if withPassword {
+		greeting = []byte{socks5Version, 2, socks5AuthNone, socks5AuthPassword}
+	}
+	_, err := conn.Write(greeting)
+	if err != nil {
+		return fmt.Errorf("failed to send SOCKS5 greeting: %w", err)
+	}
+	resp := make([]byte, 2)
+	_, err = io.ReadFull(conn, resp)
+	if err != nil {
+		return fmt.Errorf("failed to read SOCKS5 greeting response: %w", err)
+	} else if resp[0] != socks5Version {
+		return fmt.Errorf("proxy didn't respond with SOCKS5 (got version %d)", resp[0])
+	} else if resp[1] == socks5NoAcceptable {
+		return fmt.Errorf("proxy requires an unsupported authentication method")
+	}
+	return nil
+}
+
+// ValidateBlueBubblesPassword checks the password by pinging the BlueBubbles API at the bluebubbles_url param.
+func ValidateBlueBubblesPassword(ctx context.Context, value string, params map[string]string) error {
+	baseURL := params["bluebubbles_url"]
+	if err := ValidateURL(ctx, baseURL, nil); err != nil {
+		return fmt.Errorf("invalid BlueBubbles URL: %w", err)
+	}
+	pingURL, err := url.JoinPath(baseURL, "api/v1/ping")
+	if err != nil {
+		return fmt.Errorf("invalid BlueBubbles URL: %w", err)
+	}
+	pingURL += "?" + url.Values{"password": {value}}.Encode()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pingURL, nil)
+	if err != nil {
+		return err
+	}
+	resp, err := ValidatorHTTPClient.Do(req)
+	if err != nil {
+		var urlErr *url.Error
+		if errors.As(err, &urlErr) {
+			// Don't include the URL, it contains the password
+			err = urlErr.Err
+		}
+		return fmt.Errorf("failed to connect to BlueBubbles: %w", err)
+	}
+	defer resp.Body.Close()
+	switch {
+	case resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("BlueBubbles rejected the password")
+	case resp.StatusCode >= 300:
+		return fmt.Errorf("unexpected status %s from BlueBubbles", resp.Status)
+	}
+	return nil
+}
+
+// ValidateTelegramAPIID checks that the value looks like an API ID from my.telegram.org.
+func ValidateTelegramAPIID(_ context.Context, value string, _ map[string]string) error {
+	id, err := strconv.Atoi(value)
+	if err != nil || id <= 0 {
+		return fmt.Errorf("API ID must be a positive number")
+	}
+	return nil
+}
+
+// ValidateTelegramAPIHash checks that the value looks like an API hash from my.telegram.org.
+func ValidateTelegramAPIHash(_ context.Context, value string, _ map[string]string) error {
+	if _, err := hex.DecodeString(value); err != nil || len(value) != 32 {
+		return fmt.Errorf("API hash must be 32 hexadecimal characters")
+	}
+	return nil
+}
@@ -0,0 +1,191 @@
+package bridgeconfig
+
+import (
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// startFakeSOCKS5 starts a listener that answers the SOCKS5 greeting with the given auth method.
+func startFakeSOCKS5(t *testing.T, method byte) string {
+	t.Helper()
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { _ = listener.Close() })
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go func() {
+				defer conn.Close()
+				header := make([]byte, 2)
+				if _, err := io.ReadFull(conn, header); err != nil {
+					return
+				}
+				methods := make([]byte, header[1])
+				if _, err := io.ReadFull(conn, methods); err != nil {
+					return
+				}
+				_, _ = conn.Write([]byte{socks5Version, method})
+			}()
+		}
+	}()
+	return listener.Addr().String()
+}
+
+func TestValidateProxy(t *testing.T) {
+	accepting := startFakeSOCKS5(t, socks5AuthNone)
+	rejecting := startFakeSOCKS5(t, socks5NoAcceptable)
+	closed, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	closedAddr := closed.Addr().String()
+	_ = closed.Close()
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr string
+	}{
+		{"socks5 accepted", "socks5://" + accepting, ""},
+		{"socks5h with password", "socks5h://user:pass@" + accepting, ""},
+		{"socks5 rejected", "socks5://" + rejecting, "unsupported authentication method"},
+		{"http only connects", "http://" + rejecting, ""},
+		{"connection refused", "socks5://" + closedAddr, "failed to connect to proxy"},
+		{"unsupported scheme", "ftp://" + accepting, "unsupported proxy scheme"},
+		{"no host", "socks5://", "doesn't have a host"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateProxy(context.Background(), test.value, nil)
+			checkValidatorError(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestValidateBlueBubblesPassword(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v1/ping" {
+			w.WriteHeader(http.StatusNotFound)
+		} else if r.URL.Query().Get("password") != "correct" {
+			w.WriteHeader(http.StatusUnauthorized)
+		} else {
+			_, _ = w.Write([]byte(`{"status":200,"message":"Ping received!"}`))
+		}
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name     string
+		password string
+		url      string
+		wantErr  string
+	}{
+		{"correct password", "correct", server.URL, ""},
+		{"trailing slash", "correct", server.URL + "/", ""},
+		{"wrong password", "wrong", server.URL, "rejected the password"},
+		{"wrong path", "correct", server.URL + "/prefix", "unexpected status"},
+		{"missing URL", "correct", "", "invalid BlueBubbles URL"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			err := ValidateBlueBubblesPassword(context.Background(), test.password, map[string]string{"bluebubbles_url": test.url})
+			checkValidatorError(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestValidateTelegramAPIID(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{"12345", false},
+		{"1", false},
+		{"0", true},
+		{"-5", true},
+		{"12a45", true},
+		{"", true},
+	}
+	for _, test := range tests {
+		err := ValidateTelegramAPIID(context.Background(), test.value, nil)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ValidateTelegramAPIID(%q) = %v, want error: %t", test.value, err, test.wantErr)
+		}
+	}
+}
+
+func TestValidateTelegramAPIHash(t *testing.T) {
+	tests := []struct {
+		value   string
+		wantErr bool
+	}{
+		{"0123456789abcdef0123456789abcdef", false},
+		{"0123456789ABCDEF0123456789ABCDEF", false},
+		{"0123456789abcdef0123456789abcde", true},
+		{"0123456789abcdef0123456789abcdef00", true},
+		{"0123456789abcdef0123456789abcdeg", true},
+		{"", true},
+	}
+	for _, test := range tests {
+		err := ValidateTelegramAPIHash(context.Background(), test.value, nil)
+		if (err != nil) != test.wantErr {
+			t.Errorf("ValidateTelegramAPIHash(%q) = %v, want error: %t", test.value, err, test.wantErr)
+		}
+	}
+}
+
+func TestValidateExecutable(t *testing.T) {
+	bridgeDir := t.TempDir()
+	err := os.MkdirAll(filepath.Join(bridgeDir, "bin"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(bridgeDir, "bin", "helper"), []byte("#!/bin/sh\n"), 0700)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.WriteFile(filepath.Join(bridgeDir, "bin", "data"), []byte("data"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx := WithBridgeDir(context.Background(), bridgeDir)
+
+	tests := []struct {
+		name    string
+		value   string
+		wantErr string
+	}{
+		{"relative path", "./bin/helper", ""},
+		{"relative path without dot", "bin/helper", ""},
+		{"absolute path", filepath.Join(bridgeDir, "bin", "helper"), ""},
+		{"missing relative path", "./bin/missing", "doesn't exist"},
+		{"not executable", "./bin/data", "not executable"},
+		{"not in path", "bbctl-test-missing-executable", "not found in $PATH"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			checkValidatorError(t, ValidateExecutable(ctx, test.value, nil), test.wantErr)
+		})
+	}
+}
+
+func checkValidatorError(t *testing.T, err error, wantErr string) {
+	t.Helper()
+	if wantErr == "" && err != nil {
+		t.Errorf("unexpected error: %v", err)
+	} else if wantErr != "" && (err == nil || !strings.Contains(err.Error(), wantErr)) {
+		t.Errorf("expected error containing %q, got %v", wantErr, err)
+	}
+}
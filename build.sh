@@ -1,2 +1,2 @@
 #!/bin/sh
-go build -ldflags "-X main.Tag=$(git describe --exact-match --tags 2>/dev/null) -X main.Commit=$(git rev-parse HEAD) -X 'main.BuildTime=`date -Iseconds`'" "$@" github.com/beeper/bridge-manager/cmd/bbctl
+go build -ldflags "-X main.Tag=$(git describe --exact-match --tags 2>/dev/null) -X main.Commit=$(git rev-parse HEAD) -X 'main.BuildTime=`date -Iseconds`' -X main.PackageManager=$BBCTL_PACKAGE_MANAGER" "$@" github.com/beeper/bridge-manager/cmd/bbctl
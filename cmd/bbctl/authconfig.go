@@ -24,18 +24,70 @@ var envs = map[string]string{
 }
 
 type EnvConfig struct {
-	ClusterID      string `json:"cluster_id"`
-	Username       string `json:"username"`
-	AccessToken    string `json:"access_token"`
-	BridgeDataDir  string `json:"bridge_data_dir"`
-	DatabaseDir    string `json:"database_dir,omitempty"`
-	DesktopDataDir string `json:"desktop_data_dir,omitempty"`
+	ClusterID      string            `json:"cluster_id"`
+	HungryURL      string            `json:"hungry_url,omitempty"`
+	Username       string            `json:"username"`
+	AccessToken    string            `json:"access_token"`
+	BridgeDataDir  string            `json:"bridge_data_dir"`
+	DatabaseDir    string            `json:"database_dir,omitempty"`
+	DatabaseURI    string            `json:"database_uri,omitempty"`
+	DesktopDataDir string            `json:"desktop_data_dir,omitempty"`
+	ArtifactSource string            `json:"artifact_source,omitempty"`
+	Bridges        BridgeSettingsMap `json:"bridges,omitempty"`
+
+	// If set, bridges in this env connect to a standard Matrix homeserver instead of Beeper.
+	Standalone *StandaloneConfig `json:"standalone,omitempty"`
+}
+
+// StandaloneConfig contains the details of a non-Beeper homeserver that bridges are registered to locally.
+type StandaloneConfig struct {
+	HomeserverURL string    `json:"homeserver_url"`
+	Domain        string    `json:"domain"`
+	AdminUserID   id.UserID `json:"admin_user_id"`
+	// The address bridges listen on for requests from the homeserver.
+	BridgeHost string `json:"bridge_host,omitempty"`
+}
+
+// BridgeSettings contains locally persisted settings for a single self-hosted bridge.
+type BridgeSettings struct {
+	Type    string `json:"type,omitempty"`
+	Channel string `json:"channel,omitempty"`
+
+	PythonPin      string `json:"python_pin,omitempty"`
+	PythonLockFile string `json:"python_lock_file,omitempty"`
+
+	// PostgreSQL URI template for the bridge database, overrides the env setting
+	DatabaseURI string `json:"database_uri,omitempty"`
+
+	// Params are the bridge-specific config generation options that were previously specified or asked.
+	// Secret params are stored in the credential store, so only their names are listed here.
+	Params       map[string]string `json:"params,omitempty"`
+	SecretParams []string          `json:"secret_params,omitempty"`
+	// Names of the secrets generated by bbctl (e.g. the provisioning secret), which are stored in the credential store.
+	Secrets []string `json:"secrets,omitempty"`
+	// The credential store that the secret params and secrets are stored in.
+	CredentialStore string `json:"credential_store,omitempty"`
+}
+
+type BridgeSettingsMap map[string]*BridgeSettings
+
+func (bsm BridgeSettingsMap) Get(bridge string) *BridgeSettings {
+	settings, ok := bsm[bridge]
+	if !ok || settings == nil {
+		settings = &BridgeSettings{}
+		bsm[bridge] = settings
+	}
+	return settings
 }
 
 func (ec *EnvConfig) HasCredentials() bool {
 	return strings.HasPrefix(ec.AccessToken, "syt_") || strings.HasPrefix(ec.AccessToken, "bat_")
 }
 
+func (ec *EnvConfig) IsStandalone() bool {
+	return ec.Standalone != nil
+}
+
 func (ec *EnvConfig) UsesDesktopLogin() bool {
 	return ec.DesktopDataDir != ""
 }
@@ -45,7 +97,10 @@ type EnvConfigs map[string]*EnvConfig
 func (ec EnvConfigs) Get(env string) *EnvConfig {
 	conf, ok := ec[env]
 	if !ok {
-		conf = &EnvConfig{}
+		conf = &EnvConfig{
+			BridgeDataDir: filepath.Join(UserDataDir, "bbctl", env),
+			Bridges:       make(BridgeSettingsMap),
+		}
 		ec[env] = conf
 	}
 	return conf
@@ -124,6 +179,9 @@ func loadConfig(path string) (ret *Config, err error) {
 				delete(ret.Environments, key)
 				continue
 			}
+			if env.Bridges == nil {
+				env.Bridges = make(BridgeSettingsMap)
+			}
 			if env.BridgeDataDir == "" {
 				env.BridgeDataDir = filepath.Join(UserDataDir, "bbctl", key)
 				saveErr := ret.Save()
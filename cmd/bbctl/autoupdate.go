@@ -0,0 +1,165 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"maunium.net/go/mautrix/bridgev2/status"
+
+	"github.com/beeper/bridge-manager/api/beeperapi"
+	"github.com/beeper/bridge-manager/api/gitlab"
+	"github.com/beeper/bridge-manager/artifacts"
+	"github.com/beeper/bridge-manager/log"
+)
+
+// maintenanceWindow is a daily time range in local time. The end may be before the start,
+// in which case the window crosses midnight.
+type maintenanceWindow struct {
+	start, end time.Duration
+}
+
+func parseClockTime(val string) (time.Duration, error) {
+	parsed, err := time.Parse("15:04", val)
+	if err != nil {
+		return 0, fmt.Errorf("invalid time %q (expected HH:MM)", val)
+	}
+	return time.Duration(parsed.Hour())*time.Hour + time.Duration(parsed.Minute())*time.Minute, nil
+}
+
+// parseMaintenanceWindow parses a HH:MM-HH:MM time range. An empty string means no window, i.e. updates can be applied at any time.
+func parseMaintenanceWindow(val string) (*maintenanceWindow, error) {
+	if val == "" {
+		return nil, nil
+	}
+	startStr, endStr, ok := strings.Cut(val, "-")
+	if !ok {
+		return nil, fmt.Errorf("invalid maintenance window %q (expected HH:MM-HH:MM)", val)
+	}
+	var mw maintenanceWindow
+	var err error
+	if mw.start, err = parseClockTime(strings.TrimSpace(startStr)); err != nil {
+		return nil, err
+	} else if mw.end, err = parseClockTime(strings.TrimSpace(endStr)); err != nil {
+		return nil, err
+	} else if mw.start == mw.end {
+		return nil, fmt.Errorf("maintenance window %q is empty", val)
+	}
+	return &mw, nil
+}
+
+func (mw *maintenanceWindow) String() string {
+	format := func(d time.Duration) string {
+		return fmt.Sprintf("%02d:%02d", int(d.Hours()), int(d.Minutes())%60)
+	}
+	return format(mw.start) + "-" + format(mw.end)
+}
+
+// timeUntilOpen returns how long it is until the window opens, or zero if the given time is inside the window.
+func (mw *maintenanceWindow) timeUntilOpen(now time.Time) time.Duration {
+	if mw == nil {
+		return 0
+	}
+	midnight := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	sinceMidnight := now.Sub(midnight)
+	inWindow := sinceMidnight >= mw.start && sinceMidnight < mw.end
+	if mw.end < mw.start {
+		inWindow = sinceMidnight >= mw.start || sinceMidnight < mw.end
+	}
+	if inWindow {
+		return 0
+	}
+	nextOpen := midnight.Add(mw.start)
+	if !nextOpen.After(now) {
+		nextOpen = midnight.AddDate(0, 0, 1).Add(mw.start)
+	}
+	return nextOpen.Sub(now)
+}
+
+// autoUpdater periodically downloads new builds of a running Go bridge
+// and requests a restart once a new build is installed and the maintenance window is open.
+type autoUpdater struct {
+	BridgeName   string
+	BridgeType   string
+	CIBridgeType string
+	BinaryPath   string
+	Channel      gitlab.Channel
+	Source       artifacts.Source
+	Interval     time.Duration
+	Window       *maintenanceWindow
+
+	Homeserver string
+	Username   string
+	AppToken   string
+	// Bridge states can only be sent to Beeper, not standalone homeservers
+	NoState bool
+
+	RunningCommit string
+	Restart       chan string
+}
+
+func (au *autoUpdater) postState(state status.BridgeStateEvent, reason string, info map[string]any) {
+	if au.NoState {
+		return
+	}
+	err := beeperapi.PostBridgeState(au.Homeserver, au.Username, au.BridgeName, au.AppToken, beeperapi.ReqPostBridgeState{
+		StateEvent:   state,
+		Reason:       reason,
+		Info:         info,
+		IsSelfHosted: true,
+		BridgeType:   toCloudBridgeType(au.BridgeType),
+	})
+	if err != nil {
+		log.Printf("Failed to send bridge state: [red]%v[reset]", err)
+	}
+}
+
+// checkForUpdate installs the latest build if it's newer than the installed binary
+// and returns the installed commit if it differs from the running one.
+func (au *autoUpdater) checkForUpdate(ctx context.Context) (string, error) {
+	err := updateGoBridge(ctx, au.BinaryPath, au.CIBridgeType, false, false, au.Channel, au.Source)
+	if err != nil {
+		return "", err
+	}
+	version, err := getBridgeVersion(au.BinaryPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to get version of new binary: %w", err)
+	} else if version.Commit == au.RunningCommit {
+		return "", nil
+	}
+	return version.Commit, nil
+}
+
+func (au *autoUpdater) Run(ctx context.Context) {
+	ticker := time.NewTicker(au.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		newCommit, err := au.checkForUpdate(ctx)
+		if err != nil {
+			log.Printf("Failed to check for bridge updates: [red]%v[reset]", err)
+			continue
+		} else if newCommit == "" {
+			continue
+		}
+		if wait := au.Window.timeUntilOpen(time.Now()); wait > 0 {
+			log.Printf("Installed [cyan]%s[reset], restarting in maintenance window [cyan]%s[reset] (in %s)", shortHash(newCommit), au.Window, wait.Round(time.Minute))
+			select {
+			case <-ctx.Done():
+				return
+			case <-time.After(wait):
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case au.Restart <- newCommit:
+			au.RunningCommit = newCommit
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMaintenanceWindow(t *testing.T) {
+	tests := []struct {
+		input   string
+		want    string
+		wantErr bool
+	}{
+		{"", "", false},
+		{"03:00-05:00", "03:00-05:00", false},
+		{" 23:30 - 01:15 ", "23:30-01:15", false},
+		{"3:00-5:00", "03:00-05:00", false},
+		{"00:00-23:59", "00:00-23:59", false},
+		{"03:00", "", true},
+		{"03:00-03:00", "", true},
+		{"25:00-05:00", "", true},
+		{"03:00-05:60", "", true},
+		{"3am-5am", "", true},
+	}
+	for _, test := range tests {
+		mw, err := parseMaintenanceWindow(test.input)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseMaintenanceWindow(%q) error = %v, want error: %t", test.input, err, test.wantErr)
+		} else if err == nil && test.want == "" && mw != nil {
+			t.Errorf("parseMaintenanceWindow(%q) = %s, want no window", test.input, mw)
+		} else if err == nil && test.want != "" && (mw == nil || mw.String() != test.want) {
+			t.Errorf("parseMaintenanceWindow(%q) = %v, want %s", test.input, mw, test.want)
+		}
+	}
+}
+
+func TestMaintenanceWindow_TimeUntilOpen(t *testing.T) {
+	at := func(hour, minute int) time.Time {
+		return time.Date(2024, 3, 1, hour, minute, 0, 0, time.UTC)
+	}
+	tests := []struct {
+		window string
+		now    time.Time
+		want   time.Duration
+	}{
+		{"", at(12, 0), 0},
+		{"03:00-05:00", at(4, 0), 0},
+		{"03:00-05:00", at(3, 0), 0},
+		{"03:00-05:00", at(5, 0), 22 * time.Hour},
+		{"03:00-05:00", at(1, 30), 90 * time.Minute},
+		{"23:00-01:00", at(23, 30), 0},
+		{"23:00-01:00", at(0, 30), 0},
+		{"23:00-01:00", at(12, 0), 11 * time.Hour},
+	}
+	for _, test := range tests {
+		mw, err := parseMaintenanceWindow(test.window)
+		if err != nil {
+			t.Fatalf("parseMaintenanceWindow(%q) failed: %v", test.window, err)
+		}
+		if got := mw.timeUntilOpen(test.now); got != test.want {
+			t.Errorf("window %q at %s: timeUntilOpen = %s, want %s", test.window, test.now.Format("15:04"), got, test.want)
+		}
+	}
+}
@@ -8,6 +8,7 @@ import (
 
 	"github.com/AlecAivazis/survey/v2"
 	"github.com/fatih/color"
+	"github.com/mattn/go-isatty"
 	"github.com/urfave/cli/v2"
 
 	"github.com/beeper/bridge-manager/bridgeconfig"
@@ -73,6 +74,21 @@ func doOutputFile(ctx *cli.Context, name, data string) error {
 	return nil
 }
 
+// outputIsTerminal returns true if doOutputFile would print to a terminal rather than to a file or a pipe.
+func outputIsTerminal(ctx *cli.Context) bool {
+	if ctx.String("output") != "-" {
+		return false
+	}
+	stat, err := os.Stdout.Stat()
+	return err == nil && stat.Mode()&os.ModeCharDevice != 0
+}
+
+// stdinIsTerminal returns true if bbctl can ask the user questions interactively.
+// Checking for a character device isn't enough, as /dev/null is one too.
+func stdinIsTerminal() bool {
+	return isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd())
+}
+
 func validateBridgeName(ctx *cli.Context, bridge string) error {
 	if !allowedBridgeRegex.MatchString(bridge) {
 		return UserError{"Invalid bridge name. Names must consist of 1-32 lowercase ASCII letters, digits and -."}
@@ -86,18 +102,22 @@ func validateBridgeName(ctx *cli.Context, bridge string) error {
 	return nil
 }
 
-func guessOrAskBridgeType(bridge, bridgeType string) (string, error) {
-	if bridgeType == "" {
-	Outer:
-		for _, br := range officialBridges {
-			for _, name := range br.names {
-				if strings.Contains(bridge, name) {
-					bridgeType = br.typeName
-					break Outer
-				}
+// guessBridgeType returns the type of the official bridge whose identifier is contained in the name, or an empty string.
+func guessBridgeType(bridge string) string {
+	for _, br := range officialBridges {
+		for _, name := range br.names {
+			if strings.Contains(bridge, name) {
+				return br.typeName
 			}
 		}
 	}
+	return ""
+}
+
+func guessOrAskBridgeType(bridge, bridgeType string) (string, error) {
+	if bridgeType == "" {
+		bridgeType = guessBridgeType(bridge)
+	}
 	if !bridgeconfig.IsSupported(bridgeType) {
 		_, _ = fmt.Fprintln(os.Stderr, color.YellowString("Unsupported bridge type"), color.CyanString(bridgeType))
 		err := survey.AskOne(&survey.Select{
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/beeper/bridge-manager/api/gitlab"
+	"github.com/beeper/bridge-manager/artifacts"
+	"github.com/beeper/bridge-manager/log"
+)
+
+var bundleCommand = &cli.Command{
+	Name:      "bundle",
+	Usage:     "Download bridge binaries into a portable archive for installing on machines without internet access",
+	ArgsUsage: "BRIDGE_TYPE...",
+	Flags: []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:    "platform",
+			Aliases: []string{"p"},
+			Usage:   "Platforms to include in the bundle in os/arch format. Can be specified multiple times. Defaults to the current platform.",
+		},
+		&cli.StringFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Value:   "bbctl-bundle.tar.gz",
+			Usage:   "Path to save the bundle to. Paths ending in .tar.gz or .tgz produce a tarball, anything else is created as a directory.",
+		},
+		&cli.StringFlag{
+			Name:  "channel",
+			Usage: "Bundle builds from the given branch of the bridge repos instead of the default branch.",
+		},
+		&cli.StringFlag{
+			Name:  "pin",
+			Usage: "Bundle the build of a specific release tag or full commit hash.",
+		},
+		&cli.BoolFlag{
+			Name:  "compile",
+			Usage: "Compile the bridges locally for each platform instead of downloading binaries from CI. Platforms other than the current one need a C cross-compiler.",
+		},
+		compileRepoFlag,
+		compileRefFlag,
+		compilePatchesFlag,
+	},
+	Action: bundleBridges,
+}
+
+// addBundleFile adds a file to the build of the given bridge type and platform in the bundle.
+// Bridges that share a CI type (like meta and instagram) are stored in the same build,
+// so the build is created by the first bridge and extended by the others.
+func addBundleFile(dir string, manifest *artifacts.Manifest, ciBridgeType, platform, commit, fileName string, fetch func(path string) error) error {
+	build := manifest.Get(ciBridgeType, platform)
+	if build == nil {
+		build = &artifacts.Build{Commit: commit, Files: make(map[string]string)}
+		manifest.Set(ciBridgeType, platform, build)
+	} else if build.Commit != commit {
+		return fmt.Errorf("%s for %s is from commit %s, but other %s binaries in the bundle are from %s", fileName, platform, commit, ciBridgeType, build.Commit)
+	} else if build.HasFile(fileName) {
+		return nil
+	}
+	path := filepath.Join(dir, filepath.FromSlash(artifacts.FilePath(ciBridgeType, platform, fileName)))
+	err := os.MkdirAll(filepath.Dir(path), 0755)
+	if err != nil {
+		return err
+	}
+	err = fetch(path)
+	if err != nil {
+		return err
+	}
+	build.Files[fileName], err = artifacts.HashFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to hash %s: %w", fileName, err)
+	}
+	return nil
+}
+
+func isBundled(manifest *artifacts.Manifest, ciBridgeType, platform, binaryName string) bool {
+	build := manifest.Get(ciBridgeType, platform)
+	return build != nil && build.HasFile(binaryName)
+}
+
+func bundleBridge(ctx *cli.Context, dir string, manifest *artifacts.Manifest, bridgeType, platform string, channel gitlab.Channel) error {
+	ciBridgeType, binaryName, ok := getGoBridgeBinary(bridgeType)
+	if !ok {
+		return UserError{fmt.Sprintf("%s is not a Go bridge, only Go bridges can be bundled", bridgeType)}
+	} else if isBundled(manifest, ciBridgeType, platform, binaryName) {
+		return nil
+	}
+	log.Printf("Finding latest build of [cyan]%s[reset] for [cyan]%s[reset]", binaryName, platform)
+	build, err := gitlab.GetLastBridgeBuild(ciBridgeType, platform, false, channel)
+	if err != nil {
+		return err
+	}
+	fileNames := []string{binaryName}
+	goos, _, _ := strings.Cut(platform, "/")
+	if gitlab.NeedsLibolmDylib(ciBridgeType, goos) {
+		fileNames = append(fileNames, "libolm.3.dylib")
+	}
+	for _, fileName := range fileNames {
+		err = addBundleFile(dir, manifest, ciBridgeType, platform, build.Commit, fileName, func(path string) error {
+			err := gitlab.DownloadFile(ctx.Context, gitlab.MakeArtifactURL(gitlab.MautrixDomain, build.JobURL, fileName), path)
+			if err != nil {
+				return fmt.Errorf("failed to download %s: %w", fileName, err)
+			}
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func bundleCompiledBridge(ctx *cli.Context, dir string, manifest *artifacts.Manifest, bridgeType, platform string, src compileSource) error {
+	ciBridgeType, binaryName, ok := getGoBridgeBinary(bridgeType)
+	if !ok {
+		return UserError{fmt.Sprintf("%s is not a Go bridge, only Go bridges can be bundled", bridgeType)}
+	}
+	target, err := parseCompileTarget(platform)
+	if err != nil {
+		return err
+	} else if isBundled(manifest, ciBridgeType, target.Platform(), binaryName) {
+		return nil
+	}
+	builtPath, err := compileGoBridgeForTarget(ctx.Context, GetEnvConfig(ctx).BridgeDataDir, ciBridgeType, binaryName, target, false, src)
+	if err != nil {
+		return fmt.Errorf("failed to compile %s for %s: %w", binaryName, target, err)
+	}
+	record, err := readCompileRecord(builtPath)
+	if err != nil {
+		return err
+	} else if record == nil {
+		return fmt.Errorf("build record of %s not found", binaryName)
+	}
+	return addBundleFile(dir, manifest, ciBridgeType, target.Platform(), record.Commit, binaryName, func(path string) error {
+		err := copyExecutable(builtPath, path)
+		if err != nil {
+			return fmt.Errorf("failed to copy %s to bundle: %w", binaryName, err)
+		}
+		return nil
+	})
+}
+
+func bundleBridges(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return UserError{"You must specify at least one bridge type to bundle"}
+	}
+	channel, err := getInstallChannel(ctx)
+	if err != nil {
+		return err
+	}
+	compile := ctx.Bool("compile")
+	compileSrc, err := getCompileSource(ctx)
+	if err != nil {
+		return err
+	} else if compile && !channel.IsDefault() {
+		return UserError{"--channel and --pin can't be used with --compile"}
+	}
+	platforms := ctx.StringSlice("platform")
+	if len(platforms) == 0 {
+		platforms = []string{gitlab.HostPlatform()}
+	}
+	output := ctx.String("output")
+	asTarball := strings.HasSuffix(output, ".tar.gz") || strings.HasSuffix(output, ".tgz")
+	dir := output
+	if asTarball {
+		dir, err = os.MkdirTemp("", "bbctl-bundle-*")
+		if err != nil {
+			return fmt.Errorf("failed to create temporary directory: %w", err)
+		}
+		defer os.RemoveAll(dir)
+	} else if err = os.MkdirAll(dir, 0755); err != nil {
+		return fmt.Errorf("failed to create output directory: %w", err)
+	}
+	manifest := &artifacts.Manifest{CreatedAt: time.Now().UTC()}
+	for _, arg := range ctx.Args().Slice() {
+		bridgeType, err := guessOrAskBridgeType(arg, "")
+		if err != nil {
+			return err
+		}
+		for _, platform := range platforms {
+			if compile {
+				err = bundleCompiledBridge(ctx, dir, manifest, bridgeType, platform, compileSrc)
+			} else {
+				err = bundleBridge(ctx, dir, manifest, bridgeType, platform, channel)
+			}
+			if errors.Is(err, gitlab.ErrNotBuiltInCI) {
+				log.Printf("[yellow]Skipping %s for %s: %v[reset]", bridgeType, platform, err)
+			} else if err != nil {
+				return err
+			}
+		}
+	}
+	err = artifacts.WriteManifest(dir, manifest)
+	if err != nil {
+		return fmt.Errorf("failed to write manifest: %w", err)
+	}
+	if asTarball {
+		err = artifacts.WriteTarball(dir, output)
+		if err != nil {
+			return err
+		}
+	}
+	log.Printf("Wrote bundle to [cyan]%s[reset]", output)
+	return nil
+}
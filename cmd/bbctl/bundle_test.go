@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/beeper/bridge-manager/artifacts"
+)
+
+func TestAddBundleFile_SharedCIType(t *testing.T) {
+	const platform = "linux/amd64"
+	const commit = "0123456789abcdef0123456789abcdef01234567"
+	dir := t.TempDir()
+	manifest := &artifacts.Manifest{}
+	fetches := 0
+	for _, bridgeType := range []string{"meta", "instagram", "meta"} {
+		ciBridgeType, binaryName, _ := getGoBridgeBinary(bridgeType)
+		err := addBundleFile(dir, manifest, ciBridgeType, platform, commit, binaryName, func(path string) error {
+			fetches++
+			return os.WriteFile(path, []byte("#!/bin/sh\necho "+binaryName+"\n"), 0755)
+		})
+		if err != nil {
+			t.Fatalf("failed to bundle %s: %v", bridgeType, err)
+		}
+	}
+	if fetches != 2 {
+		t.Errorf("expected 2 files to be fetched, got %d", fetches)
+	}
+	build := manifest.Get("meta", platform)
+	if build == nil || len(build.Files) != 2 || !build.HasFile("mautrix-meta") || !build.HasFile("mautrix-instagram") {
+		t.Fatalf("expected both binaries in the meta build, got %+v", build)
+	}
+	err := artifacts.WriteManifest(dir, manifest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	src, err := artifacts.OpenSource(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	installDir := t.TempDir()
+	for _, binaryName := range []string{"mautrix-meta", "mautrix-instagram"} {
+		path := filepath.Join(installDir, binaryName)
+		err = artifacts.Install(context.Background(), src, "meta", platform, path, false, "")
+		if err != nil {
+			t.Fatalf("failed to install %s from bundle: %v", binaryName, err)
+		}
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		} else if string(data) != "#!/bin/sh\necho "+binaryName+"\n" {
+			t.Errorf("%s has unexpected content %q", binaryName, data)
+		}
+	}
+
+	err = addBundleFile(dir, manifest, "meta", platform, "fedcba9876543210fedcba9876543210fedcba98", "mautrix-other", func(string) error {
+		t.Error("file from a different commit shouldn't be fetched")
+		return nil
+	})
+	if err == nil {
+		t.Error("expected error when adding a file from a different commit")
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+
+	"github.com/beeper/bridge-manager/api/gitlab"
+	"github.com/beeper/bridge-manager/cli/hyper"
+	"github.com/beeper/bridge-manager/log"
+)
+
+var changelogCommand = &cli.Command{
+	Name:      "changelog",
+	Usage:     "List the changes between the installed version of a bridge and the latest build",
+	ArgsUsage: "BRIDGE",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "type",
+			Aliases: []string{"t"},
+			EnvVars: []string{"BEEPER_BRIDGE_TYPE"},
+			Usage:   "The type of bridge, if it can't be guessed from the name.",
+		},
+		&cli.StringFlag{
+			Name:  "from",
+			Usage: "Commit to start from instead of the installed version.",
+		},
+		&cli.StringFlag{
+			Name:  "to",
+			Usage: "Commit to end at instead of the latest build on the bridge's channel.",
+		},
+		&cli.BoolFlag{
+			Name:    "json",
+			Aliases: []string{"j"},
+			Usage:   "Output the changelog as JSON.",
+		},
+	},
+	Action: showChangelog,
+}
+
+type ChangelogCommit struct {
+	ID                string    `json:"id"`
+	Title             string    `json:"title"`
+	Message           string    `json:"message"`
+	Author            string    `json:"author"`
+	Date              time.Time `json:"date"`
+	URL               string    `json:"url"`
+	TouchesMigrations bool      `json:"touches_migrations"`
+	TouchesConfig     bool      `json:"touches_config"`
+}
+
+type Changelog struct {
+	Bridge            string             `json:"bridge"`
+	Repo              string             `json:"repo"`
+	FromCommit        string             `json:"from_commit"`
+	ToCommit          string             `json:"to_commit"`
+	TouchesMigrations bool               `json:"touches_migrations"`
+	TouchesConfig     bool               `json:"touches_config"`
+	Commits           []*ChangelogCommit `json:"commits"`
+}
+
+// How many commits to fetch individual diffs of when looking for the commits that change migrations or the config.
+const maxChangelogCommitDiffs = 30
+
+func shortHash(commit string) string {
+	if len(commit) > 8 {
+		return commit[:8]
+	}
+	return commit
+}
+
+func diffTouches(diffs []*gitlab.Diff) (migrations, config bool) {
+	for _, diff := range diffs {
+		migrations = migrations || gitlab.IsMigrationPath(diff.NewPath) || gitlab.IsMigrationPath(diff.OldPath)
+		config = config || gitlab.IsConfigPath(diff.NewPath) || gitlab.IsConfigPath(diff.OldPath)
+	}
+	return
+}
+
+func getChangelog(changelog *Changelog) error {
+	repo := changelog.Repo
+	comparison, err := gitlab.CompareCommits(gitlab.MautrixDomain, repo, changelog.FromCommit, changelog.ToCommit)
+	if err != nil {
+		return fmt.Errorf("failed to compare commits: %w", err)
+	}
+	changelog.TouchesMigrations, changelog.TouchesConfig = diffTouches(comparison.Diffs)
+	commits := make([]*ChangelogCommit, len(comparison.Commits))
+	for i, commit := range comparison.Commits {
+		commits[i] = &ChangelogCommit{
+			ID:      commit.ID,
+			Title:   commit.Title,
+			Message: strings.TrimSpace(commit.Message),
+			Author:  commit.AuthorName,
+			Date:    commit.AuthoredAt,
+			URL:     commit.WebURL,
+		}
+	}
+	changelog.Commits = commits
+	// The comparison only has the combined diff, so individual commits are only checked if the range has something to flag
+	if !changelog.TouchesMigrations && !changelog.TouchesConfig {
+		return nil
+	} else if len(commits) > maxChangelogCommitDiffs {
+		log.Printf("[yellow]Only checking the newest %d of %d commits for database migrations and config changes[reset]", maxChangelogCommitDiffs, len(commits))
+		commits = commits[:maxChangelogCommitDiffs]
+	}
+	for _, commit := range commits {
+		diffs, err := gitlab.GetCommitDiff(gitlab.MautrixDomain, repo, commit.ID)
+		if err != nil {
+			return fmt.Errorf("failed to get diff of %s: %w", shortHash(commit.ID), err)
+		}
+		commit.TouchesMigrations, commit.TouchesConfig = diffTouches(diffs)
+	}
+	return nil
+}
+
+func showChangelog(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return UserError{"You must specify a bridge to show the changelog of"}
+	} else if ctx.NArg() > 1 {
+		return UserError{"Too many arguments specified (flags must come before arguments)"}
+	}
+	bin, err := findBridgeBinary(ctx, ctx.Args().Get(0), ctx.String("type"))
+	if err != nil {
+		return err
+	}
+	fromCommit := ctx.String("from")
+	if fromCommit == "" {
+		version, err := getBridgeVersion(bin.Path)
+		if err != nil {
+			return fmt.Errorf("failed to get installed version of %s: %w", filepath.Base(bin.Path), err)
+		}
+		fromCommit = version.Commit
+	}
+	toCommit := ctx.String("to")
+	if toCommit == "" {
+		build, err := gitlab.GetLastBridgeBuild(bin.CIBridgeType, "", false, bin.Channel)
+		if err != nil {
+			return fmt.Errorf("failed to get last build info: %w", err)
+		}
+		toCommit = build.Commit
+	}
+	changelog := &Changelog{
+		Bridge:     bin.BridgeType,
+		Repo:       gitlab.GetBridgeRepo(bin.CIBridgeType),
+		FromCommit: fromCommit,
+		ToCommit:   toCommit,
+	}
+	if fromCommit != toCommit {
+		err = getChangelog(changelog)
+		if err != nil {
+			return err
+		}
+	}
+	if ctx.Bool("json") {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(changelog)
+	}
+	if len(changelog.Commits) == 0 {
+		log.Printf("[cyan]%s[reset] is up to date (commit: %s)", filepath.Base(bin.Path), shortHash(fromCommit))
+		return nil
+	}
+	fmt.Printf("%s %s...%s (%d commits)\n", color.CyanString(changelog.Repo), shortHash(fromCommit), shortHash(toCommit), len(changelog.Commits))
+	if changelog.TouchesMigrations {
+		fmt.Println(color.RedString("This update includes database migrations"))
+	}
+	if changelog.TouchesConfig {
+		fmt.Println(color.YellowString("This update changes the example config"))
+	}
+	for _, commit := range changelog.Commits {
+		var flags string
+		if commit.TouchesMigrations {
+			flags += " " + color.RedString("[database migration]")
+		}
+		if commit.TouchesConfig {
+			flags += " " + color.YellowString("[config change]")
+		}
+		fmt.Printf(
+			"* %s %s (%s, %s)%s\n",
+			color.HiBlueString(hyper.Link(shortHash(commit.ID), commit.URL, false)),
+			commit.Title,
+			color.CyanString(commit.Author),
+			commit.Date.Local().Format(time.DateOnly),
+			flags,
+		)
+	}
+	return nil
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+
+	"github.com/beeper/bridge-manager/bridgeconfig"
+	"github.com/beeper/bridge-manager/log"
+)
+
+type versionRange struct {
+	Name     string
+	Version  string
+	Min, Max string
+}
+
+// check compares the version against the range. The maximum only compares major and minor versions,
+// as patch releases don't change the config format.
+func (vr versionRange) check() (tooOld bool, tooNew bool) {
+	if vr.Version == "" {
+		return false, false
+	}
+	if vr.Min != "" {
+		if result, ok := compareVersions(vr.Version, vr.Min, 3); ok && result < 0 {
+			tooOld = true
+		}
+	}
+	if vr.Max != "" {
+		if result, ok := compareVersions(vr.Version, vr.Max, 2); ok && result > 0 {
+			tooNew = true
+		}
+	}
+	return
+}
+
+// checkTemplateCompat compares the bridge and mautrix-go versions of a Go bridge binary
+// against the versions supported by the config template of the bridge type.
+func checkTemplateCompat(bridgeType, binaryPath string) error {
+	meta := bridgeconfig.GetMetadata(bridgeType)
+	if meta == nil {
+		return nil
+	}
+	version, err := getBridgeVersion(binaryPath)
+	if err != nil {
+		log.Printf("[yellow]Failed to get bridge version for compatibility check: %v[reset]", err)
+		return nil
+	}
+	return checkVersionRanges(bridgeType, []versionRange{
+		{Name: filepath.Base(binaryPath), Version: version.Version, Min: meta.MinBridgeVersion, Max: meta.MaxBridgeVersion},
+		{Name: "mautrix-go", Version: version.Mautrix.Version, Min: meta.MinMautrixVersion, Max: meta.MaxMautrixVersion},
+	})
+}
+
+// checkPythonTemplateCompat compares the version of the package installed in the virtualenv of a Python bridge
+// against the versions supported by the config template of the bridge type.
+func checkPythonTemplateCompat(ctx context.Context, bridgeType, venvPython string) error {
+	meta := bridgeconfig.GetMetadata(bridgeType)
+	if meta == nil || (meta.MinBridgeVersion == "" && meta.MaxBridgeVersion == "") {
+		return nil
+	}
+	packageName := pythonPackageName(pythonBridges[bridgeType].Package)
+	version, err := getPythonPackageVersion(ctx, venvPython, packageName)
+	if err != nil {
+		log.Printf("[yellow]Failed to get bridge version for compatibility check: %v[reset]", err)
+		return nil
+	}
+	return checkVersionRanges(bridgeType, []versionRange{
+		{Name: packageName, Version: version, Min: meta.MinBridgeVersion, Max: meta.MaxBridgeVersion},
+	})
+}
+
+// checkVersionRanges returns an error if any version is older than the config template supports,
+// and warns if it's newer than the template is known to work with.
+func checkVersionRanges(bridgeType string, ranges []versionRange) error {
+	for _, vr := range ranges {
+		tooOld, tooNew := vr.check()
+		if tooOld {
+			return UserError{fmt.Sprintf(
+				"The %s config template in this version of bbctl requires %s %s or newer, but the bridge uses %s. "+
+					"Update the bridge (e.g. by removing --pin, --channel or --python-pin) or use an older version of bbctl. "+
+					"Use --skip-compat-check to start the bridge anyway.",
+				bridgeType, vr.Name, vr.Min, vr.Version,
+			)}
+		} else if tooNew {
+			log.Printf(
+				"[yellow]The bridge uses %s %s, which is newer than the %s config template in this version of bbctl supports (up to %s). "+
+					"The generated config may be missing new options, run `bbctl self-update` to update bbctl.[reset]",
+				vr.Name, vr.Version, bridgeType, vr.Max,
+			)
+		}
+	}
+	return nil
+}
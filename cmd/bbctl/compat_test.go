@@ -0,0 +1,98 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestVersionRange_Check(t *testing.T) {
+	tests := []struct {
+		name       string
+		vr         versionRange
+		wantTooOld bool
+		wantTooNew bool
+	}{
+		{"in range", versionRange{Version: "0.7.2", Min: "v0.7.0", Max: "v0.7"}, false, false},
+		{"newer patch", versionRange{Version: "v0.7.9+dev", Min: "v0.7.0", Max: "v0.7"}, false, false},
+		{"too old", versionRange{Version: "0.6.5", Min: "v0.7.0", Max: "v0.7"}, true, false},
+		{"too new", versionRange{Version: "0.8.0", Min: "v0.7.0", Max: "v0.7"}, false, true},
+		{"unknown version", versionRange{Version: "", Min: "v0.7.0", Max: "v0.7"}, false, false},
+		{"unparseable version", versionRange{Version: "unknown", Min: "v0.7.0", Max: "v0.7"}, false, false},
+		{"no range", versionRange{Version: "0.1.0"}, false, false},
+	}
+	for _, test := range tests {
+		tooOld, tooNew := test.vr.check()
+		if tooOld != test.wantTooOld || tooNew != test.wantTooNew {
+			t.Errorf("%s: got too old %t, too new %t", test.name, tooOld, tooNew)
+		}
+	}
+}
+
+func writeFakeExecutable(t *testing.T, name, output string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), name)
+	err := os.WriteFile(path, []byte("#!/bin/sh\necho '"+output+"'\n"), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestCheckTemplateCompat(t *testing.T) {
+	tests := []struct {
+		bridgeType string
+		version    string
+		mautrix    string
+		wantErr    bool
+	}{
+		{"discord", "0.7.3", "v0.19.0", false},
+		{"discord", "0.8.0", "v0.19.0", false},
+		{"discord", "0.6.5", "v0.19.0", true},
+		{"imessagego", "0.1.0", "v0.18.0", false},
+		{"whatsapp", "0.12.0", "v0.25.2", false},
+		{"whatsapp", "0.12.0", "v0.20.0", true},
+	}
+	for _, test := range tests {
+		binary := writeFakeExecutable(t, "mautrix-"+test.bridgeType, `{"Version": "`+test.version+`", "Mautrix": {"Version": "`+test.mautrix+`"}}`)
+		err := checkTemplateCompat(test.bridgeType, binary)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s %s (mautrix-go %s): got error %v, want error: %t", test.bridgeType, test.version, test.mautrix, err, test.wantErr)
+		} else if _, ok := err.(UserError); err != nil && !ok {
+			t.Errorf("%s %s: expected UserError, got %v", test.bridgeType, test.version, err)
+		}
+	}
+}
+
+func TestCheckPythonTemplateCompat(t *testing.T) {
+	tests := []struct {
+		bridgeType string
+		version    string
+		wantErr    bool
+	}{
+		{"googlechat", "0.5.2", false},
+		{"googlechat", "0.4.9", true},
+		{"heisenbridge", "1.15.3", false},
+		{"heisenbridge", "1.16.0", false},
+		{"heisenbridge", "1.14.2", true},
+	}
+	for _, test := range tests {
+		python := writeFakeExecutable(t, "python3", test.version)
+		err := checkPythonTemplateCompat(context.Background(), test.bridgeType, python)
+		if (err != nil) != test.wantErr {
+			t.Errorf("%s %s: got error %v, want error: %t", test.bridgeType, test.version, err, test.wantErr)
+		}
+	}
+}
+
+func TestPythonPackageName(t *testing.T) {
+	for requirement, want := range map[string]string{
+		"mautrix-googlechat[all]": "mautrix-googlechat",
+		"heisenbridge":            "heisenbridge",
+	} {
+		if got := pythonPackageName(requirement); got != want {
+			t.Errorf("pythonPackageName(%q) = %q, want %q", requirement, got, want)
+		}
+	}
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/beeper/bridge-manager/artifacts"
+	"github.com/beeper/bridge-manager/log"
+)
+
+var compileRepoFlag = &cli.StringFlag{
+	Name:    "compile-repo",
+	Usage:   "Git remote URL to clone when using --compile, e.g. a fork of the bridge. Defaults to the official repo.",
+	EnvVars: []string{"BEEPER_BRIDGE_COMPILE_REPO"},
+}
+
+var compileRefFlag = &cli.StringFlag{
+	Name:    "compile-ref",
+	Usage:   "Branch, tag or commit to build when using --compile. Defaults to the default branch of the repo.",
+	EnvVars: []string{"BEEPER_BRIDGE_COMPILE_REF"},
+}
+
+var compilePatchesFlag = &cli.StringFlag{
+	Name:    "compile-patches",
+	Usage:   "Directory of .patch files to apply in alphabetical order before building when using --compile.",
+	EnvVars: []string{"BEEPER_BRIDGE_COMPILE_PATCHES"},
+}
+
+// compileSource describes what to check out before compiling a bridge.
+type compileSource struct {
+	RepoURL  string
+	Ref      string
+	PatchDir string
+}
+
+func getCompileSource(ctx *cli.Context) (compileSource, error) {
+	src := compileSource{
+		RepoURL:  ctx.String("compile-repo"),
+		Ref:      ctx.String("compile-ref"),
+		PatchDir: ctx.String("compile-patches"),
+	}
+	if (src.RepoURL != "" || src.Ref != "" || src.PatchDir != "") && !ctx.Bool("compile") {
+		return src, UserError{"--compile-repo, --compile-ref and --compile-patches can only be used with --compile"}
+	}
+	if src.PatchDir != "" {
+		if stat, err := os.Stat(src.PatchDir); err != nil || !stat.IsDir() {
+			return src, UserError{fmt.Sprintf("Patch directory %s doesn't exist", src.PatchDir)}
+		}
+	}
+	return src, nil
+}
+
+func getDefaultCompileRepo(bridgeType string) string {
+	if bridgeType == "imessagego" {
+		return "https://github.com/beeper/imessage.git"
+	}
+	return fmt.Sprintf("https://github.com/mautrix/%s.git", bridgeType)
+}
+
+// listPatches returns the .patch files in the given directory in the order they should be applied.
+func listPatches(dir string) ([]string, error) {
+	if dir == "" {
+		return nil, nil
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read patch directory: %w", err)
+	}
+	var patches []string
+	for _, entry := range entries {
+		if !entry.IsDir() && strings.HasSuffix(entry.Name(), ".patch") {
+			patches = append(patches, filepath.Join(dir, entry.Name()))
+		}
+	}
+	sort.Strings(patches)
+	return patches, nil
+}
+
+type compiledPatch struct {
+	Name   string `json:"name"`
+	SHA256 string `json:"sha256"`
+}
+
+// compileRecord is saved next to compiled binaries to record what they were built from.
+type compileRecord struct {
+	Repo    string          `json:"repo"`
+	Ref     string          `json:"ref,omitempty"`
+	Commit  string          `json:"commit"`
+	Patches []compiledPatch `json:"patches,omitempty"`
+	Target  string          `json:"target"`
+	BuiltAt time.Time       `json:"built_at"`
+}
+
+func compileRecordPath(binaryPath string) string {
+	return binaryPath + ".build.json"
+}
+
+func readCompileRecord(binaryPath string) (*compileRecord, error) {
+	data, err := os.ReadFile(compileRecordPath(binaryPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var record compileRecord
+	err = json.Unmarshal(data, &record)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse build record: %w", err)
+	}
+	return &record, nil
+}
+
+// describeCompileRecord returns a short human-readable description of what a binary was compiled from.
+func describeCompileRecord(cr *compileRecord) string {
+	desc := cr.Repo
+	if cr.Ref != "" {
+		desc += "@" + cr.Ref
+	}
+	if len(cr.Patches) > 0 {
+		desc += fmt.Sprintf(" with %d patches", len(cr.Patches))
+	}
+	return desc
+}
+
+func (cr *compileRecord) Save(binaryPath string) error {
+	data, err := json.MarshalIndent(cr, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(compileRecordPath(binaryPath), data, 0600)
+}
+
+// checkoutCompileSource clones the repo if necessary, checks out the requested ref from scratch and applies patches.
+// Any changes from previous patches are discarded, so the same build directory can be reused with different sources.
+func checkoutCompileSource(ctx context.Context, buildDir, bridgeType string, src compileSource) (*compileRecord, error) {
+	repo := src.RepoURL
+	if repo == "" {
+		repo = getDefaultCompileRepo(bridgeType)
+	}
+	if _, err := os.Stat(buildDir); errors.Is(err, fs.ErrNotExist) {
+		log.Printf("Cloning [cyan]%s[reset] to [cyan]%s[reset]", repo, buildDir)
+		err = makeCmd(ctx, filepath.Dir(buildDir), "git", "clone", repo, buildDir).Run()
+		if err != nil {
+			return nil, fmt.Errorf("failed to clone repo: %w", err)
+		}
+	} else {
+		err = makeCmd(ctx, buildDir, "git", "remote", "set-url", "origin", repo).Run()
+		if err != nil {
+			return nil, fmt.Errorf("failed to set repo URL: %w", err)
+		}
+	}
+	// Fetching HEAD gets the default branch of the remote
+	ref := src.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	log.Printf("Fetching [cyan]%s[reset] from [cyan]%s[reset]", ref, repo)
+	err := makeCmd(ctx, buildDir, "git", "fetch", "--tags", "origin", ref).Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", ref, err)
+	}
+	err = makeCmd(ctx, buildDir, "git", "checkout", "--force", "--detach", "FETCH_HEAD").Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check out %s: %w", ref, err)
+	}
+	err = makeCmd(ctx, buildDir, "git", "clean", "--force", "-d").Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed to clean repo: %w", err)
+	}
+	commit, err := getGitCommit(ctx, buildDir)
+	if err != nil {
+		return nil, err
+	}
+	record := &compileRecord{Repo: repo, Ref: src.Ref, Commit: commit}
+	patches, err := listPatches(src.PatchDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, patch := range patches {
+		absPatch, err := filepath.Abs(patch)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Applying [cyan]%s[reset]", filepath.Base(patch))
+		err = makeCmd(ctx, buildDir, "git", "apply", absPatch).Run()
+		if err != nil {
+			return nil, fmt.Errorf("failed to apply %s: %w", filepath.Base(patch), err)
+		}
+		checksum, err := artifacts.HashFile(patch)
+		if err != nil {
+			return nil, fmt.Errorf("failed to hash %s: %w", filepath.Base(patch), err)
+		}
+		record.Patches = append(record.Patches, compiledPatch{Name: filepath.Base(patch), SHA256: checksum})
+	}
+	return record, nil
+}
@@ -1,23 +1,22 @@
 package main
 
 import (
-	"crypto/aes"
-	"encoding/base64"
-	"encoding/hex"
+	"errors"
 	"fmt"
 	"hash/crc32"
+	"io/fs"
 	"os"
 	"path/filepath"
 	"runtime"
 	"strings"
 
-	"github.com/AlecAivazis/survey/v2"
 	"github.com/fatih/color"
 	"github.com/urfave/cli/v2"
-	"golang.org/x/exp/maps"
 
+	"github.com/beeper/bridge-manager/api/beeperapi"
 	"github.com/beeper/bridge-manager/bridgeconfig"
 	"github.com/beeper/bridge-manager/cli/hyper"
+	"github.com/beeper/bridge-manager/log"
 )
 
 var configCommand = &cli.Command{
@@ -25,7 +24,6 @@ var configCommand = &cli.Command{
 	Aliases:   []string{"c"},
 	Usage:     "Generate a config for an official Beeper bridge",
 	ArgsUsage: "BRIDGE",
-	Before:    RequiresAuth,
 	Flags: []cli.Flag{
 		&cli.StringFlag{
 			Name:    "type",
@@ -38,6 +36,14 @@ var configCommand = &cli.Command{
 			Aliases: []string{"p"},
 			Usage:   "Set a bridge-specific config generation option. Can be specified multiple times for different keys. Format: key=value",
 		},
+		skipParamChecksFlag,
+		configSetFlag,
+		&cli.StringFlag{
+			Name:    "config-overlay",
+			EnvVars: []string{"BEEPER_BRIDGE_CONFIG_OVERLAY"},
+			Usage:   "Path to a YAML file to deep-merge into the generated config.",
+		},
+		databaseURIFlag,
 		&cli.StringFlag{
 			Name:    "output",
 			Aliases: []string{"o"},
@@ -58,150 +64,94 @@ var configCommand = &cli.Command{
 		},
 	},
 	Action: generateBridgeConfig,
+	Subcommands: []*cli.Command{
+		configDiffCommand,
+		configUpgradeCommand,
+		configHistoryCommand,
+		configRevertCommand,
+		configUnpinCommand,
+		configValidateCommand,
+		configUpdateHomeserverCommand,
+		configParamsCommand,
+	},
 }
 
-func simpleDescriptions(descs map[string]string) func(string, int) string {
-	return func(s string, i int) string {
-		return descs[s]
-	}
+// The overlay file that `bbctl run` merges into the generated config if it exists in the bridge directory.
+const defaultConfigOverlayFile = "config-overlay.yaml"
+
+var configSetFlag = &cli.StringSliceFlag{
+	Name:  "set",
+	Usage: "Override a value in the generated config. Can be specified multiple times. Dots in keys can be escaped with a backslash. Format: path.to.key=value",
 }
 
-var askParams = map[string]func(string, map[string]string) (bool, error){
-	"meta": func(bridgeName string, extraParams map[string]string) (bool, error) {
-		metaPlatform := extraParams["meta_platform"]
-		changed := false
-		if metaPlatform == "" {
-			if strings.Contains(bridgeName, "facebook-tor") || strings.Contains(bridgeName, "facebooktor") {
-				metaPlatform = "facebook-tor"
-			} else if strings.Contains(bridgeName, "facebook") {
-				metaPlatform = "facebook"
-			} else if strings.Contains(bridgeName, "messenger") {
-				metaPlatform = "messenger"
-			} else if strings.Contains(bridgeName, "instagram") {
-				metaPlatform = "instagram"
-			} else {
-				extraParams["meta_platform"] = ""
-				return false, nil
-			}
-			extraParams["meta_platform"] = metaPlatform
-		} else if metaPlatform != "instagram" && metaPlatform != "facebook" && metaPlatform != "facebook-tor" && metaPlatform != "messenger" && metaPlatform != "messenger-lite" {
-			return false, UserError{"Invalid Meta platform specified"}
-		}
-		if metaPlatform == "facebook-tor" {
-			proxy := extraParams["proxy"]
-			if proxy == "" {
-				err := survey.AskOne(&survey.Input{
-					Message: "Enter Tor proxy address",
-					Default: "socks5://localhost:1080",
-				}, &proxy)
-				if err != nil {
-					return false, err
-				}
-				extraParams["proxy"] = proxy
-				changed = true
-			}
+// applyConfigOverlay merges the overlay file and --set flags into a generated config.
+// If the overlay file isn't required, it's ignored if it doesn't exist.
+func applyConfigOverlay(ctx *cli.Context, cfg *generatedBridgeConfig, overlayPath string, required bool) error {
+	var overlay []byte
+	if overlayPath != "" {
+		var err error
+		overlay, err = os.ReadFile(overlayPath)
+		if errors.Is(err, fs.ErrNotExist) && !required {
+			overlay = nil
+		} else if err != nil {
+			return fmt.Errorf("failed to read config overlay: %w", err)
+		} else {
+			log.Printf("Applying config overlay from [magenta]%s[reset]", overlayPath)
 		}
-		return changed, nil
-	},
-	"imessagego": func(bridgeName string, extraParams map[string]string) (bool, error) {
-		nacToken := extraParams["nac_token"]
-		var didAddParams bool
-		if nacToken == "" {
-			err := survey.AskOne(&survey.Input{
-				Message: "Enter iMessage registration code",
-			}, &nacToken)
-			if err != nil {
-				return didAddParams, err
-			}
-			extraParams["nac_token"] = nacToken
-			didAddParams = true
-		}
-		return didAddParams, nil
-	},
-	"imessage": func(bridgeName string, extraParams map[string]string) (bool, error) {
-		platform := extraParams["imessage_platform"]
-		barcelonaPath := extraParams["barcelona_path"]
-		bbURL := extraParams["bluebubbles_url"]
-		bbPassword := extraParams["bluebubbles_password"]
-		var didAddParams bool
-		if runtime.GOOS != "darwin" && platform == "" {
-			// Linux can't run the other connectors
-			platform = "bluebubbles"
-		}
-		if platform == "" {
-			err := survey.AskOne(&survey.Select{
-				Message: "Select iMessage connector:",
-				Options: []string{"mac", "mac-nosip", "bluebubbles"},
-				Description: simpleDescriptions(map[string]string{
-					"mac":         "Use AppleScript to send messages and read chat.db for incoming data - only requires Full Disk Access (from system settings)",
-					"mac-nosip":   "Use Barcelona to interact with private APIs - requires disabling SIP and AMFI",
-					"bluebubbles": "Connect to a BlueBubbles instance",
-				}),
-				Default: "mac",
-			}, &platform)
-			if err != nil {
-				return didAddParams, err
-			}
-			extraParams["imessage_platform"] = platform
-			didAddParams = true
-		}
-		if platform == "mac-nosip" && barcelonaPath == "" {
-			err := survey.AskOne(&survey.Input{
-				Message: "Enter Barcelona executable path:",
-				Default: "darwin-barcelona-mautrix",
-			}, &barcelonaPath)
-			if err != nil {
-				return didAddParams, err
-			}
-			extraParams["barcelona_path"] = barcelonaPath
-			didAddParams = true
-		}
-		if platform == "bluebubbles" {
-			if bbURL == "" {
-				err := survey.AskOne(&survey.Input{
-					Message: "Enter BlueBubbles API address:",
-				}, &bbURL)
-				if err != nil {
-					return didAddParams, err
-				}
-				extraParams["bluebubbles_url"] = bbURL
-				didAddParams = true
-			}
-			if bbPassword == "" {
-				err := survey.AskOne(&survey.Input{
-					Message: "Enter BlueBubbles password:",
-				}, &bbPassword)
-				if err != nil {
-					return didAddParams, err
-				}
-				extraParams["bluebubbles_password"] = bbPassword
-				didAddParams = true
-			}
-		}
-		return didAddParams, nil
-	},
-	"telegram": func(bridgeName string, extraParams map[string]string) (bool, error) {
-		idKey, _ := base64.RawStdEncoding.DecodeString("YXBpX2lk")
-		hashKey, _ := base64.RawStdEncoding.DecodeString("YXBpX2hhc2g")
-		_, hasID := extraParams[string(idKey)]
-		_, hasHash := extraParams[string(hashKey)]
-		if !hasID || !hasHash {
-			extraParams[string(idKey)] = "26417019"
-			// This is mostly here so the api key wouldn't show up in automated searches.
-			// It's not really secret, and this key is only used here, cloud bridges have their own key.
-			k, _ := base64.RawStdEncoding.DecodeString("qDP2pQ1LogRjxUYrFUDjDw")
-			d, _ := base64.RawStdEncoding.DecodeString("B9VMuZeZlFk0pkbLcfSDDQ")
-			b, _ := aes.NewCipher(k)
-			b.Decrypt(d, d)
-			extraParams[string(hashKey)] = hex.EncodeToString(d)
+	}
+	newConfig, err := bridgeconfig.ApplyOverlay(cfg.Config, overlay, ctx.StringSlice("set"))
+	if errors.Is(err, bridgeconfig.ErrUnknownPath) {
+		return UserError{fmt.Sprintf("Failed to apply config overrides: %v", err)}
+	} else if err != nil {
+		return fmt.Errorf("failed to apply config overrides: %w", err)
+	}
+	if len(overlay) > 0 || len(ctx.StringSlice("set")) > 0 {
+		err = bridgeconfig.ValidateConfig(cfg.BridgeType, newConfig)
+		if err != nil {
+			return UserError{fmt.Sprintf("Config is invalid after applying overrides:\n%v", err)}
 		}
-		return false, nil
-	},
+	}
+	cfg.Config = newConfig
+	return nil
+}
+
+// applyBridgeConfigOverlay applies the --config-overlay file, or the default overlay file in the bridge directory if it exists.
+func applyBridgeConfigOverlay(ctx *cli.Context, cfg *generatedBridgeConfig, bridgeDir string) error {
+	if overlayPath := ctx.String("config-overlay"); overlayPath != "" {
+		return applyConfigOverlay(ctx, cfg, overlayPath, true)
+	}
+	return applyConfigOverlay(ctx, cfg, filepath.Join(bridgeDir, defaultConfigOverlayFile), false)
+}
+
+// lastGeneratedConfigPath returns the path where the last config generated by bbctl is stored,
+// which is used as the base when upgrading a config that the user has edited.
+func lastGeneratedConfigPath(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), "."+filepath.Base(configPath)+".generated")
+}
+
+func readLastGeneratedConfig(configPath string) (string, error) {
+	data, err := os.ReadFile(lastGeneratedConfigPath(configPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", nil
+	}
+	return string(data), err
+}
+
+func saveLastGeneratedConfig(configPath, config string) {
+	err := os.WriteFile(lastGeneratedConfigPath(configPath), []byte(config), 0600)
+	if err != nil {
+		log.Printf("[yellow]Failed to save copy of generated config for future upgrades: %v[reset]", err)
+	}
 }
 
 type generatedBridgeConfig struct {
 	BridgeType string
 	Config     string
+	// Secret values in the config, which are redacted when the config is printed
+	Secrets []string
+	// The params and template the config was generated with, which are recorded in the config history
+	Params       map[string]string
+	TemplateHash string
 	*RegisterJSON
 }
 
@@ -223,53 +173,64 @@ var bridgeIPSuffix = map[string]string{
 	"linkedin":   "41",
 }
 
-func doGenerateBridgeConfig(ctx *cli.Context, bridge string) (*generatedBridgeConfig, error) {
+// doGenerateBridgeConfig registers the bridge if necessary and renders its config. If readOnly is set, nothing is saved:
+// the bridge isn't registered or re-registered, and generated secrets and changed params or settings aren't stored.
+func doGenerateBridgeConfig(ctx *cli.Context, bridge string, readOnly bool) (*generatedBridgeConfig, error) {
 	if err := validateBridgeName(ctx, bridge); err != nil {
 		return nil, err
 	}
 
-	whoami, err := getCachedWhoami(ctx)
-	if err != nil {
-		return nil, err
-	}
-	existingBridge, ok := whoami.User.Bridges[bridge]
-	var bridgeType string
-	if ok && existingBridge.BridgeState.BridgeType != "" {
-		bridgeType = toInternalBridgeType(existingBridge.BridgeState.BridgeType)
+	standalone := GetEnvConfig(ctx).IsStandalone()
+	var isExisting bool
+	var bridgeType, legacySecret string
+	var err error
+	if standalone {
+		isExisting = standaloneBridgeExists(ctx, bridge)
+		bridgeType, err = getStandaloneBridgeType(ctx, bridge)
+		if err != nil {
+			return nil, err
+		}
 	} else {
-		bridgeType, err = guessOrAskBridgeType(bridge, ctx.String("type"))
+		whoami, err := getCachedWhoami(ctx)
 		if err != nil {
 			return nil, err
 		}
-	}
-	extraParamAsker := askParams[bridgeType]
-	extraParams := make(map[string]string)
-	for _, item := range ctx.StringSlice("param") {
-		parts := strings.SplitN(item, "=", 2)
-		if len(parts) != 2 {
-			return nil, UserError{fmt.Sprintf("Invalid param %q", item)}
+		var existingBridge beeperapi.WhoamiBridge
+		existingBridge, isExisting = whoami.User.Bridges[bridge]
+		if isExisting && existingBridge.BridgeState.BridgeType != "" {
+			bridgeType = toInternalBridgeType(existingBridge.BridgeState.BridgeType)
+		} else {
+			bridgeType, err = guessOrAskBridgeType(bridge, ctx.String("type"))
+			if err != nil {
+				return nil, err
+			}
 		}
-		extraParams[strings.ToLower(parts[0])] = parts[1]
+		legacySecret = whoami.User.AsmuxData.LoginToken
 	}
-	cliParams := maps.Clone(extraParams)
-	if extraParamAsker != nil {
-		var didAddParams bool
-		didAddParams, err = extraParamAsker(bridge, extraParams)
+	if !readOnly {
+		err = ensurePickleKey(ctx, bridge, bridgeType, !isExisting)
 		if err != nil {
 			return nil, err
 		}
-		if didAddParams {
-			formattedParams := make([]string, 0, len(extraParams))
-			for key, value := range extraParams {
-				_, isCli := cliParams[key]
-				if !isCli {
-					formattedParams = append(formattedParams, fmt.Sprintf("--param '%s=%s'", key, value))
-				}
-			}
-			_, _ = fmt.Fprintf(os.Stderr, color.YellowString("To run without specifying parameters interactively, add `%s` next time\n"), strings.Join(formattedParams, " "))
-		}
 	}
-	reg, err := doRegisterBridge(ctx, bridge, bridgeType, false)
+	extraParams, err := resolveBridgeParams(ctx, bridge, bridgeType, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	// Standalone bridges never used the account-wide secret, so they always get their own
+	provisioningSecret, err := getProvisioningSecret(ctx, bridge, !isExisting || standalone, legacySecret, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	reg, err := doRegisterBridge(ctx, bridge, bridgeType, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	err = resolveParamRefs(bridgeType, extraParams)
+	if err != nil {
+		return nil, err
+	}
+	postgresURI, err := getBridgeDatabaseURI(ctx, bridge, bridgeType, readOnly)
 	if err != nil {
 		return nil, err
 	}
@@ -278,33 +239,45 @@ func doGenerateBridgeConfig(ctx *cli.Context, bridge string) (*generatedBridgeCo
 	if dbPrefix != "" {
 		dbPrefix = filepath.Join(dbPrefix, bridge+"-")
 	}
-	websocket := websocketBridges[bridgeType]
+	websocket := websocketBridges[bridgeType] && !standalone
 	var listenAddress string
 	var listenPort uint16
-	if !websocket {
+	if standalone {
+		// The homeserver sends requests to the address in the registration file
+		listenAddress, listenPort, err = parseAppserviceURL(reg.Registration.URL)
+		if err != nil {
+			return nil, UserError{fmt.Sprintf("Invalid registration for %s: %v", bridge, err)}
+		}
+	} else if !websocket {
 		listenAddress, listenPort, reg.Registration.URL = getBridgeWebsocketProxyConfig(bridge, bridgeType)
 	}
-	cfg, err := bridgeconfig.Generate(bridgeType, bridgeconfig.Params{
-		HungryAddress:  reg.HomeserverURL,
-		BeeperDomain:   ctx.String("homeserver"),
-		Websocket:      websocket,
-		AppserviceID:   reg.Registration.ID,
-		ASToken:        reg.Registration.AppToken,
-		HSToken:        reg.Registration.ServerToken,
-		BridgeName:     bridge,
-		Username:       reg.YourUserID.Localpart(),
-		UserID:         reg.YourUserID,
-		Params:         extraParams,
-		DatabasePrefix: dbPrefix,
+	cfg, secrets, err := bridgeconfig.Generate(bridgeType, bridgeconfig.Params{
+		HungryAddress:    reg.HomeserverURL,
+		BeeperDomain:     ctx.String("homeserver"),
+		HomeserverDomain: reg.HomeserverDomain,
+		Standalone:       standalone,
+		Websocket:        websocket,
+		AppserviceID:     reg.Registration.ID,
+		ASToken:          reg.Registration.AppToken,
+		HSToken:          reg.Registration.ServerToken,
+		BridgeName:       bridge,
+		Username:         reg.YourUserID.Localpart(),
+		UserID:           reg.YourUserID,
+		Params:           extraParams,
+		DatabasePrefix:   dbPrefix,
+		PostgresURI:      postgresURI,
 
 		ListenAddr: listenAddress,
 		ListenPort: listenPort,
 
-		ProvisioningSecret: whoami.User.AsmuxData.LoginToken,
+		ProvisioningSecret: provisioningSecret,
 	})
 	return &generatedBridgeConfig{
 		BridgeType:   bridgeType,
 		Config:       cfg,
+		Secrets:      secrets,
+		Params:       extraParams,
+		TemplateHash: bridgeconfig.TemplateHash(bridgeType),
 		RegisterJSON: reg,
 	}, err
 }
@@ -326,24 +299,42 @@ func getBridgeWebsocketProxyConfig(bridgeName, bridgeType string) (listenAddress
 }
 
 func generateBridgeConfig(ctx *cli.Context) error {
-	if ctx.NArg() == 0 {
+	// Auth is checked here rather than in Before, as some subcommands don't need it
+	if err := RequiresAuthOrStandalone(ctx); err != nil {
+		return err
+	} else if ctx.NArg() == 0 {
 		return UserError{"You must specify a bridge to generate a config for"}
 	} else if ctx.NArg() > 1 {
 		return UserError{"Too many arguments specified (flags must come before arguments)"}
 	}
 	bridge := ctx.Args().Get(0)
-	cfg, err := doGenerateBridgeConfig(ctx, bridge)
+	cfg, err := doGenerateBridgeConfig(ctx, bridge, false)
+	if err != nil {
+		return err
+	}
+	err = applyConfigOverlay(ctx, cfg, ctx.String("config-overlay"), true)
 	if err != nil {
 		return err
 	}
 
-	err = doOutputFile(ctx, "Config", cfg.Config)
+	output := cfg.Config
+	redactor := bridgeconfig.NewRedactor(cfg.Secrets)
+	redacted := outputIsTerminal(ctx) && redactor.Contains(output)
+	if redacted {
+		output = redactor.Redact(output)
+	}
+	err = doOutputFile(ctx, "Config", output)
 	if err != nil {
 		return err
+	} else if redacted {
+		_, _ = fmt.Fprintln(os.Stderr, color.YellowString("Secret values were redacted, use --output or redirect the output to save the full config"))
 	}
 	outputPath := ctx.String("output")
 	if outputPath == "-" || outputPath == "" {
 		outputPath = "<config file>"
+	} else {
+		saveLastGeneratedConfig(outputPath, cfg.Config)
+		recordConfigRevision(outputPath, cfg.Config, newConfigRevision("bbctl config", cfg))
 	}
 	var startupCommand, installInstructions string
 	switch cfg.BridgeType {
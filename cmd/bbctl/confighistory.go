@@ -0,0 +1,429 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/exp/maps"
+
+	"github.com/beeper/bridge-manager/bridgeconfig"
+	"github.com/beeper/bridge-manager/log"
+)
+
+var configHistoryFlags = []cli.Flag{
+	&cli.BoolFlag{
+		Name:    "local-dev",
+		Aliases: []string{"l"},
+		Usage:   "Use the config in your current working directory instead of the bridge data directory.",
+		EnvVars: []string{"BEEPER_BRIDGE_LOCAL"},
+	},
+	&cli.StringFlag{
+		Name:    "config-file",
+		Aliases: []string{"c"},
+		Value:   "config.yaml",
+		EnvVars: []string{"BEEPER_BRIDGE_CONFIG_FILE"},
+		Usage:   "File name of the config in the bridge directory.",
+	},
+}
+
+var configHistoryCommand = &cli.Command{
+	Name:      "history",
+	Usage:     "List the previous versions of the config of a bridge",
+	ArgsUsage: "BRIDGE",
+	Flags:     configHistoryFlags,
+	Action:    listConfigHistory,
+}
+
+var configRevertCommand = &cli.Command{
+	Name:      "revert",
+	Usage:     "Restore a previous version of the config of a bridge and keep using it in bbctl run",
+	ArgsUsage: "BRIDGE REVISION",
+	Flags:     configHistoryFlags,
+	Action:    revertBridgeConfig,
+}
+
+var configUnpinCommand = &cli.Command{
+	Name:      "unpin",
+	Usage:     "Let bbctl run regenerate the config of a bridge again after it was reverted",
+	ArgsUsage: "BRIDGE",
+	Flags:     configHistoryFlags,
+	Action:    unpinBridgeConfig,
+}
+
+// The number of config revisions to keep for each bridge.
+const maxConfigRevisions = 50
+
+// configRevision describes a version of a bridge config that was written by bbctl.
+type configRevision struct {
+	ID           int               `json:"-"`
+	Time         time.Time         `json:"time"`
+	Source       string            `json:"source"`
+	Version      string            `json:"bbctl_version"`
+	BridgeType   string            `json:"bridge_type,omitempty"`
+	TemplateHash string            `json:"template_hash,omitempty"`
+	Params       map[string]string `json:"params,omitempty"`
+}
+
+// configHistoryDir returns the directory where the revisions of a config are stored.
+func configHistoryDir(configPath string) string {
+	return filepath.Join(filepath.Dir(configPath), "."+filepath.Base(configPath)+".history")
+}
+
+// configPinPath returns the path of the marker that stops bbctl run from regenerating a reverted config.
+func configPinPath(configPath string) string {
+	return filepath.Join(configHistoryDir(configPath), "pinned")
+}
+
+// readConfigPin returns the revision a config was reverted to, or 0 if the config isn't pinned.
+func readConfigPin(configPath string) (int, error) {
+	data, err := os.ReadFile(configPinPath(configPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	id, err := strconv.Atoi(strings.TrimSpace(string(data)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid pinned revision: %w", err)
+	}
+	return id, nil
+}
+
+func configRevisionPath(configPath string, id int, ext string) string {
+	return filepath.Join(configHistoryDir(configPath), fmt.Sprintf("%04d.%s", id, ext))
+}
+
+// newConfigRevision creates a revision with the details of a generated config. Secret params are redacted.
+func newConfigRevision(source string, cfg *generatedBridgeConfig) *configRevision {
+	rev := &configRevision{Source: source}
+	if cfg == nil {
+		return rev
+	}
+	rev.BridgeType = cfg.BridgeType
+	rev.TemplateHash = cfg.TemplateHash
+	meta := bridgeconfig.GetMetadata(cfg.BridgeType)
+	for name, value := range cfg.Params {
+		if value == "" {
+			continue
+		} else if param := meta.GetParam(name); (param != nil && param.Secret) || slices.Contains(cfg.Secrets, value) {
+			value = bridgeconfig.Redacted
+		}
+		if rev.Params == nil {
+			rev.Params = make(map[string]string)
+		}
+		rev.Params[name] = value
+	}
+	return rev
+}
+
+// listConfigRevisions returns the stored revisions of a config, oldest first.
+func listConfigRevisions(configPath string) ([]*configRevision, error) {
+	entries, err := os.ReadDir(configHistoryDir(configPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	var revisions []*configRevision
+	for _, entry := range entries {
+		idStr, ok := strings.CutSuffix(entry.Name(), ".json")
+		if !ok {
+			continue
+		}
+		id, err := strconv.Atoi(idStr)
+		if err != nil {
+			continue
+		}
+		data, err := os.ReadFile(configRevisionPath(configPath, id, "json"))
+		if err != nil {
+			return nil, err
+		}
+		rev := &configRevision{ID: id}
+		err = json.Unmarshal(data, rev)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse revision %d: %w", id, err)
+		}
+		revisions = append(revisions, rev)
+	}
+	sort.Slice(revisions, func(i, j int) bool {
+		return revisions[i].ID < revisions[j].ID
+	})
+	return revisions, nil
+}
+
+func readConfigRevision(configPath string, id int) (string, error) {
+	data, err := os.ReadFile(configRevisionPath(configPath, id, "yaml"))
+	return string(data), err
+}
+
+// saveConfigRevision stores a config as a new revision, unless it's identical to the latest revision.
+// Old revisions are removed when there are more than maxConfigRevisions, except for the pinned revision.
+func saveConfigRevision(configPath, config string, rev *configRevision) error {
+	revisions, err := listConfigRevisions(configPath)
+	if err != nil {
+		return err
+	}
+	if len(revisions) > 0 {
+		latest, err := readConfigRevision(configPath, revisions[len(revisions)-1].ID)
+		if err == nil && latest == config {
+			return nil
+		}
+		rev.ID = revisions[len(revisions)-1].ID + 1
+	} else {
+		rev.ID = 1
+	}
+	rev.Time = time.Now()
+	rev.Version = Version
+	err = os.MkdirAll(configHistoryDir(configPath), 0700)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(configRevisionPath(configPath, rev.ID, "yaml"), []byte(config), 0600)
+	if err != nil {
+		return err
+	}
+	var data bytes.Buffer
+	enc := json.NewEncoder(&data)
+	enc.SetEscapeHTML(false)
+	enc.SetIndent("", "  ")
+	err = enc.Encode(rev)
+	if err != nil {
+		return err
+	}
+	err = os.WriteFile(configRevisionPath(configPath, rev.ID, "json"), data.Bytes(), 0600)
+	if err != nil {
+		return err
+	}
+	pinned, err := readConfigPin(configPath)
+	if err != nil {
+		return err
+	}
+	excess := len(revisions) + 1 - maxConfigRevisions
+	for _, old := range revisions {
+		if excess <= 0 {
+			break
+		} else if old.ID == pinned {
+			// The revision the config was reverted to is kept, so it can still be restored
+			continue
+		}
+		_ = os.Remove(configRevisionPath(configPath, old.ID, "json"))
+		_ = os.Remove(configRevisionPath(configPath, old.ID, "yaml"))
+		excess--
+	}
+	return nil
+}
+
+// recordConfigRevision stores a config that was written by bbctl in the history. Errors are only logged,
+// as the config itself was already written.
+func recordConfigRevision(configPath, config string, rev *configRevision) {
+	err := saveConfigRevision(configPath, config, rev)
+	if err != nil {
+		log.Printf("[yellow]Failed to save config revision to history: %v[reset]", err)
+	}
+}
+
+// writeBridgeConfig writes a bridge config and records it in the history.
+func writeBridgeConfig(configPath, config string, rev *configRevision) error {
+	err := os.WriteFile(configPath, []byte(config), 0600)
+	if err != nil {
+		return err
+	}
+	recordConfigRevision(configPath, config, rev)
+	return nil
+}
+
+func getBridgeConfigPath(ctx *cli.Context, bridge string) (string, error) {
+	if ctx.Bool("local-dev") {
+		dir, err := os.Getwd()
+		if err != nil {
+			return "", fmt.Errorf("failed to get working directory: %w", err)
+		}
+		return filepath.Join(dir, ctx.String("config-file")), nil
+	}
+	return filepath.Join(GetEnvConfig(ctx).BridgeDataDir, bridge, ctx.String("config-file")), nil
+}
+
+func formatRevisionParams(params map[string]string) string {
+	keys := maps.Keys(params)
+	sort.Strings(keys)
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		parts[i] = fmt.Sprintf("%s=%s", key, params[key])
+	}
+	return strings.Join(parts, " ")
+}
+
+func shortTemplateHash(hash string) string {
+	if len(hash) > 12 {
+		return hash[:12]
+	}
+	return hash
+}
+
+func listConfigHistory(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return UserError{"You must specify a bridge"}
+	} else if ctx.NArg() > 1 {
+		return UserError{"Too many arguments specified (flags must come before arguments)"}
+	}
+	configPath, err := getBridgeConfigPath(ctx, ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	revisions, err := listConfigRevisions(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config history: %w", err)
+	} else if len(revisions) == 0 {
+		fmt.Printf("%s doesn't have any saved revisions\n", configPath)
+		return nil
+	}
+	current, _ := os.ReadFile(configPath)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "REV\tTIME\tSOURCE\tBBCTL\tTEMPLATE\tPARAMS")
+	for _, rev := range revisions {
+		id := strconv.Itoa(rev.ID)
+		if content, err := readConfigRevision(configPath, rev.ID); err == nil && content == string(current) {
+			id += " *"
+		}
+		_, _ = fmt.Fprintf(
+			tw, "%s\t%s\t%s\t%s\t%s\t%s\n", id, rev.Time.Local().Format(time.DateTime), rev.Source, rev.Version,
+			shortTemplateHash(rev.TemplateHash), formatRevisionParams(rev.Params),
+		)
+	}
+	err = tw.Flush()
+	if err != nil {
+		return err
+	}
+	_, _ = fmt.Fprintln(os.Stderr, "\n* = matches the current config")
+	return nil
+}
+
+func revertBridgeConfig(ctx *cli.Context) error {
+	if ctx.NArg() < 2 {
+		return UserError{"You must specify a bridge and a revision (see `bbctl config history`)"}
+	} else if ctx.NArg() > 2 {
+		return UserError{"Too many arguments specified (flags must come before arguments)"}
+	}
+	bridge := ctx.Args().Get(0)
+	id, err := strconv.Atoi(ctx.Args().Get(1))
+	if err != nil {
+		return UserError{fmt.Sprintf("Invalid revision %q", ctx.Args().Get(1))}
+	}
+	configPath, err := getBridgeConfigPath(ctx, bridge)
+	if err != nil {
+		return err
+	}
+	revisions, err := listConfigRevisions(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config history: %w", err)
+	}
+	idx := slices.IndexFunc(revisions, func(rev *configRevision) bool {
+		return rev.ID == id
+	})
+	if idx < 0 {
+		return UserError{fmt.Sprintf("Revision %d not found, see `bbctl config history %s` for available revisions", id, bridge)}
+	}
+	target := revisions[idx]
+	content, err := readConfigRevision(configPath, id)
+	if err != nil {
+		return fmt.Errorf("failed to read revision %d: %w", id, err)
+	}
+	current, err := os.ReadFile(configPath)
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("failed to read current config: %w", err)
+	} else if string(current) == content {
+		log.Printf("[magenta]%s[reset] already matches revision %d", configPath, id)
+		return nil
+	} else if len(current) > 0 {
+		// Keep the current config in the history in case it was edited manually
+		err = saveConfigRevision(configPath, string(current), &configRevision{Source: "before revert"})
+		if err != nil {
+			return fmt.Errorf("failed to save current config to history: %w", err)
+		}
+	}
+	content, err = reapplyProvisioningSecret(ctx, bridge, content)
+	if err != nil {
+		return err
+	}
+	err = writeBridgeConfig(configPath, content, &configRevision{
+		Source:       fmt.Sprintf("revert to %d", id),
+		BridgeType:   target.BridgeType,
+		TemplateHash: target.TemplateHash,
+		Params:       target.Params,
+	})
+	if err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	err = os.WriteFile(configPinPath(configPath), []byte(strconv.Itoa(id)), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to pin config: %w", err)
+	}
+	log.Printf("[green]Reverted[reset] [magenta]%s[reset] to revision %d from %s", configPath, id, target.Time.Local().Format(time.DateTime))
+	log.Printf("`bbctl run` will keep using the reverted config until you run `bbctl config unpin %s`", bridge)
+	return nil
+}
+
+// reapplyProvisioningSecret replaces the provisioning secret in a reverted config with the current one,
+// as old revisions still have the secret from before `bbctl secrets rotate`.
+func reapplyProvisioningSecret(ctx *cli.Context, bridge, config string) (string, error) {
+	secret, err := loadBridgeSecret(ctx, bridge, secretProvisioning)
+	if err != nil {
+		return "", fmt.Errorf("failed to load provisioning secret: %w", err)
+	} else if secret == "" {
+		return config, nil
+	}
+	values, err := bridgeconfig.FindValuesAt(config, provisioningSecretPath)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse reverted config: %w", err)
+	}
+	replacements := make(map[string]string)
+	for _, value := range values {
+		if value != secret {
+			replacements[value] = secret
+		}
+	}
+	if len(replacements) == 0 {
+		return config, nil
+	}
+	config, _, err = bridgeconfig.ReplaceValuesAt(config, provisioningSecretPath, replacements)
+	if err != nil {
+		log.Printf("[yellow]Failed to update the provisioning secret in the reverted config: %v[reset]", err)
+		log.Printf("[yellow]The reverted config has an old provisioning secret, run `bbctl secrets rotate %s` to update it[reset]", bridge)
+		return config, nil
+	}
+	log.Printf("The reverted config had an old provisioning secret, it was replaced with the current one")
+	return config, nil
+}
+
+func unpinBridgeConfig(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return UserError{"You must specify a bridge"}
+	} else if ctx.NArg() > 1 {
+		return UserError{"Too many arguments specified (flags must come before arguments)"}
+	}
+	configPath, err := getBridgeConfigPath(ctx, ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	err = os.Remove(configPinPath(configPath))
+	if errors.Is(err, fs.ErrNotExist) {
+		log.Printf("[magenta]%s[reset] isn't pinned", configPath)
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("failed to unpin config: %w", err)
+	}
+	log.Printf("[green]Unpinned[reset] [magenta]%s[reset], `bbctl run` will regenerate it on the next start", configPath)
+	return nil
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+// saveTestRevisions saves count revisions with distinct content, starting from the given number.
+func saveTestRevisions(t *testing.T, configPath string, start, count int) {
+	t.Helper()
+	for i := start; i < start+count; i++ {
+		err := saveConfigRevision(configPath, fmt.Sprintf("a: %d\n", i), &configRevision{Source: "test"})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func revisionIDs(t *testing.T, configPath string) []int {
+	t.Helper()
+	revisions, err := listConfigRevisions(configPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]int, len(revisions))
+	for i, rev := range revisions {
+		ids[i] = rev.ID
+	}
+	return ids
+}
+
+func idRange(from, to int) []int {
+	var ids []int
+	for i := from; i <= to; i++ {
+		ids = append(ids, i)
+	}
+	return ids
+}
+
+func TestSaveConfigRevision_Prune(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+		// The revision to pin after it's saved, or 0
+		pinned int
+		want   []int
+	}{
+		{name: "under limit", count: 3, want: idRange(1, 3)},
+		{name: "at limit", count: maxConfigRevisions, want: idRange(1, maxConfigRevisions)},
+		{name: "over limit", count: maxConfigRevisions + 3, want: idRange(4, maxConfigRevisions+3)},
+		{
+			name:   "pinned revision is kept",
+			count:  maxConfigRevisions + 3,
+			pinned: 2,
+			want:   append([]int{2}, idRange(5, maxConfigRevisions+3)...),
+		},
+		{
+			name:   "pinned revision within limit",
+			count:  maxConfigRevisions + 3,
+			pinned: 10,
+			want:   idRange(4, maxConfigRevisions+3),
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			configPath := filepath.Join(t.TempDir(), "config.yaml")
+			if test.pinned != 0 {
+				saveTestRevisions(t, configPath, 1, test.pinned)
+				err := os.WriteFile(configPinPath(configPath), []byte(fmt.Sprint(test.pinned)), 0600)
+				if err != nil {
+					t.Fatal(err)
+				}
+				saveTestRevisions(t, configPath, test.pinned+1, test.count-test.pinned)
+			} else {
+				saveTestRevisions(t, configPath, 1, test.count)
+			}
+			if got := revisionIDs(t, configPath); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got revisions %v, want %v", got, test.want)
+			}
+			for _, id := range test.want {
+				if _, err := readConfigRevision(configPath, id); err != nil {
+					t.Errorf("failed to read revision %d: %v", id, err)
+				}
+			}
+		})
+	}
+}
+
+func TestSaveConfigRevision_SkipsDuplicate(t *testing.T) {
+	configPath := filepath.Join(t.TempDir(), "config.yaml")
+	for _, config := range []string{"a: 1\n", "a: 1\n", "a: 2\n", "a: 1\n"} {
+		if err := saveConfigRevision(configPath, config, &configRevision{Source: "test"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := revisionIDs(t, configPath); !reflect.DeepEqual(got, []int{1, 2, 3}) {
+		t.Errorf("got revisions %v, want [1 2 3]", got)
+	}
+}
+
+func TestRevertBridgeConfig(t *testing.T) {
+	const bridge = "sh-signal"
+	const rev1 = "provisioning:\n    shared_secret: old-secret\na: 1\n"
+	const rev2 = "provisioning:\n    shared_secret: old-secret\na: 2\n"
+	tests := []struct {
+		name    string
+		current string
+		// The revision the config was already reverted to, or 0
+		pinned int
+		// The number of revisions saved after the first two, to make the history get pruned
+		extra int
+		// The current provisioning secret in the credential store
+		secret   string
+		revision string
+
+		wantConfig string
+		wantPin    int
+		// The content of the config before reverting should be saved in the history
+		wantBeforeRevert bool
+		wantErr          string
+	}{
+		{
+			name:       "older revision",
+			current:    rev2,
+			revision:   "1",
+			wantConfig: rev1,
+			wantPin:    1,
+		},
+		{
+			name:       "already current",
+			current:    rev2,
+			revision:   "2",
+			wantConfig: rev2,
+		},
+		{
+			name:             "edited config is kept in history",
+			current:          "a: edited\n",
+			revision:         "2",
+			wantConfig:       rev2,
+			wantPin:          2,
+			wantBeforeRevert: true,
+		},
+		{
+			name:             "pinned revision after pruning",
+			current:          "a: edited\n",
+			pinned:           1,
+			extra:            maxConfigRevisions + 10,
+			revision:         "1",
+			wantConfig:       rev1,
+			wantPin:          1,
+			wantBeforeRevert: true,
+		},
+		{
+			name:     "pruned revision",
+			current:  rev2,
+			extra:    maxConfigRevisions + 10,
+			revision: "1",
+			wantErr:  "Revision 1 not found",
+		},
+		{
+			name:     "invalid revision",
+			current:  rev2,
+			revision: "latest",
+			wantErr:  "Invalid revision",
+		},
+		{
+			name:       "current provisioning secret",
+			current:    rev2,
+			secret:     "new-secret",
+			revision:   "1",
+			wantConfig: "provisioning:\n    shared_secret: new-secret\na: 1\n",
+			wantPin:    1,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			flags := append([]cli.Flag{
+				&cli.StringFlag{Name: "env", Value: "prod"},
+				&cli.StringFlag{Name: "credential-store", Value: "file"},
+			}, configHistoryFlags...)
+			ctx := newTestContext(t, &EnvConfig{BridgeDataDir: dataDir}, flags, bridge, test.revision)
+			configPath := filepath.Join(dataDir, bridge, "config.yaml")
+			if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
+				t.Fatal(err)
+			}
+			for _, config := range []string{rev1, rev2} {
+				if err := saveConfigRevision(configPath, config, &configRevision{Source: "test"}); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.pinned != 0 {
+				err := os.WriteFile(configPinPath(configPath), []byte(fmt.Sprint(test.pinned)), 0600)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			saveTestRevisions(t, configPath, 3, test.extra)
+			if err := os.WriteFile(configPath, []byte(test.current), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if test.secret != "" {
+				if err := saveBridgeSecret(ctx, bridge, secretProvisioning, test.secret); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := revertBridgeConfig(ctx)
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			config, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatal(err)
+			} else if string(config) != test.wantConfig {
+				t.Errorf("got config:\n%s\nwant:\n%s", config, test.wantConfig)
+			}
+			if pin, err := readConfigPin(configPath); err != nil {
+				t.Fatal(err)
+			} else if pin != test.wantPin {
+				t.Errorf("config is pinned to %d, want %d", pin, test.wantPin)
+			}
+
+			revisions, err := listConfigRevisions(configPath)
+			if err != nil {
+				t.Fatal(err)
+			}
+			latest := revisions[len(revisions)-1]
+			if test.wantPin != 0 {
+				wantSource := "revert to " + test.revision
+				if latest.Source != wantSource {
+					t.Errorf("latest revision source is %q, want %q", latest.Source, wantSource)
+				} else if content, _ := readConfigRevision(configPath, latest.ID); content != test.wantConfig {
+					t.Errorf("latest revision doesn't match the reverted config:\n%s", content)
+				}
+			}
+			foundBeforeRevert := false
+			for _, rev := range revisions {
+				if rev.Source != "before revert" {
+					continue
+				}
+				foundBeforeRevert = true
+				if content, _ := readConfigRevision(configPath, rev.ID); content != test.current {
+					t.Errorf("revision saved before revert has the wrong content:\n%s", content)
+				}
+			}
+			if foundBeforeRevert != test.wantBeforeRevert {
+				t.Errorf("config before revert saved in history: %t, want %t", foundBeforeRevert, test.wantBeforeRevert)
+			}
+		})
+	}
+}
@@ -0,0 +1,263 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+
+	"github.com/beeper/bridge-manager/bridgeconfig"
+	"github.com/beeper/bridge-manager/log"
+)
+
+// Flags for commands that render a fresh config to compare with the existing config of a bridge.
+var existingConfigFlags = []cli.Flag{
+	&cli.StringFlag{
+		Name:    "type",
+		Aliases: []string{"t"},
+		EnvVars: []string{"BEEPER_BRIDGE_TYPE"},
+		Usage:   "The type of bridge, if it can't be found on the server.",
+	},
+	&cli.StringSliceFlag{
+		Name:    "param",
+		Aliases: []string{"p"},
+		Usage:   "Set a bridge-specific config generation option. Can be specified multiple times for different keys. Format: key=value",
+	},
+	skipParamChecksFlag,
+	configSetFlag,
+	databaseURIFlag,
+	&cli.StringFlag{
+		Name:    "config-overlay",
+		EnvVars: []string{"BEEPER_BRIDGE_CONFIG_OVERLAY"},
+		Usage:   "Path to a YAML file to deep-merge into the generated config. Defaults to config-overlay.yaml in the bridge directory.",
+	},
+	&cli.BoolFlag{
+		Name:    "local-dev",
+		Aliases: []string{"l"},
+		Usage:   "Use the config in your current working directory instead of the bridge data directory.",
+		EnvVars: []string{"BEEPER_BRIDGE_LOCAL"},
+	},
+	&cli.StringFlag{
+		Name:    "config-file",
+		Aliases: []string{"c"},
+		Value:   "config.yaml",
+		EnvVars: []string{"BEEPER_BRIDGE_CONFIG_FILE"},
+		Usage:   "File name of the existing config in the bridge directory.",
+	},
+	&cli.BoolFlag{
+		Name:   "force",
+		Hidden: true,
+	},
+	// Rendering a config for comparison shouldn't change the state of the bridge
+	&cli.BoolFlag{
+		Name:   "no-state",
+		Value:  true,
+		Hidden: true,
+	},
+}
+
+var configDiffCommand = &cli.Command{
+	Name:      "diff",
+	Usage:     "Show how the config of a bridge differs from a freshly generated config",
+	ArgsUsage: "BRIDGE",
+	Flags:     existingConfigFlags,
+	Before:    RequiresAuthOrStandalone,
+	Action:    diffBridgeConfig,
+}
+
+var configUpgradeCommand = &cli.Command{
+	Name:      "upgrade",
+	Usage:     "Apply changes from a freshly generated config to the config of a bridge while keeping your edits",
+	ArgsUsage: "BRIDGE",
+	Flags: append([]cli.Flag{
+		&cli.StringFlag{
+			Name:  "prefer",
+			Usage: "How to resolve values that were changed both by you and in the template: current or new. By default, the config isn't upgraded if there are conflicts.",
+		},
+		&cli.BoolFlag{
+			Name:    "dry-run",
+			Aliases: []string{"n"},
+			Usage:   "Only show the changes that would be made.",
+		},
+	}, existingConfigFlags...),
+	Before: RequiresAuthOrStandalone,
+	Action: upgradeBridgeConfig,
+}
+
+type existingBridgeConfig struct {
+	Path    string
+	Current string
+	Fresh   *generatedBridgeConfig
+}
+
+// loadExistingBridgeConfig reads the current config of a bridge and renders a fresh one to compare it with.
+// If readOnly is set, rendering the fresh config doesn't change any state.
+func loadExistingBridgeConfig(ctx *cli.Context, readOnly bool) (*existingBridgeConfig, error) {
+	if ctx.NArg() == 0 {
+		return nil, UserError{"You must specify a bridge"}
+	} else if ctx.NArg() > 1 {
+		return nil, UserError{"Too many arguments specified (flags must come before arguments)"}
+	}
+	bridge := ctx.Args().Get(0)
+	if err := validateBridgeName(ctx, bridge); err != nil {
+		return nil, err
+	}
+	var bridgeDir string
+	if ctx.Bool("local-dev") {
+		var err error
+		bridgeDir, err = os.Getwd()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get working directory: %w", err)
+		}
+	} else {
+		bridgeDir = filepath.Join(GetEnvConfig(ctx).BridgeDataDir, bridge)
+	}
+	configPath := filepath.Join(bridgeDir, ctx.String("config-file"))
+	current, err := os.ReadFile(configPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, UserError{fmt.Sprintf("%s doesn't exist, use `bbctl run` to generate a config", configPath)}
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read config: %w", err)
+	}
+	// Make sure generating the config doesn't register a new bridge
+	if GetEnvConfig(ctx).IsStandalone() {
+		if !standaloneBridgeExists(ctx, bridge) {
+			return nil, UserError{fmt.Sprintf("You don't have a %s bridge.", color.CyanString(bridge))}
+		}
+	} else {
+		whoami, err := getCachedWhoami(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get whoami: %w", err)
+		} else if _, ok := whoami.User.Bridges[bridge]; !ok {
+			return nil, UserError{fmt.Sprintf("You don't have a %s bridge.", color.CyanString(bridge))}
+		}
+	}
+	fresh, err := doGenerateBridgeConfig(ctx, bridge, readOnly)
+	if err != nil {
+		return nil, err
+	}
+	err = applyBridgeConfigOverlay(ctx, fresh, bridgeDir)
+	if err != nil {
+		return nil, err
+	}
+	return &existingBridgeConfig{Path: configPath, Current: string(current), Fresh: fresh}, nil
+}
+
+// redactValues redacts secrets in the values of a change or conflict. If any of the values is a secret, the others are
+// hidden too, as they're most likely other versions of the same secret.
+func redactValues(redactor *bridgeconfig.Redactor, values ...*string) {
+	hideAll := false
+	for _, value := range values {
+		if strings.HasPrefix(*value, "{") || strings.HasPrefix(*value, "[") {
+			// Mappings and sequences can contain non-secret values too
+			hideAll = false
+			break
+		} else if redactor.Contains(*value) {
+			hideAll = true
+		}
+	}
+	for _, value := range values {
+		if hideAll {
+			*value = bridgeconfig.Redacted
+		} else {
+			*value = redactor.Redact(*value)
+		}
+	}
+}
+
+func printConfigChanges(changes []bridgeconfig.Change, redactor *bridgeconfig.Redactor) {
+	for _, change := range changes {
+		redactValues(redactor, &change.Old, &change.New)
+		switch change.Type {
+		case bridgeconfig.ChangeAdded:
+			fmt.Println(color.GreenString("+ %s: %s", change.Path, change.New))
+		case bridgeconfig.ChangeRemoved:
+			fmt.Println(color.RedString("- %s: %s", change.Path, change.Old))
+		case bridgeconfig.ChangeChanged:
+			fmt.Println(color.YellowString("~ %s: %s -> %s", change.Path, change.Old, change.New))
+		}
+	}
+}
+
+func diffBridgeConfig(ctx *cli.Context) error {
+	cfg, err := loadExistingBridgeConfig(ctx, true)
+	if err != nil {
+		return err
+	}
+	changes, err := bridgeconfig.DiffConfigs(cfg.Current, cfg.Fresh.Config)
+	if err != nil {
+		return err
+	} else if len(changes) == 0 {
+		log.Printf("[magenta]%s[reset] matches a freshly generated config", cfg.Path)
+		return nil
+	}
+	log.Printf("Changes from [magenta]%s[reset] to a freshly generated config:", cfg.Path)
+	printConfigChanges(changes, bridgeconfig.NewRedactor(cfg.Fresh.Secrets))
+	return nil
+}
+
+func upgradeBridgeConfig(ctx *cli.Context) error {
+	prefer := ctx.String("prefer")
+	if prefer != "" && prefer != "current" && prefer != "new" {
+		return UserError{"--prefer must be current or new"}
+	}
+	cfg, err := loadExistingBridgeConfig(ctx, ctx.Bool("dry-run"))
+	if err != nil {
+		return err
+	}
+	base, err := readLastGeneratedConfig(cfg.Path)
+	if err != nil {
+		return fmt.Errorf("failed to read last generated config: %w", err)
+	} else if base == "" {
+		log.Printf("[yellow]The last generated config wasn't stored, so only new options will be added[reset]")
+	}
+	merged, conflicts, err := bridgeconfig.MergeConfigs(base, cfg.Current, cfg.Fresh.Config, prefer == "new")
+	if err != nil {
+		return err
+	}
+	redactor := bridgeconfig.NewRedactor(cfg.Fresh.Secrets)
+	if len(conflicts) > 0 {
+		log.Printf("[yellow]%d options were changed both in your config and in the template:[reset]", len(conflicts))
+		for _, conflict := range conflicts {
+			redactValues(redactor, &conflict.Base, &conflict.Current, &conflict.Updated)
+			fmt.Printf(
+				"%s %s: yours %s, template changed from %s to %s\n", color.RedString("!"), conflict.Path,
+				color.CyanString(conflict.Current), color.CyanString(conflict.Base), color.CyanString(conflict.Updated),
+			)
+		}
+		if prefer == "" {
+			return UserError{"Config not upgraded due to conflicts. Use --prefer current to keep your values or --prefer new to use the new template values."}
+		}
+	}
+	changes, err := bridgeconfig.DiffConfigs(cfg.Current, merged)
+	if err != nil {
+		return err
+	} else if len(changes) == 0 {
+		log.Printf("[magenta]%s[reset] is already up to date", cfg.Path)
+		if !ctx.Bool("dry-run") {
+			saveLastGeneratedConfig(cfg.Path, cfg.Fresh.Config)
+		}
+		return nil
+	}
+	printConfigChanges(changes, redactor)
+	if ctx.Bool("dry-run") {
+		return nil
+	}
+	backupPath := cfg.Path + ".bak"
+	err = os.WriteFile(backupPath, []byte(cfg.Current), 0600)
+	if err != nil {
+		return fmt.Errorf("failed to back up current config: %w", err)
+	}
+	err = writeBridgeConfig(cfg.Path, merged, newConfigRevision("bbctl config upgrade", cfg.Fresh))
+	if err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	saveLastGeneratedConfig(cfg.Path, cfg.Fresh.Config)
+	log.Printf("[green]Upgraded[reset] [magenta]%s[reset] (previous version saved to [magenta]%s[reset])", cfg.Path, backupPath)
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+
+	"github.com/beeper/bridge-manager/bridgeconfig"
+	"github.com/beeper/bridge-manager/log"
+)
+
+var configValidateCommand = &cli.Command{
+	Name:      "validate",
+	Usage:     "Check a bridge config file for invalid YAML, missing keys and values of the wrong type",
+	ArgsUsage: "FILE",
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "type",
+			Aliases: []string{"t"},
+			EnvVars: []string{"BEEPER_BRIDGE_TYPE"},
+			Usage:   "The type of bridge the config is for. By default, it's guessed from the name of the directory the file is in.",
+		},
+	},
+	Action: validateConfigFile,
+}
+
+func validateConfigFile(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return UserError{"You must specify a config file to validate"}
+	} else if ctx.NArg() > 1 {
+		return UserError{"Too many arguments specified (flags must come before arguments)"}
+	}
+	path, err := filepath.Abs(ctx.Args().Get(0))
+	if err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	// Bridge directories created by bbctl run are named after the bridge
+	bridgeType, err := getSavedBridgeType(ctx, filepath.Base(filepath.Dir(path)))
+	if err != nil {
+		return err
+	}
+	err = bridgeconfig.ValidateConfig(bridgeType, string(data))
+	var validationErrs bridgeconfig.ValidationErrors
+	if errors.As(err, &validationErrs) {
+		for _, validationErr := range validationErrs {
+			fmt.Printf("%s %s\n", color.RedString("!"), validationErr.Error())
+		}
+		return UserError{fmt.Sprintf("Found %d problems in %s", len(validationErrs), path)}
+	} else if err != nil {
+		return UserError{fmt.Sprintf("%s is invalid: %v", path, err)}
+	}
+	log.Printf("[magenta]%s[reset] is a valid %s config", path, bridgeType)
+	return nil
+}
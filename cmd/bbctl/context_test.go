@@ -0,0 +1,35 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"path/filepath"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+// newTestContext creates a CLI context with the given env config and flags parsed from args.
+func newTestContext(t *testing.T, envConfig *EnvConfig, flags []cli.Flag, args ...string) *cli.Context {
+	t.Helper()
+	set := flag.NewFlagSet(t.Name(), flag.ContinueOnError)
+	for _, f := range flags {
+		if err := f.Apply(set); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := set.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	if envConfig.Bridges == nil {
+		envConfig.Bridges = make(BridgeSettingsMap)
+	}
+	cfg := &Config{
+		Environments: EnvConfigs{"prod": envConfig},
+		Path:         filepath.Join(t.TempDir(), "config.json"),
+	}
+	ctx := cli.NewContext(nil, set, nil)
+	ctx.Context = context.WithValue(context.Background(), contextKeyConfig, cfg)
+	ctx.Context = context.WithValue(ctx.Context, contextKeyEnvConfig, envConfig)
+	return ctx
+}
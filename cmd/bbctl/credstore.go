@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+)
+
+// The service name that secrets are stored under in the OS credential store.
+const credentialService = "bbctl"
+
+// credentialStore stores secret values like bridge params outside the main config file.
+// Get returns an empty string if the key doesn't exist.
+type credentialStore interface {
+	// Kind is the --credential-store value that selects the store.
+	Kind() string
+	Name() string
+	Get(key string) (string, error)
+	Set(key, value string) error
+	Delete(key string) error
+}
+
+// getCredentialStore returns the credential store selected with --credential-store,
+// or the best available one for the OS if it's set to auto.
+func getCredentialStore(ctx *cli.Context) (credentialStore, error) {
+	return openCredentialStore(ctx, ctx.String("credential-store"))
+}
+
+// getBridgeCredentialStore returns the credential store that the secrets of a bridge are kept in.
+// Once a bridge has secrets in a store, the same store is always used for it, as auto may pick
+// a different store depending on the environment (e.g. secret-tool isn't used without a D-Bus session).
+func getBridgeCredentialStore(ctx *cli.Context, bridge string) (credentialStore, error) {
+	settings, ok := GetEnvConfig(ctx).Bridges[bridge]
+	if !ok || settings == nil || settings.CredentialStore == "" {
+		return getCredentialStore(ctx)
+	}
+	selected := ctx.String("credential-store")
+	if selected != "auto" && selected != "" && selected != settings.CredentialStore {
+		return nil, UserError{fmt.Sprintf(
+			"The secrets of %s are stored in the %s credential store, but --credential-store is set to %s",
+			bridge, settings.CredentialStore, selected,
+		)}
+	}
+	store, err := openCredentialStore(ctx, settings.CredentialStore)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open the %s credential store that the secrets of %s are stored in: %w", settings.CredentialStore, bridge, err)
+	}
+	return store, nil
+}
+
+// useBridgeCredentialStore records the store that the secrets of a bridge were saved in. The config must be saved separately.
+func useBridgeCredentialStore(ctx *cli.Context, bridge string, store credentialStore) {
+	GetEnvConfig(ctx).Bridges.Get(bridge).CredentialStore = store.Kind()
+}
+
+func openCredentialStore(ctx *cli.Context, kind string) (credentialStore, error) {
+	fileStore := &fileCredentialStore{Path: filepath.Join(filepath.Dir(GetConfig(ctx).Path), "secrets.json")}
+	switch kind {
+	case "auto", "":
+		if runtime.GOOS == "darwin" {
+			return keychainCredentialStore{}, nil
+		} else if _, err := exec.LookPath("secret-tool"); err == nil && os.Getenv("DBUS_SESSION_BUS_ADDRESS") != "" {
+			return secretToolCredentialStore{}, nil
+		}
+		return fileStore, nil
+	case "keychain":
+		if runtime.GOOS != "darwin" {
+			return nil, UserError{"The keychain credential store is only available on macOS"}
+		}
+		return keychainCredentialStore{}, nil
+	case "secret-tool":
+		if _, err := exec.LookPath("secret-tool"); err != nil {
+			return nil, UserError{"secret-tool not found, install libsecret-tools or use another credential store"}
+		}
+		return secretToolCredentialStore{}, nil
+	case "file":
+		return fileStore, nil
+	default:
+		return nil, UserError{fmt.Sprintf("Invalid credential store %q (valid values: auto/keychain/secret-tool/file)", kind)}
+	}
+}
+
+// bridgeCredentialKey returns the credential store key for a secret of a bridge in the current environment.
+func bridgeCredentialKey(ctx *cli.Context, bridge, name string) string {
+	return fmt.Sprintf("%s/%s/%s", ctx.String("env"), bridge, name)
+}
+
+func runCredentialCommand(stdin string, name string, args ...string) (string, error) {
+	cmd := exec.Command(name, args...)
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+	err := cmd.Run()
+	if err != nil && stderr.Len() > 0 {
+		err = fmt.Errorf("%w: %s", err, strings.TrimSpace(stderr.String()))
+	}
+	return stdout.String(), err
+}
+
+// keychainCredentialStore stores secrets in the macOS login keychain using the security command.
+type keychainCredentialStore struct{}
+
+// The exit code of the security command when an item isn't found
+const keychainItemNotFound = 44
+
+func (keychainCredentialStore) Kind() string {
+	return "keychain"
+}
+
+func (keychainCredentialStore) Name() string {
+	return "macOS keychain"
+}
+
+func (keychainCredentialStore) Get(key string) (string, error) {
+	output, err := runCredentialCommand("", "security", "find-generic-password", "-s", credentialService, "-a", key, "-w")
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && exitErr.ExitCode() == keychainItemNotFound {
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to read %s from keychain: %w", key, err)
+	}
+	return strings.TrimSuffix(output, "\n"), nil
+}
+
+func (keychainCredentialStore) Set(key, value string) error {
+	// The command is passed through stdin in interactive mode so the secret doesn't show up in the process list
+	command := fmt.Sprintf("add-generic-password -U -s %s -a %s -X %s\n", credentialService, key, hex.EncodeToString([]byte(value)))
+	_, err := runCredentialCommand(command, "security", "-i")
+	if err != nil {
+		return fmt.Errorf("failed to save %s to keychain: %w", key, err)
+	}
+	return nil
+}
+
+func (keychainCredentialStore) Delete(key string) error {
+	_, err := runCredentialCommand("", "security", "delete-generic-password", "-s", credentialService, "-a", key)
+	var exitErr *exec.ExitError
+	if err != nil && !(errors.As(err, &exitErr) && exitErr.ExitCode() == keychainItemNotFound) {
+		return fmt.Errorf("failed to delete %s from keychain: %w", key, err)
+	}
+	return nil
+}
+
+// secretToolCredentialStore stores secrets in the freedesktop secret service (e.g. GNOME Keyring) using secret-tool.
+type secretToolCredentialStore struct{}
+
+func (secretToolCredentialStore) Kind() string {
+	return "secret-tool"
+}
+
+func (secretToolCredentialStore) Name() string {
+	return "secret service"
+}
+
+func (secretToolCredentialStore) Get(key string) (string, error) {
+	output, err := runCredentialCommand("", "secret-tool", "lookup", "service", credentialService, "account", key)
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && err == error(exitErr) && output == "" {
+		// secret-tool exits with 1 without any output if the item doesn't exist.
+		// If it printed an error (e.g. because the secret service isn't reachable), err includes it and isn't returned as-is.
+		return "", nil
+	} else if err != nil {
+		return "", fmt.Errorf("failed to read %s from secret service: %w", key, err)
+	}
+	return output, nil
+}
+
+func (secretToolCredentialStore) Set(key, value string) error {
+	_, err := runCredentialCommand(
+		value, "secret-tool", "store", "--label", fmt.Sprintf("bbctl: %s", key),
+		"service", credentialService, "account", key,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to save %s to secret service: %w", key, err)
+	}
+	return nil
+}
+
+func (secretToolCredentialStore) Delete(key string) error {
+	_, err := runCredentialCommand("", "secret-tool", "clear", "service", credentialService, "account", key)
+	if err != nil {
+		return fmt.Errorf("failed to delete %s from secret service: %w", key, err)
+	}
+	return nil
+}
+
+// fileCredentialStore is the fallback for systems without a credential store.
+// The secrets are stored in a file next to the config that's only readable by the current user.
+type fileCredentialStore struct {
+	Path string
+}
+
+func (fcs *fileCredentialStore) Kind() string {
+	return "file"
+}
+
+func (fcs *fileCredentialStore) Name() string {
+	return fcs.Path
+}
+
+func (fcs *fileCredentialStore) load() (map[string]string, error) {
+	data, err := os.ReadFile(fcs.Path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return make(map[string]string), nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read %s: %w", fcs.Path, err)
+	}
+	secrets := make(map[string]string)
+	err = json.Unmarshal(data, &secrets)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", fcs.Path, err)
+	}
+	return secrets, nil
+}
+
+func (fcs *fileCredentialStore) save(secrets map[string]string) error {
+	data, err := json.MarshalIndent(secrets, "", "  ")
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(fcs.Path), 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create directory for %s: %w", fcs.Path, err)
+	}
+	err = os.WriteFile(fcs.Path, data, 0600)
+	if err != nil {
+		return fmt.Errorf("failed to write %s: %w", fcs.Path, err)
+	}
+	// WriteFile doesn't change the mode of existing files
+	return os.Chmod(fcs.Path, 0600)
+}
+
+func (fcs *fileCredentialStore) Get(key string) (string, error) {
+	secrets, err := fcs.load()
+	if err != nil {
+		return "", err
+	}
+	return secrets[key], nil
+}
+
+func (fcs *fileCredentialStore) Set(key, value string) error {
+	secrets, err := fcs.load()
+	if err != nil {
+		return err
+	}
+	secrets[key] = value
+	return fcs.save(secrets)
+}
+
+func (fcs *fileCredentialStore) Delete(key string) error {
+	secrets, err := fcs.load()
+	if err != nil {
+		return err
+	} else if _, ok := secrets[key]; !ok {
+		return nil
+	}
+	delete(secrets, key)
+	return fcs.save(secrets)
+}
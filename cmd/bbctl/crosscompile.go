@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strings"
+
+	"github.com/beeper/bridge-manager/log"
+)
+
+// compileTarget is a platform to compile bridges for, parsed from os/arch or os/arch/variant (e.g. linux/arm/v7).
+type compileTarget struct {
+	GOOS   string
+	GOARCH string
+	GOARM  string
+}
+
+func parseCompileTarget(val string) (*compileTarget, error) {
+	parts := strings.Split(val, "/")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] == "" || parts[1] == "" {
+		return nil, UserError{fmt.Sprintf("Invalid target %q (expected os/arch or os/arch/variant, e.g. linux/arm64 or linux/arm/v7)", val)}
+	}
+	target := &compileTarget{GOOS: parts[0], GOARCH: parts[1]}
+	if len(parts) == 3 {
+		if target.GOARCH != "arm" {
+			return nil, UserError{fmt.Sprintf("Invalid target %q: variants are only supported for arm", val)}
+		}
+		switch parts[2] {
+		case "v5", "v6", "v7":
+			target.GOARM = strings.TrimPrefix(parts[2], "v")
+		default:
+			return nil, UserError{fmt.Sprintf("Invalid target %q: unsupported arm variant %s", val, parts[2])}
+		}
+	}
+	return target, nil
+}
+
+func hostCompileTarget() *compileTarget {
+	return &compileTarget{GOOS: runtime.GOOS, GOARCH: runtime.GOARCH}
+}
+
+// IsHost returns true if binaries built for the target can be run on the current machine.
+func (ct *compileTarget) IsHost() bool {
+	return ct.GOOS == runtime.GOOS && ct.GOARCH == runtime.GOARCH
+}
+
+// Platform returns the target in the os/arch format used by CI and artifact sources.
+// 32-bit arm defaults to v7 like the CI builds, so only other variants are included in the platform.
+func (ct *compileTarget) Platform() string {
+	if ct.GOARM != "" && ct.GOARM != "7" {
+		return fmt.Sprintf("%s/%s/v%s", ct.GOOS, ct.GOARCH, ct.GOARM)
+	}
+	return fmt.Sprintf("%s/%s", ct.GOOS, ct.GOARCH)
+}
+
+// DirName returns the name of the directory where binaries for the target are stored.
+func (ct *compileTarget) DirName() string {
+	return strings.ReplaceAll(ct.Platform(), "/", "-")
+}
+
+func (ct *compileTarget) String() string {
+	return ct.Platform()
+}
+
+// crossCompilerTriples are the GNU target triples of C cross-compilers for each platform.
+var crossCompilerTriples = map[string]string{
+	"linux/amd64": "x86_64-linux-gnu",
+	"linux/arm64": "aarch64-linux-gnu",
+	"linux/arm":   "arm-linux-gnueabihf",
+}
+
+// findCrossCompiler finds a C compiler for the given target, as bridges need cgo for libolm and SQLite.
+// The CC environment variable takes precedence, then a GNU cross-compiler for the target triple, then zig.
+func findCrossCompiler(target *compileTarget) (string, error) {
+	if cc := os.Getenv("CC"); cc != "" {
+		return cc, nil
+	}
+	triple, ok := crossCompilerTriples[target.GOOS+"/"+target.GOARCH]
+	if !ok || target.GOOS != runtime.GOOS {
+		return "", UserError{fmt.Sprintf("Cross-compiling bridges from %s/%s to %s is not supported. Set the CC environment variable to a C compiler for the target to try anyway.", runtime.GOOS, runtime.GOARCH, target)}
+	}
+	if path, err := exec.LookPath(triple + "-gcc"); err == nil {
+		return path, nil
+	}
+	if path, err := exec.LookPath("zig"); err == nil {
+		return fmt.Sprintf("%s cc -target %s", path, triple), nil
+	}
+	return "", UserError{fmt.Sprintf("No C cross-compiler found for %s. Install %s-gcc or zig, or set the CC environment variable.", target, triple)}
+}
+
+// Env returns the environment variables for building with the Go toolchain for the target.
+// Builds for the host platform use the default environment.
+func (ct *compileTarget) Env() ([]string, error) {
+	if ct.IsHost() && ct.GOARM == "" {
+		return nil, nil
+	}
+	env := append(os.Environ(), "GOOS="+ct.GOOS, "GOARCH="+ct.GOARCH, "CGO_ENABLED=1")
+	if ct.GOARM != "" {
+		env = append(env, "GOARM="+ct.GOARM)
+	}
+	if !ct.IsHost() {
+		cc, err := findCrossCompiler(ct)
+		if err != nil {
+			return nil, err
+		}
+		log.Printf("Using [cyan]%s[reset] as the C compiler for [cyan]%s[reset]", cc, ct)
+		env = append(env, "CC="+cc)
+	}
+	return env, nil
+}
+
+// compileGoBridgeForTarget clones or updates the bridge repo in a target-specific build directory and compiles it.
+// It returns the path to the compiled binary inside the build directory.
+func compileGoBridgeForTarget(ctx context.Context, dataDir, ciBridgeType, binaryName string, target *compileTarget, noUpdate bool, src compileSource) (string, error) {
+	env, err := target.Env()
+	if err != nil {
+		return "", err
+	}
+	// Native builds share the build directory with `bbctl run --compile`
+	native := env == nil
+	buildDir := filepath.Join(dataDir, "compile", binaryName)
+	if !native {
+		buildDir = filepath.Join(dataDir, "compile", target.DirName(), binaryName)
+	}
+	binaryPath := filepath.Join(buildDir, binaryName)
+	err = compileGoBridge(ctx, buildDir, binaryPath, ciBridgeType, noUpdate && native, env, src, target.Platform())
+	if err != nil {
+		return "", err
+	}
+	return binaryPath, nil
+}
+
+func getGitCommit(ctx context.Context, repoDir string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", "rev-parse", "HEAD")
+	cmd.Dir = repoDir
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get commit of %s: %w", repoDir, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// copyExecutable copies a compiled binary and its build record to the given path, replacing any existing files atomically.
+func copyExecutable(from, to string) error {
+	err := copyFile(from, to, 0755)
+	if err != nil {
+		return err
+	}
+	record, err := readCompileRecord(from)
+	if err != nil {
+		return err
+	} else if record != nil {
+		return record.Save(to)
+	}
+	return nil
+}
+
+func copyFile(from, to string, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(to), 0700)
+	if err != nil {
+		return err
+	}
+	src, err := os.Open(from)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.CreateTemp(filepath.Dir(to), "tmp-"+filepath.Base(to)+"-*")
+	if err != nil {
+		return fmt.Errorf("failed to open temp file: %w", err)
+	}
+	defer func() {
+		_ = dst.Close()
+		_ = os.Remove(dst.Name())
+	}()
+	_, err = io.Copy(dst, src)
+	if err != nil {
+		return fmt.Errorf("failed to copy file: %w", err)
+	}
+	_ = dst.Close()
+	err = os.Chmod(dst.Name(), mode)
+	if err != nil {
+		return fmt.Errorf("failed to chmod file: %w", err)
+	}
+	return os.Rename(dst.Name(), to)
+}
+
+// binaryPathForTarget returns the path where installed binaries for the given target are stored.
+func binaryPathForTarget(dataDir, binaryName string, target *compileTarget) string {
+	if target.IsHost() && target.GOARM == "" {
+		return filepath.Join(dataDir, "binaries", binaryName)
+	}
+	return filepath.Join(dataDir, "binaries", target.DirName(), binaryName)
+}
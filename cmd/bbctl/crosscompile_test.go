@@ -0,0 +1,39 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestParseCompileTarget(t *testing.T) {
+	tests := []struct {
+		input        string
+		want         compileTarget
+		wantPlatform string
+		wantErr      bool
+	}{
+		{"linux/amd64", compileTarget{GOOS: "linux", GOARCH: "amd64"}, "linux/amd64", false},
+		{"darwin/arm64", compileTarget{GOOS: "darwin", GOARCH: "arm64"}, "darwin/arm64", false},
+		{"linux/arm/v7", compileTarget{GOOS: "linux", GOARCH: "arm", GOARM: "7"}, "linux/arm", false},
+		{"linux/arm/v6", compileTarget{GOOS: "linux", GOARCH: "arm", GOARM: "6"}, "linux/arm/v6", false},
+		{"linux", compileTarget{}, "", true},
+		{"linux/", compileTarget{}, "", true},
+		{"/amd64", compileTarget{}, "", true},
+		{"linux/arm/v8", compileTarget{}, "", true},
+		{"linux/arm64/v8", compileTarget{}, "", true},
+		{"linux/arm/v7/extra", compileTarget{}, "", true},
+	}
+	for _, test := range tests {
+		got, err := parseCompileTarget(test.input)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parseCompileTarget(%q) error = %v, want error: %t", test.input, err, test.wantErr)
+		} else if err != nil {
+			if _, ok := err.(UserError); !ok {
+				t.Errorf("parseCompileTarget(%q) returned %T, want UserError", test.input, err)
+			}
+		} else if *got != test.want {
+			t.Errorf("parseCompileTarget(%q) = %+v, want %+v", test.input, *got, test.want)
+		} else if got.Platform() != test.wantPlatform {
+			t.Errorf("parseCompileTarget(%q).Platform() = %q, want %q", test.input, got.Platform(), test.wantPlatform)
+		}
+	}
+}
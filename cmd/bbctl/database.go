@@ -0,0 +1,395 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/beeper/bridge-manager/bridgeconfig"
+	"github.com/beeper/bridge-manager/log"
+)
+
+var databaseURIFlag = &cli.StringFlag{
+	Name:    "database-uri",
+	EnvVars: []string{"BEEPER_BRIDGE_DATABASE_URI"},
+	Usage:   "PostgreSQL URI for the bridge database, where {bridge} is replaced with the bridge name. Use sqlite to use SQLite even if the env has a PostgreSQL URI, or default to go back to the env setting. Saved for future runs.",
+}
+
+var dbCommand = &cli.Command{
+	Name:  "db",
+	Usage: "Manage bridge databases",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "migrate-to-postgres",
+			Usage:     "Copy the SQLite database of a bridge to PostgreSQL and switch the bridge to use it",
+			ArgsUsage: "BRIDGE",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "type",
+					Aliases: []string{"t"},
+					EnvVars: []string{"BEEPER_BRIDGE_TYPE"},
+					Usage:   "The type of bridge, if it can't be guessed from the name.",
+				},
+				databaseURIFlag,
+				&cli.StringFlag{
+					Name:    "config-file",
+					Aliases: []string{"c"},
+					Value:   "config.yaml",
+					EnvVars: []string{"BEEPER_BRIDGE_CONFIG_FILE"},
+					Usage:   "File name of the existing config in the bridge directory.",
+				},
+				&cli.BoolFlag{
+					Name:    "yes",
+					Aliases: []string{"y"},
+					Usage:   "Don't ask for confirmation.",
+				},
+			},
+			Action: migrateToPostgres,
+		},
+	},
+}
+
+// The database URI setting value that forces SQLite even if the env has a PostgreSQL URI.
+const databaseURISQLite = "sqlite"
+
+// bridgeDatabaseIdentifier returns the name used for the per-bridge database or schema.
+func bridgeDatabaseIdentifier(bridge string) string {
+	return strings.ReplaceAll(bridge, "-", "_")
+}
+
+// renderDatabaseURI fills in the bridge name in a database URI template and checks that it's a PostgreSQL URI.
+func renderDatabaseURI(uriTemplate, bridge string) (string, error) {
+	rendered := strings.ReplaceAll(uriTemplate, "{bridge}", bridgeDatabaseIdentifier(bridge))
+	parsed, err := url.Parse(rendered)
+	if err != nil {
+		return "", UserError{fmt.Sprintf("Invalid database URI: %v", err)}
+	} else if parsed.Scheme != "postgres" && parsed.Scheme != "postgresql" {
+		return "", UserError{fmt.Sprintf("Invalid database URI %q: only postgres:// URIs are supported", uriTemplate)}
+	}
+	return rendered, nil
+}
+
+// getDatabaseURITemplate returns the database URI template for a bridge from --database-uri, the bridge settings or
+// the env config, as well as the value to store in the bridge settings. An empty template means SQLite.
+func getDatabaseURITemplate(ctx *cli.Context, bridge string) (uriTemplate, setting string, err error) {
+	if settings, ok := GetEnvConfig(ctx).Bridges[bridge]; ok && settings != nil {
+		setting = settings.DatabaseURI
+	}
+	if ctx.IsSet("database-uri") {
+		setting = ctx.String("database-uri")
+		if setting == "default" {
+			setting = ""
+		} else if setting != databaseURISQLite {
+			if _, err = renderDatabaseURI(setting, bridge); err != nil {
+				return "", "", err
+			}
+		}
+	}
+	uriTemplate = setting
+	if uriTemplate == "" {
+		uriTemplate = GetEnvConfig(ctx).DatabaseURI
+	}
+	if uriTemplate == databaseURISQLite {
+		uriTemplate = ""
+	}
+	return
+}
+
+// saveDatabaseURISetting saves the database URI template of a bridge if it changed.
+func saveDatabaseURISetting(ctx *cli.Context, bridge, setting string) error {
+	settings := GetEnvConfig(ctx).Bridges.Get(bridge)
+	if settings.DatabaseURI == setting {
+		return nil
+	}
+	settings.DatabaseURI = setting
+	err := GetConfig(ctx).Save()
+	if err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
+
+// getBridgeDatabaseURI returns the PostgreSQL URI to put in the config of a bridge, or an empty string to use SQLite.
+// If --database-uri is set, it's saved in the bridge settings, unless readOnly is set.
+func getBridgeDatabaseURI(ctx *cli.Context, bridge, bridgeType string, readOnly bool) (string, error) {
+	uriTemplate, setting, err := getDatabaseURITemplate(ctx, bridge)
+	if err != nil {
+		return "", err
+	} else if !readOnly {
+		if err = saveDatabaseURISetting(ctx, bridge, setting); err != nil {
+			return "", err
+		}
+	}
+	if uriTemplate == "" {
+		return "", nil
+	}
+	perBridge := setting != ""
+	if !bridgeconfig.GetMetadata(bridgeType).SupportsPostgres() {
+		if perBridge {
+			return "", UserError{fmt.Sprintf("%s bridges only support SQLite, use --database-uri default to remove the PostgreSQL URI", bridgeType)}
+		}
+		log.Printf("%s bridges only support SQLite, ignoring the PostgreSQL URI of the env", bridgeType)
+		return "", nil
+	}
+	return renderDatabaseURI(uriTemplate, bridge)
+}
+
+// findSQLiteDatabase returns the path of the SQLite database in an existing bridge config.
+func findSQLiteDatabase(configPath string) (string, error) {
+	data, err := os.ReadFile(configPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		return "", UserError{fmt.Sprintf("%s doesn't exist, the bridge must be run with SQLite before it can be migrated", configPath)}
+	} else if err != nil {
+		return "", fmt.Errorf("failed to read config: %w", err)
+	}
+	var cfg struct {
+		Database struct {
+			Type string `yaml:"type"`
+			URI  string `yaml:"uri"`
+		} `yaml:"database"`
+		AppService struct {
+			// Python bridges have the URI directly in appservice.database,
+			// while older Go bridges have a database section inside appservice.
+			Database yaml.Node `yaml:"database"`
+		} `yaml:"appservice"`
+	}
+	err = yaml.Unmarshal(data, &cfg)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse config: %w", err)
+	}
+	dbType, uri := cfg.Database.Type, cfg.Database.URI
+	if uri == "" {
+		asDB := cfg.AppService.Database
+		if asDB.Kind == yaml.ScalarNode {
+			uri = asDB.Value
+		} else if asDB.Kind == yaml.MappingNode {
+			var section struct {
+				Type string `yaml:"type"`
+				URI  string `yaml:"uri"`
+			}
+			if err = asDB.Decode(&section); err != nil {
+				return "", fmt.Errorf("failed to parse database config: %w", err)
+			}
+			dbType, uri = section.Type, section.URI
+		}
+	}
+	if dbType == "postgres" || strings.HasPrefix(uri, "postgres://") || strings.HasPrefix(uri, "postgresql://") {
+		return "", UserError{"The bridge is already using PostgreSQL"}
+	} else if uri == "" {
+		return "", UserError{fmt.Sprintf("Couldn't find the database URI in %s", configPath)}
+	}
+	path := strings.TrimPrefix(strings.TrimPrefix(uri, "sqlite:"), "file:")
+	path, _, _ = strings.Cut(path, "?")
+	if !filepath.IsAbs(path) {
+		path = filepath.Join(filepath.Dir(configPath), path)
+	}
+	return path, nil
+}
+
+// pgloaderTarget returns the URI to pass to pgloader and the schema to load the tables into, if the URI has one.
+// pgloader doesn't support the search_path parameter, so it's removed from the URI.
+func pgloaderTarget(uri string) (string, string, error) {
+	parsed, err := url.Parse(uri)
+	if err != nil {
+		return "", "", err
+	}
+	parsed.Scheme = "postgresql"
+	query := parsed.Query()
+	schema := query.Get("search_path")
+	query.Del("search_path")
+	parsed.RawQuery = query.Encode()
+	return parsed.String(), schema, nil
+}
+
+func makePgloaderCommand(sqlitePath, target, schema string) string {
+	var cmd strings.Builder
+	_, _ = fmt.Fprintf(&cmd, "LOAD DATABASE\n    FROM sqlite://%s\n    INTO %s\n\n", sqlitePath, target)
+	// The tables are created by the bridge itself, as the ones pgloader would create don't match the bridge schema.
+	// Truncating removes the rows the bridge inserted on the first start.
+	cmd.WriteString("WITH data only, truncate, reset sequences\n\n")
+	if schema != "" {
+		_, _ = fmt.Fprintf(&cmd, "SET PostgreSQL PARAMETERS search_path TO '%s'\n\n", schema)
+	}
+	// SQLite stores booleans as integers
+	cmd.WriteString("CAST type boolean to boolean using tinyint-to-boolean\n")
+	cmd.WriteString(";\n")
+	return cmd.String()
+}
+
+// bridgeStartedMessage is logged by bridgev2 bridges after all database upgrades are done.
+const bridgeStartedMessage = "Bridge started"
+
+// createBridgeSchema starts the bridge with a copy of its config that points at the PostgreSQL database,
+// so the bridge creates its own tables, and stops it once it has started.
+func createBridgeSchema(ctx context.Context, binaryPath, configPath, uri string) error {
+	config, err := os.ReadFile(configPath)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %w", err)
+	}
+	tempConfig, err := bridgeconfig.ApplyOverlay(string(config), nil, []string{
+		"database.type=postgres",
+		"database.uri=" + bridgeconfig.YAMLString(uri),
+		// Only log to stdout, so the real log file isn't touched and the startup message can be detected
+		"logging.writers=[{type: stdout, format: json}]",
+	})
+	if err != nil {
+		return fmt.Errorf("failed to make temporary config: %w", err)
+	}
+	bridgeDir := filepath.Dir(configPath)
+	tempConfigFile, err := os.CreateTemp(bridgeDir, ".bbctl-migrate-*.yaml")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary config: %w", err)
+	}
+	defer os.Remove(tempConfigFile.Name())
+	_, err = tempConfigFile.WriteString(tempConfig)
+	_ = tempConfigFile.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write temporary config: %w", err)
+	}
+
+	cmd := exec.CommandContext(ctx, binaryPath, "-c", tempConfigFile.Name(), "--no-update")
+	cmd.Dir = bridgeDir
+	cmd.Stderr = os.Stderr
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		return err
+	}
+	err = cmd.Start()
+	if err != nil {
+		return fmt.Errorf("failed to start bridge: %w", err)
+	}
+	started := make(chan struct{})
+	exited := make(chan error, 1)
+	go func() {
+		isStarted := false
+		scanner := bufio.NewScanner(stdout)
+		scanner.Buffer(nil, 1024*1024)
+		for scanner.Scan() {
+			var line struct {
+				Level   string `json:"level"`
+				Message string `json:"message"`
+				Error   string `json:"error"`
+			}
+			if json.Unmarshal(scanner.Bytes(), &line) != nil {
+				_, _ = fmt.Fprintln(os.Stderr, scanner.Text())
+			} else if line.Message == bridgeStartedMessage && !isStarted {
+				isStarted = true
+				close(started)
+			} else if line.Level == "error" || line.Level == "fatal" {
+				log.Printf("[red]%s: %s[reset]", line.Message, line.Error)
+			}
+		}
+		exited <- cmd.Wait()
+	}()
+	select {
+	case <-started:
+		stopBridgeForRestart(cmd.Process, exited)
+		return nil
+	case err = <-exited:
+		if err == nil {
+			err = fmt.Errorf("bridge exited")
+		}
+		return fmt.Errorf("bridge didn't start with the PostgreSQL database: %w", err)
+	}
+}
+
+func migrateToPostgres(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return UserError{"You must specify a bridge to migrate"}
+	} else if ctx.NArg() > 1 {
+		return UserError{"Too many arguments specified (flags must come before arguments)"}
+	}
+	bridge := ctx.Args().Get(0)
+	bridgeType, err := getSavedBridgeType(ctx, bridge)
+	if err != nil {
+		return err
+	} else if meta := bridgeconfig.GetMetadata(bridgeType); !meta.SupportsPostgres() {
+		return UserError{fmt.Sprintf("%s bridges only support SQLite", bridgeType)}
+	} else if !meta.IsBridgeV2() {
+		return UserError{fmt.Sprintf("Migrating %s bridges isn't supported, as bbctl can only create the database schema of bridgev2 bridges", bridgeType)}
+	}
+	bin, err := findBridgeBinary(ctx, bridge, bridgeType)
+	if err != nil {
+		return err
+	} else if _, err = os.Stat(bin.Path); err != nil {
+		return UserError{fmt.Sprintf("Bridge binary %s not found, the bridge must be run with SQLite before it can be migrated", bin.Path)}
+	}
+	configPath := filepath.Join(GetEnvConfig(ctx).BridgeDataDir, bridge, ctx.String("config-file"))
+	sqlitePath, err := findSQLiteDatabase(configPath)
+	if err != nil {
+		return err
+	} else if _, err = os.Stat(sqlitePath); err != nil {
+		return UserError{fmt.Sprintf("SQLite database %s not found", sqlitePath)}
+	}
+	// The URI is only saved after the migration is done, so the bridge doesn't start with an empty database
+	uriTemplate, _, err := getDatabaseURITemplate(ctx, bridge)
+	if err != nil {
+		return err
+	} else if uriTemplate == "" {
+		return UserError{"No PostgreSQL URI configured, pass one with --database-uri or set database_uri in the env config"}
+	}
+	uri, err := renderDatabaseURI(uriTemplate, bridge)
+	if err != nil {
+		return err
+	}
+	target, schema, err := pgloaderTarget(uri)
+	if err != nil {
+		return fmt.Errorf("failed to parse database URI: %w", err)
+	}
+	pgloader, err := exec.LookPath("pgloader")
+	if err != nil {
+		return UserError{"pgloader is required for migrating the database, please install it with your OS package manager"}
+	}
+
+	if !ctx.Bool("yes") {
+		var confirmation bool
+		err = survey.AskOne(&survey.Confirm{Message: fmt.Sprintf("Make sure %s is stopped before continuing. It will be started briefly to create the tables in PostgreSQL. Migrate the database now?", bridge)}, &confirmation)
+		if err != nil {
+			return err
+		} else if !confirmation {
+			return fmt.Errorf("migration cancelled")
+		}
+	}
+
+	log.Printf("Starting [cyan]%s[reset] to create the database schema in PostgreSQL", bridge)
+	err = createBridgeSchema(ctx.Context, bin.Path, configPath, uri)
+	if err != nil {
+		return err
+	}
+	cmdFile, err := os.CreateTemp("", "bbctl-pgloader-*.load")
+	if err != nil {
+		return fmt.Errorf("failed to create pgloader command file: %w", err)
+	}
+	defer os.Remove(cmdFile.Name())
+	_, err = cmdFile.WriteString(makePgloaderCommand(sqlitePath, target, schema))
+	_ = cmdFile.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write pgloader command file: %w", err)
+	}
+	log.Printf("Copying [magenta]%s[reset] to PostgreSQL with pgloader", sqlitePath)
+	err = makeCmd(ctx.Context, filepath.Dir(configPath), pgloader, "--on-error-stop", cmdFile.Name()).Run()
+	if err != nil {
+		return fmt.Errorf("pgloader failed: %w", err)
+	}
+
+	// Save the URI for the bridge, so it keeps using the database even if the env setting changes
+	err = saveDatabaseURISetting(ctx, bridge, uriTemplate)
+	if err != nil {
+		return err
+	}
+	log.Printf("[green]Migrated %s to PostgreSQL.[reset] The SQLite database was left at [magenta]%s[reset] as a backup.", bridge, sqlitePath)
+	log.Printf("Start the bridge with `bbctl run %s` to regenerate the config with the new database", bridge)
+	return nil
+}
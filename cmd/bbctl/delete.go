@@ -23,7 +23,7 @@ var deleteCommand = &cli.Command{
 	Usage:     "Delete a bridge and all associated rooms on the Beeper servers",
 	ArgsUsage: "BRIDGE",
 	Action:    deleteBridge,
-	Before:    RequiresAuth,
+	Before:    RequiresAuthOrStandalone,
 	Flags: []cli.Flag{
 		&cli.BoolFlag{
 			Name:    "local-dev",
@@ -65,7 +65,12 @@ func deleteBridge(ctx *cli.Context) error {
 	}
 	homeserver := ctx.String("homeserver")
 	accessToken := GetEnvConfig(ctx).AccessToken
-	if !ctx.Bool("force") {
+	standalone := GetEnvConfig(ctx).IsStandalone()
+	if standalone && !ctx.Bool("force") {
+		if !standaloneBridgeExists(ctx, bridge) {
+			return UserError{fmt.Sprintf("You don't have a %s bridge.", color.CyanString(bridge))}
+		}
+	} else if !ctx.Bool("force") {
 		whoami, err := getCachedWhoami(ctx)
 		if err != nil {
 			return fmt.Errorf("failed to get whoami: %w", err)
@@ -86,11 +91,27 @@ func deleteBridge(ctx *cli.Context) error {
 	} else if !confirmation {
 		return fmt.Errorf("bridge delete cancelled")
 	}
-	err = beeperapi.DeleteBridge(homeserver, bridge, accessToken)
-	if err != nil {
-		return fmt.Errorf("error deleting bridge: %w", err)
+	if standalone {
+		// The registration is in the data directory even when using --local-dev
+		err = os.Remove(getStandaloneRegistrationPath(ctx, bridge))
+		if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			log.Printf("Failed to delete registration: [red]%v[reset]", err)
+		}
+		log.Printf("[yellow]Remember to remove the registration of %s from your homeserver config[reset]", bridge)
+	} else {
+		err = beeperapi.DeleteBridge(homeserver, bridge, accessToken)
+		if err != nil {
+			return fmt.Errorf("error deleting bridge: %w", err)
+		}
+		fmt.Println("Started deleting bridge")
+	}
+	if _, ok := GetEnvConfig(ctx).Bridges[bridge]; ok {
+		deleteBridgeSettings(ctx, bridge)
+		err = GetConfig(ctx).Save()
+		if err != nil {
+			log.Printf("Failed to remove local bridge settings from config: [red]%v[reset]", err)
+		}
 	}
-	fmt.Println("Started deleting bridge")
 	err = deleteLocalBridgeData(bridgeDir, !localDev)
 	if err != nil && !errors.Is(err, fs.ErrNotExist) {
 		log.Printf("Failed to delete [magenta]%s[reset]: [red]%v[reset]", bridgeDir, err)
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+
+	"github.com/beeper/bridge-manager/api/beeperapi"
+	"github.com/beeper/bridge-manager/api/hungryapi"
+	"github.com/beeper/bridge-manager/bridgeconfig"
+	"github.com/beeper/bridge-manager/log"
+)
+
+var homeserverYesFlag = &cli.BoolFlag{
+	Name:    "yes",
+	Aliases: []string{"y"},
+	EnvVars: []string{"BBCTL_UPDATE_HOMESERVER"},
+	Usage:   "If the homeserver address of your account changed, update existing bridge configs without asking.",
+}
+
+var configUpdateHomeserverCommand = &cli.Command{
+	Name:   "update-homeserver",
+	Usage:  "Update the homeserver address in existing bridge configs after your account was moved to another cluster",
+	Before: RequiresAuth,
+	Flags: []cli.Flag{
+		&cli.StringFlag{
+			Name:    "config-file",
+			Aliases: []string{"c"},
+			Value:   "config.yaml",
+			EnvVars: []string{"BEEPER_BRIDGE_CONFIG_FILE"},
+			Usage:   "File name of the config in the bridge directories.",
+		},
+		&cli.BoolFlag{
+			Name:    "yes",
+			Aliases: []string{"y"},
+			Usage:   "Don't ask for confirmation.",
+		},
+	},
+	Action: updateBridgeHomeserverAddresses,
+}
+
+// staleBridgeConfig is a bridge whose config still points at an old hungryserv address.
+type staleBridgeConfig struct {
+	Bridge     string
+	ConfigPath string
+	Address    string
+}
+
+// getHungryAddress returns the homeserver address that is used in generated bridge configs. This is the hungryserv
+// address derived from the username, unless --direct-hungryserv is set and the server reported a direct address.
+func getHungryAddress(ctx *cli.Context, whoami *beeperapi.RespWhoami) string {
+	if ctx.Bool("direct-hungryserv") && whoami.UserInfo.HungryURL != "" {
+		return whoami.UserInfo.HungryURL
+	}
+	return hungryapi.NewClient(ctx.String("homeserver"), whoami.UserInfo.Username, "").HomeserverURL.String()
+}
+
+// isHungryAddress returns true if the address has the shape of the hungryserv addresses bbctl puts in configs,
+// so configs pointing at something else (e.g. a local proxy) are left alone.
+func isHungryAddress(address, username string) bool {
+	parsed, err := url.Parse(address)
+	return err == nil && parsed.Scheme == "https" && username != "" && parsed.Path == "/_hungryserv/"+username
+}
+
+// findStaleBridgeConfigs finds bridges in the data directory whose config points at oldAddress instead of address.
+// If the old address isn't known, configs pointing at a different hungryserv address of the user are returned.
+func findStaleBridgeConfigs(ctx *cli.Context, oldAddress, address string) ([]*staleBridgeConfig, error) {
+	dataDir := GetEnvConfig(ctx).BridgeDataDir
+	username := GetEnvConfig(ctx).Username
+	entries, err := os.ReadDir(dataDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	configFileName := cmp.Or(ctx.String("config-file"), "config.yaml")
+	var stale []*staleBridgeConfig
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		configPath := filepath.Join(dataDir, entry.Name(), configFileName)
+		data, err := os.ReadFile(configPath)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		var cfg struct {
+			Homeserver struct {
+				Address string `yaml:"address"`
+			} `yaml:"homeserver"`
+		}
+		if yaml.Unmarshal(data, &cfg) != nil {
+			continue
+		}
+		configAddress := cfg.Homeserver.Address
+		if configAddress == "" || configAddress == address {
+			continue
+		} else if oldAddress != "" && configAddress != oldAddress {
+			continue
+		} else if oldAddress == "" && !isHungryAddress(configAddress, username) {
+			continue
+		}
+		stale = append(stale, &staleBridgeConfig{Bridge: entry.Name(), ConfigPath: configPath, Address: configAddress})
+	}
+	return stale, nil
+}
+
+// rewriteFileValues replaces values in a YAML file without regenerating it. Missing files are ignored.
+func rewriteFileValues(path string, replacements map[string]string, rev *configRevision) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	newData, count, err := bridgeconfig.ReplaceValues(string(data), replacements)
+	if err != nil {
+		return false, err
+	} else if count == 0 {
+		return false, nil
+	}
+	if rev != nil {
+		err = writeBridgeConfig(path, newData, rev)
+	} else {
+		err = os.WriteFile(path, []byte(newData), 0600)
+	}
+	return err == nil, err
+}
+
+// rewriteHomeserverAddress replaces the old homeserver address with the new one in the config, the last generated
+// config and the registration file of a bridge. Nothing else in the files is changed.
+func rewriteHomeserverAddress(bridge *staleBridgeConfig, address string) error {
+	replacements := map[string]string{
+		bridge.Address: address,
+		// The websocket proxy address of bridges that use the websocket proxy
+		strings.Replace(bridge.Address, "https://", "wss://", 1): strings.Replace(address, "https://", "wss://", 1),
+	}
+	bridgeDir := filepath.Dir(bridge.ConfigPath)
+	files := []string{bridge.ConfigPath, lastGeneratedConfigPath(bridge.ConfigPath), filepath.Join(bridgeDir, "registration.yaml")}
+	for _, path := range files {
+		var rev *configRevision
+		if path == bridge.ConfigPath {
+			rev = &configRevision{Source: "homeserver address change"}
+		}
+		updated, err := rewriteFileValues(path, replacements, rev)
+		if err != nil {
+			return fmt.Errorf("failed to update %s: %w", path, err)
+		} else if updated {
+			log.Printf("Updated homeserver address in [magenta]%s[reset]", path)
+		}
+	}
+	return nil
+}
+
+// offerHomeserverRewrite lists the bridges that use an old homeserver address and rewrites their configs
+// if the user confirms (or passed --yes).
+func offerHomeserverRewrite(ctx *cli.Context, stale []*staleBridgeConfig, address string) (bool, error) {
+	log.Printf("[yellow]Your homeserver address is now[reset] [cyan]%s[reset][yellow], but these bridges still use an old address:[reset]", address)
+	for _, bridge := range stale {
+		log.Printf("  [cyan]%s[reset] (%s)", bridge.Bridge, bridge.Address)
+	}
+	confirmed := ctx.Bool("yes")
+	if !confirmed {
+		// Don't prompt in the middle of machine-readable output
+		if !stdinIsTerminal() || ctx.Bool("raw") {
+			return false, nil
+		}
+		err := survey.AskOne(&survey.Confirm{Message: "Update the homeserver address in their configs?", Default: true}, &confirmed)
+		if err != nil {
+			return false, err
+		} else if !confirmed {
+			return false, nil
+		}
+	}
+	for _, bridge := range stale {
+		err := rewriteHomeserverAddress(bridge, address)
+		if err != nil {
+			return false, err
+		}
+	}
+	log.Printf("[green]Updated the homeserver address of %d bridges.[reset] Restart running bridges to use the new address.", len(stale))
+	return true, nil
+}
+
+// checkBridgeHomeserverAddresses is called when the cluster or hungryserv address of the env changes.
+// Errors are only logged, as this happens as a side effect of other commands.
+func checkBridgeHomeserverAddresses(ctx *cli.Context, oldAddress, address string) {
+	stale, err := findStaleBridgeConfigs(ctx, oldAddress, address)
+	if err != nil {
+		log.Printf("[yellow]Failed to check bridge configs for the old homeserver address: %v[reset]", err)
+		return
+	} else if len(stale) == 0 {
+		return
+	}
+	updated, err := offerHomeserverRewrite(ctx, stale, address)
+	if err != nil {
+		log.Printf("[red]Failed to update homeserver address: %v[reset]", err)
+	}
+	if !updated {
+		log.Printf("Run [cyan]bbctl config update-homeserver[reset] to update them later")
+	}
+}
+
+func updateBridgeHomeserverAddresses(ctx *cli.Context) error {
+	whoami, err := getCachedWhoami(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to get whoami: %w", err)
+	}
+	address := getHungryAddress(ctx, whoami)
+	stale, err := findStaleBridgeConfigs(ctx, "", address)
+	if err != nil {
+		return fmt.Errorf("failed to check bridge configs: %w", err)
+	} else if len(stale) == 0 {
+		log.Printf("All bridge configs in [magenta]%s[reset] use [cyan]%s[reset]", GetEnvConfig(ctx).BridgeDataDir, address)
+		return nil
+	}
+	updated, err := offerHomeserverRewrite(ctx, stale, address)
+	if err != nil {
+		return err
+	} else if !updated && !stdinIsTerminal() && !ctx.Bool("yes") {
+		return UserError{"Pass --yes to update the configs without asking"}
+	}
+	return nil
+}
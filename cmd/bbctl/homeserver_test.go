@@ -0,0 +1,126 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/beeper/bridge-manager/api/beeperapi"
+)
+
+const (
+	testDerivedAddress = "https://matrix.beeper.com/_hungryserv/alice"
+	testDirectAddress  = "https://hungry-2.example.com/_hungryserv/alice"
+)
+
+var testHomeserverFlags = []cli.Flag{
+	&cli.StringFlag{Name: "homeserver", Value: "beeper.com"},
+	&cli.BoolFlag{Name: "direct-hungryserv"},
+	&cli.BoolFlag{Name: "yes"},
+}
+
+func writeTestBridgeConfig(t *testing.T, dataDir, bridge, address string) string {
+	t.Helper()
+	configPath := filepath.Join(dataDir, bridge, "config.yaml")
+	if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
+		t.Fatal(err)
+	} else if err = os.WriteFile(configPath, []byte("homeserver:\n    address: "+address+"\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return configPath
+}
+
+func TestGetHungryAddress(t *testing.T) {
+	tests := []struct {
+		name      string
+		args      []string
+		directURL string
+		want      string
+	}{
+		{"default", nil, testDirectAddress, testDerivedAddress},
+		{"opt-in", []string{"--direct-hungryserv"}, testDirectAddress, testDirectAddress},
+		{"opt-in without direct address", []string{"--direct-hungryserv"}, "", testDerivedAddress},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext(t, &EnvConfig{}, testHomeserverFlags, test.args...)
+			whoami := &beeperapi.RespWhoami{UserInfo: beeperapi.WhoamiUserInfo{Username: "alice", HungryURL: test.directURL}}
+			if got := getHungryAddress(ctx, whoami); got != test.want {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestFindStaleBridgeConfigs(t *testing.T) {
+	dataDir := t.TempDir()
+	writeTestBridgeConfig(t, dataDir, "sh-current", testDirectAddress)
+	writeTestBridgeConfig(t, dataDir, "sh-derived", testDerivedAddress)
+	writeTestBridgeConfig(t, dataDir, "sh-old", "https://hungry-1.example.com/_hungryserv/alice")
+	writeTestBridgeConfig(t, dataDir, "sh-proxy", "http://localhost:8008")
+	writeTestBridgeConfig(t, dataDir, "sh-other-user", "https://matrix.beeper.com/_hungryserv/bob")
+	writeTestBridgeConfig(t, dataDir, "sh-nested", "https://matrix.beeper.com/_hungryserv/alice/extra")
+	if err := os.Mkdir(filepath.Join(dataDir, "sh-no-config"), 0700); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name       string
+		oldAddress string
+		want       []string
+	}{
+		{"unknown old address", "", []string{"sh-derived", "sh-old"}},
+		{"known old address", "https://hungry-1.example.com/_hungryserv/alice", []string{"sh-old"}},
+		{"known old address in another shape", "http://localhost:8008", []string{"sh-proxy"}},
+		{"unchanged address", testDirectAddress, nil},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newTestContext(t, &EnvConfig{BridgeDataDir: dataDir, Username: "alice"}, testHomeserverFlags)
+			stale, err := findStaleBridgeConfigs(ctx, test.oldAddress, testDirectAddress)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, bridge := range stale {
+				got = append(got, bridge.Bridge)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestUpdateEnvFromWhoami(t *testing.T) {
+	tests := []struct {
+		name       string
+		storedURL  string
+		wantConfig string
+	}{
+		// Configs are only checked when a previously stored address changes
+		{"first stored address", "", testDerivedAddress},
+		{"unchanged address", testDirectAddress, testDerivedAddress},
+		{"changed address", testDerivedAddress, testDirectAddress},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			configPath := writeTestBridgeConfig(t, dataDir, "sh-signal", testDerivedAddress)
+			ec := &EnvConfig{BridgeDataDir: dataDir, Username: "alice", HungryURL: test.storedURL}
+			ctx := newTestContext(t, ec, testHomeserverFlags, "--direct-hungryserv", "--yes")
+			updateEnvFromWhoami(ctx, &beeperapi.RespWhoami{UserInfo: beeperapi.WhoamiUserInfo{Username: "alice", HungryURL: testDirectAddress}})
+			if ec.HungryURL != testDirectAddress {
+				t.Errorf("stored address is %q, want %q", ec.HungryURL, testDirectAddress)
+			}
+			config, err := os.ReadFile(configPath)
+			if err != nil {
+				t.Fatal(err)
+			} else if want := "homeserver:\n    address: " + test.wantConfig + "\n"; string(config) != want {
+				t.Errorf("got config:\n%s\nwant:\n%s", config, want)
+			}
+		})
+	}
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/beeper/bridge-manager/api/gitlab"
+	"github.com/beeper/bridge-manager/artifacts"
+	"github.com/beeper/bridge-manager/log"
+)
+
+var artifactSourceFlag = &cli.StringFlag{
+	Name:    "artifact-source",
+	EnvVars: []string{"BBCTL_ARTIFACT_SOURCE"},
+	Usage:   "Install bridge binaries from a local directory, tarball, http(s) mirror or oci:// container registry instead of mau.dev CI. Use bbctl bundle to create a local source. Defaults to artifact_source in the bbctl config.",
+}
+
+var installCommand = &cli.Command{
+	Name:      "install",
+	Usage:     "Install or update official bridge binaries without running them",
+	ArgsUsage: "BRIDGE_TYPE...",
+	Flags: []cli.Flag{
+		artifactSourceFlag,
+		&cli.StringFlag{
+			Name:    "channel",
+			Usage:   "Install builds from the given branch of the bridge repo instead of the default branch.",
+			EnvVars: []string{"BEEPER_BRIDGE_CHANNEL"},
+		},
+		&cli.StringFlag{
+			Name:    "pin",
+			Usage:   "Install the build of a specific release tag or full commit hash.",
+			EnvVars: []string{"BEEPER_BRIDGE_PIN"},
+		},
+		&cli.BoolFlag{
+			Name:    "no-update",
+			Aliases: []string{"n"},
+			Usage:   "Only install missing binaries, don't update existing ones.",
+			EnvVars: []string{"BEEPER_BRIDGE_NO_UPDATE"},
+		},
+		&cli.BoolFlag{
+			Name:    "compile",
+			Usage:   "Clone the bridge repository and compile it locally instead of downloading a binary from CI.",
+			EnvVars: []string{"BEEPER_BRIDGE_COMPILE"},
+		},
+		compileRepoFlag,
+		compileRefFlag,
+		compilePatchesFlag,
+		&cli.StringFlag{
+			Name:  "target",
+			Usage: "Cross-compile for another platform in os/arch or os/arch/variant format (e.g. linux/arm64 or linux/arm/v7). Requires --compile and a C cross-compiler for the target.",
+		},
+	},
+	Action: installBridges,
+}
+
+// getGoBridgeBinary returns the bridge type used in CI and the binary name for official Go bridges.
+func getGoBridgeBinary(bridgeType string) (ciBridgeType, binaryName string, ok bool) {
+	switch bridgeType {
+	case "imessage", "imessagego", "whatsapp", "discord", "slack", "gmessages", "gvoice",
+		"signal", "meta", "instagram", "twitter", "bluesky", "linkedin", "telegram":
+		ciBridgeType = bridgeType
+		binaryName = fmt.Sprintf("mautrix-%s", bridgeType)
+		switch bridgeType {
+		case "imessagego":
+			binaryName = "beeper-imessage"
+		case "instagram":
+			ciBridgeType = "meta"
+		}
+		return ciBridgeType, binaryName, true
+	default:
+		return "", "", false
+	}
+}
+
+func getArtifactSource(ctx *cli.Context) (artifacts.Source, error) {
+	location := ctx.String("artifact-source")
+	if location == "" {
+		location = GetEnvConfig(ctx).ArtifactSource
+	}
+	if location == "" {
+		return nil, nil
+	}
+	src, err := artifacts.OpenSource(location)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open artifact source: %w", err)
+	}
+	return src, nil
+}
+
+func getInstallChannel(ctx *cli.Context) (gitlab.Channel, error) {
+	if pin := ctx.String("pin"); pin != "" {
+		if ctx.IsSet("channel") {
+			return gitlab.Channel{}, UserError{"--channel and --pin can't be used at the same time"}
+		}
+		channel, err := gitlab.PinChannel(pin)
+		if err != nil {
+			return channel, UserError{err.Error()}
+		}
+		return channel, nil
+	}
+	return gitlab.BranchChannel(ctx.String("channel")), nil
+}
+
+func installBridges(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return UserError{"You must specify at least one bridge type to install"}
+	}
+	channel, err := getInstallChannel(ctx)
+	if err != nil {
+		return err
+	}
+	src, err := getArtifactSource(ctx)
+	if err != nil {
+		return err
+	} else if src != nil && !channel.IsDefault() {
+		return UserError{"--channel and --pin can't be used with an artifact source"}
+	}
+	compile := ctx.Bool("compile")
+	target := hostCompileTarget()
+	if ctx.IsSet("target") {
+		if !compile {
+			return UserError{"--target can only be used with --compile"}
+		}
+		target, err = parseCompileTarget(ctx.String("target"))
+		if err != nil {
+			return err
+		}
+	}
+	compileSrc, err := getCompileSource(ctx)
+	if err != nil {
+		return err
+	}
+	if compile && (src != nil || !channel.IsDefault()) {
+		return UserError{"--compile can't be used with --artifact-source, --channel or --pin"}
+	}
+	dataDir := GetEnvConfig(ctx).BridgeDataDir
+	for _, arg := range ctx.Args().Slice() {
+		bridgeType, err := guessOrAskBridgeType(arg, "")
+		if err != nil {
+			return err
+		}
+		ciBridgeType, binaryName, ok := getGoBridgeBinary(bridgeType)
+		if !ok {
+			return UserError{fmt.Sprintf("%s is not a Go bridge, Python bridges are installed by `bbctl run`", bridgeType)}
+		}
+		if compile {
+			err = compileAndInstallBridge(ctx, dataDir, ciBridgeType, binaryName, target, compileSrc)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		binaryPath := filepath.Join(dataDir, "binaries", channel.DirName(), binaryName)
+		err = updateGoBridge(ctx.Context, binaryPath, ciBridgeType, false, ctx.Bool("no-update"), channel, src)
+		if errors.Is(err, gitlab.ErrNotBuiltInCI) {
+			return UserError{fmt.Sprintf("Binaries for %s are not built in the CI. Use `bbctl run --compile` to build the bridge locally, or --artifact-source %s to extract the binary from the bridge's container image.", binaryName, artifacts.DefaultOCISource)}
+		} else if err != nil {
+			return fmt.Errorf("failed to install %s: %w", binaryName, err)
+		}
+	}
+	log.Printf("[green]Installation complete[reset]")
+	return nil
+}
+
+func compileAndInstallBridge(ctx *cli.Context, dataDir, ciBridgeType, binaryName string, target *compileTarget, src compileSource) error {
+	builtPath, err := compileGoBridgeForTarget(ctx.Context, dataDir, ciBridgeType, binaryName, target, ctx.Bool("no-update"), src)
+	if err != nil {
+		return fmt.Errorf("failed to compile %s: %w", binaryName, err)
+	}
+	binaryPath := binaryPathForTarget(dataDir, binaryName, target)
+	err = copyExecutable(builtPath, binaryPath)
+	if err != nil {
+		return fmt.Errorf("failed to install %s: %w", binaryName, err)
+	}
+	log.Printf("Installed [cyan]%s[reset] for [cyan]%s[reset] to [magenta]%s[reset]", binaryName, target, binaryPath)
+	return nil
+}
+
+type localBridgeBinary struct {
+	BridgeType   string
+	CIBridgeType string
+	Path         string
+	Channel      gitlab.Channel
+	// The build record of binaries that were compiled locally, nil for binaries from CI or an artifact source.
+	Compiled *compileRecord
+}
+
+// isInCompileDir returns true if the given path is inside the directory where bridges are compiled.
+func isInCompileDir(dataDir, path string) bool {
+	rel, err := filepath.Rel(filepath.Join(dataDir, "compile"), path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// findBridgeBinary finds the installed binary for a bridge name or bridge type.
+// If the name has a saved channel, the binary of that channel is returned.
+// If there's no downloaded binary, but the bridge has been compiled with bbctl run --compile, the compiled binary is returned.
+// Binaries in the compile directory are only returned with a build record, so callers can check Compiled
+// to avoid replacing them with downloaded binaries.
+func findBridgeBinary(ctx *cli.Context, name, bridgeType string) (*localBridgeBinary, error) {
+	bridgeType, err := guessOrAskBridgeType(name, bridgeType)
+	if err != nil {
+		return nil, err
+	}
+	ciBridgeType, binaryName, ok := getGoBridgeBinary(bridgeType)
+	if !ok {
+		return nil, UserError{fmt.Sprintf("%s is not a Go bridge", bridgeType)}
+	}
+	var channel gitlab.Channel
+	if settings, ok := GetEnvConfig(ctx).Bridges[name]; ok {
+		channel, err = gitlab.ParseChannel(settings.Channel)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse saved channel for %s: %w", name, err)
+		}
+	}
+	dataDir := GetEnvConfig(ctx).BridgeDataDir
+	bin := &localBridgeBinary{
+		BridgeType:   bridgeType,
+		CIBridgeType: ciBridgeType,
+		Path:         filepath.Join(dataDir, "binaries", channel.DirName(), binaryName),
+		Channel:      channel,
+	}
+	if _, err = os.Stat(bin.Path); errors.Is(err, fs.ErrNotExist) && channel.IsDefault() {
+		compiledPath := filepath.Join(dataDir, "compile", binaryName, binaryName)
+		bin.Compiled, err = readCompileRecord(compiledPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read build record of %s: %w", compiledPath, err)
+		} else if bin.Compiled != nil {
+			bin.Path = compiledPath
+			return bin, nil
+		}
+	}
+	bin.Compiled, err = readCompileRecord(bin.Path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read build record of %s: %w", bin.Path, err)
+	}
+	return bin, nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFindBridgeBinary(t *testing.T) {
+	tests := []struct {
+		name         string
+		channel      string
+		files        []string
+		want         string
+		wantCompiled bool
+	}{
+		{
+			name:  "downloaded",
+			files: []string{"binaries/mautrix-whatsapp", "compile/mautrix-whatsapp/mautrix-whatsapp", "compile/mautrix-whatsapp/mautrix-whatsapp.build.json"},
+			want:  "binaries/mautrix-whatsapp",
+		},
+		{
+			name:         "compiled with record",
+			files:        []string{"compile/mautrix-whatsapp/mautrix-whatsapp", "compile/mautrix-whatsapp/mautrix-whatsapp.build.json"},
+			want:         "compile/mautrix-whatsapp/mautrix-whatsapp",
+			wantCompiled: true,
+		},
+		{
+			name:  "compiled without record",
+			files: []string{"compile/mautrix-whatsapp/mautrix-whatsapp"},
+			want:  "binaries/mautrix-whatsapp",
+		},
+		{
+			name: "nothing installed",
+			want: "binaries/mautrix-whatsapp",
+		},
+		{
+			name:    "other channel",
+			channel: "branch:beta",
+			files:   []string{"compile/mautrix-whatsapp/mautrix-whatsapp", "compile/mautrix-whatsapp/mautrix-whatsapp.build.json"},
+			want:    "binaries/branch-beta/mautrix-whatsapp",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			for _, file := range test.files {
+				path := filepath.Join(dataDir, filepath.FromSlash(file))
+				if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+					t.Fatal(err)
+				} else if err = os.WriteFile(path, []byte(`{"commit": "abc"}`), 0700); err != nil {
+					t.Fatal(err)
+				}
+			}
+			envConfig := &EnvConfig{BridgeDataDir: dataDir, Bridges: BridgeSettingsMap{
+				"sh-whatsapp": {Type: "whatsapp", Channel: test.channel},
+			}}
+			bin, err := findBridgeBinary(newTestContext(t, envConfig, nil), "sh-whatsapp", "whatsapp")
+			if err != nil {
+				t.Fatal(err)
+			}
+			if want := filepath.Join(dataDir, filepath.FromSlash(test.want)); bin.Path != want {
+				t.Errorf("got path %s, want %s", bin.Path, want)
+			}
+			if (bin.Compiled != nil) != test.wantCompiled {
+				t.Errorf("got build record %+v, want compiled: %t", bin.Compiled, test.wantCompiled)
+			}
+			if bin.Compiled == nil && isInCompileDir(dataDir, bin.Path) {
+				t.Errorf("binary in compile dir returned without a build record")
+			}
+		})
+	}
+}
+
+func TestIsInCompileDir(t *testing.T) {
+	tests := []struct {
+		path string
+		want bool
+	}{
+		{"/data/compile/mautrix-whatsapp/mautrix-whatsapp", true},
+		{"/data/compile/linux-arm64/mautrix-signal/mautrix-signal", true},
+		{"/data/binaries/mautrix-whatsapp", false},
+		{"/data/compile-old/mautrix-whatsapp", false},
+		{"/data/compile", true},
+		{"/data", false},
+	}
+	for _, test := range tests {
+		if got := isInCompileDir("/data", filepath.FromSlash(test.path)); got != test.want {
+			t.Errorf("isInCompileDir(%q) = %t, want %t", test.path, got, test.want)
+		}
+	}
+}
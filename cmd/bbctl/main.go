@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"os"
 	"path"
+	"path/filepath"
 	"time"
 
 	"github.com/fatih/color"
@@ -13,6 +14,7 @@ import (
 	"maunium.net/go/mautrix/id"
 
 	"github.com/beeper/bridge-manager/api/hungryapi"
+	"github.com/beeper/bridge-manager/bridgeconfig"
 	"github.com/beeper/bridge-manager/log"
 )
 
@@ -28,6 +30,8 @@ var (
 	Tag       string
 	Commit    string
 	BuildTime string
+	// PackageManager is set at build time by package managers (e.g. homebrew) to disable self-updates.
+	PackageManager string
 
 	ParsedBuildTime time.Time
 
@@ -73,14 +77,29 @@ func prepareApp(ctx *cli.Context) error {
 	}
 	env := ctx.String("env")
 	homeserver, ok := envs[env]
-	if !ok {
-		return fmt.Errorf("invalid environment %q", env)
-	} else if err = ctx.Set("homeserver", homeserver); err != nil {
+	if existing := cfg.Environments[env]; !ok && existing != nil && existing.IsStandalone() {
+		homeserver = existing.Standalone.Domain
+	} else if !ok && ctx.Args().First() != standaloneCommand.Name {
+		return fmt.Errorf("invalid environment %q (use `bbctl --env %s standalone setup` to add a standalone homeserver)", env, env)
+	}
+	if err = ctx.Set("homeserver", homeserver); err != nil {
 		return err
 	}
 	envConfig := cfg.Environments.Get(env)
+	if envConfig.IsStandalone() && isRecoveryCommand(ctx) {
+		return UserError{fmt.Sprintf("The %s env uses a standalone homeserver, logging in is only needed for Beeper", env)}
+	}
+	templateDir := ctx.String("template-dir")
+	if templateDir == "" {
+		templateDir = filepath.Join(filepath.Dir(cfg.Path), "templates")
+	}
+	err = bridgeconfig.LoadUserTemplates(templateDir)
+	if err != nil {
+		return fmt.Errorf("failed to load config templates: %w", err)
+	}
 	ctx.Context = context.WithValue(ctx.Context, contextKeyConfig, cfg)
 	ctx.Context = context.WithValue(ctx.Context, contextKeyEnvConfig, envConfig)
+	startUpdateCheck(ctx)
 	if envConfig.UsesDesktopLogin() && !isRecoveryCommand(ctx) {
 		err = loadDesktopLogin(ctx, envConfig)
 		if err != nil {
@@ -151,6 +170,27 @@ var app = &cli.App{
 				return nil
 			},
 		},
+		&cli.StringFlag{
+			Name:    "template-dir",
+			EnvVars: []string{"BBCTL_TEMPLATE_DIR"},
+			Usage:   "Directory with bridge config templates that override or extend the built-in templates. Defaults to templates next to the config file.",
+		},
+		&cli.StringFlag{
+			Name:    "credential-store",
+			EnvVars: []string{"BBCTL_CREDENTIAL_STORE"},
+			Usage:   "Where to store secret bridge params (valid values: auto/keychain/secret-tool/file)",
+			Value:   "auto",
+		},
+		&cli.BoolFlag{
+			Name:    "direct-hungryserv",
+			EnvVars: []string{"BBCTL_DIRECT_HUNGRYSERV"},
+			Usage:   "Point bridge configs at the direct hungryserv address reported by the Beeper API instead of the one under matrix.<domain>",
+		},
+		&cli.BoolFlag{
+			Name:    "no-update-check",
+			EnvVars: []string{"BBCTL_NO_UPDATE_CHECK"},
+			Usage:   "Don't check for new bbctl releases in the background",
+		},
 	},
 	Before: prepareApp,
 	Commands: []*cli.Command{
@@ -161,8 +201,21 @@ var app = &cli.App{
 		deleteCommand,
 		whoamiCommand,
 		configCommand,
+		paramsCommand,
+		secretsCommand,
 		runCommand,
+		installCommand,
+		bundleCommand,
+		changelogCommand,
+		outdatedCommand,
+		updateCommand,
+		duCommand,
+		pruneCommand,
+		dbCommand,
 		proxyCommand,
+		selfUpdateCommand,
+		templatesCommand,
+		standaloneCommand,
 	},
 }
 
@@ -188,8 +241,18 @@ func NewMatrixAPI(baseDomain string, username, accessToken string) *mautrix.Clie
 }
 
 func RequiresAuth(ctx *cli.Context) error {
-	if !GetEnvConfig(ctx).HasCredentials() {
+	if GetEnvConfig(ctx).IsStandalone() {
+		return UserError{"This command is only available when using Beeper"}
+	} else if !GetEnvConfig(ctx).HasCredentials() {
 		return UserError{"You're not logged in"}
 	}
 	return nil
 }
+
+// RequiresAuthOrStandalone is like RequiresAuth, but also allows envs that use a standalone homeserver.
+func RequiresAuthOrStandalone(ctx *cli.Context) error {
+	if GetEnvConfig(ctx).IsStandalone() {
+		return nil
+	}
+	return RequiresAuth(ctx)
+}
@@ -0,0 +1,313 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/urfave/cli/v2"
+	"golang.org/x/exp/maps"
+
+	"github.com/beeper/bridge-manager/bridgeconfig"
+	"github.com/beeper/bridge-manager/log"
+)
+
+var configParamsCommand = &cli.Command{
+	Name:      "params",
+	Usage:     "List the bridge-specific params that can be passed with --param",
+	ArgsUsage: "BRIDGE_TYPE",
+	Action:    listBridgeParams,
+}
+
+var skipParamChecksFlag = &cli.BoolFlag{
+	Name:    "skip-param-checks",
+	EnvVars: []string{"BBCTL_SKIP_PARAM_CHECKS"},
+	Usage:   "Don't check new param values by connecting to the services they point at (e.g. when the service isn't reachable from this machine).",
+}
+
+// guessParams fills in params that can be determined automatically before the schema is used to ask for missing params.
+var guessParams = map[string]func(bridgeName string, extraParams map[string]string){
+	"meta": func(bridgeName string, extraParams map[string]string) {
+		if _, ok := extraParams["meta_platform"]; ok {
+			return
+		}
+		if strings.Contains(bridgeName, "facebook-tor") || strings.Contains(bridgeName, "facebooktor") {
+			extraParams["meta_platform"] = "facebook-tor"
+		} else if strings.Contains(bridgeName, "facebook") {
+			extraParams["meta_platform"] = "facebook"
+		} else if strings.Contains(bridgeName, "messenger") {
+			extraParams["meta_platform"] = "messenger"
+		} else if strings.Contains(bridgeName, "instagram") {
+			extraParams["meta_platform"] = "instagram"
+		}
+	},
+	"imessage": func(bridgeName string, extraParams map[string]string) {
+		if runtime.GOOS != "darwin" && extraParams["imessage_platform"] == "" {
+			// Linux can't run the other connectors
+			extraParams["imessage_platform"] = "bluebubbles"
+		}
+	},
+	"telegram": func(bridgeName string, extraParams map[string]string) {
+		idKey, _ := base64.RawStdEncoding.DecodeString("YXBpX2lk")
+		hashKey, _ := base64.RawStdEncoding.DecodeString("YXBpX2hhc2g")
+		_, hasID := extraParams[string(idKey)]
+		_, hasHash := extraParams[string(hashKey)]
+		if !hasID || !hasHash {
+			extraParams[string(idKey)] = "26417019"
+			// This is mostly here so the api key wouldn't show up in automated searches.
+			// It's not really secret, and this key is only used here, cloud bridges have their own key.
+			k, _ := base64.RawStdEncoding.DecodeString("qDP2pQ1LogRjxUYrFUDjDw")
+			d, _ := base64.RawStdEncoding.DecodeString("B9VMuZeZlFk0pkbLcfSDDQ")
+			b, _ := aes.NewCipher(k)
+			b.Decrypt(d, d)
+			extraParams[string(hashKey)] = hex.EncodeToString(d)
+		}
+	},
+}
+
+func simpleDescriptions(descs map[string]string) func(string, int) string {
+	return func(s string, i int) string {
+		return descs[s]
+	}
+}
+
+func askParam(param *bridgeconfig.Param) (string, error) {
+	var value string
+	var prompt survey.Prompt
+	switch {
+	case len(param.Values) > 0:
+		prompt = &survey.Select{
+			Message:     fmt.Sprintf("Select %s:", param.Help),
+			Options:     param.Values,
+			Description: simpleDescriptions(param.ValueHelp),
+			Default:     param.Default,
+		}
+	case param.Secret:
+		prompt = &survey.Password{Message: fmt.Sprintf("Enter %s:", param.Help)}
+	default:
+		prompt = &survey.Input{Message: fmt.Sprintf("Enter %s:", param.Help), Default: param.Default}
+	}
+	err := survey.AskOne(prompt, &value)
+	return value, err
+}
+
+func parseParamFlags(ctx *cli.Context) (map[string]string, error) {
+	params := make(map[string]string)
+	for _, item := range ctx.StringSlice("param") {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return nil, UserError{fmt.Sprintf("Invalid param %q", item)}
+		}
+		name := strings.ToLower(parts[0])
+		if name == paramPickleKey {
+			// Changing the pickle key makes the encryption keys in the bridge database unreadable
+			return nil, UserError{fmt.Sprintf(
+				"The %s param can't be passed with --param, bbctl generates it for new bridges. "+
+					"Use `bbctl params set` to change it for a bridge that doesn't have encryption keys yet",
+				paramPickleKey,
+			)}
+		}
+		params[name] = parts[1]
+	}
+	return params, nil
+}
+
+// resolveBridgeParams combines the saved params of the bridge with the --param flags and validates them against the params
+// declared by the config template. Missing required params are asked interactively and missing optional params are set
+// to their defaults. Specified and asked params are saved so they don't have to be passed again next time, unless readOnly is set.
+func resolveBridgeParams(ctx *cli.Context, bridge, bridgeType string, readOnly bool) (map[string]string, error) {
+	cliParams, err := parseParamFlags(ctx)
+	if err != nil {
+		return nil, err
+	}
+	savedParams, err := loadSavedParams(ctx, bridge)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load saved params: %w", err)
+	}
+	extraParams := maps.Clone(savedParams)
+	maps.Copy(extraParams, cliParams)
+	if guesser, ok := guessParams[bridgeType]; ok {
+		guesser(bridge, extraParams)
+	}
+	meta := bridgeconfig.GetMetadata(bridgeType)
+	if !meta.DeclaresParams() {
+		if readOnly {
+			return extraParams, nil
+		}
+		return extraParams, saveChangedParams(ctx, bridge, meta, savedParams, cliParams)
+	}
+	for key := range extraParams {
+		if meta.GetParam(key) != nil {
+			continue
+		} else if _, isCli := cliParams[key]; isCli {
+			return nil, UserError{fmt.Sprintf("Unknown param %s for %s bridges, see `bbctl config params %s` for valid params", key, bridgeType, bridgeType)}
+		}
+		log.Printf("[yellow]Ignoring saved param [cyan]%s[yellow], which %s bridges don't have anymore (remove it with `bbctl params unset %s %s`)[reset]", key, bridgeType, bridge, key)
+		delete(extraParams, key)
+	}
+	newParams := maps.Clone(cliParams)
+	for _, param := range meta.Params {
+		value, ok := extraParams[param.Name]
+		if !param.AppliesTo(extraParams) {
+			if !ok {
+				extraParams[param.Name] = ""
+			}
+			continue
+		}
+		if !ok || value == "" {
+			if param.Required {
+				value, err = askParam(param)
+				if err != nil {
+					return nil, err
+				}
+				newParams[param.Name] = value
+			} else if !ok {
+				value = param.Default
+			}
+		}
+		extraParams[param.Name] = value
+		// Secret references are validated after they're resolved
+		if param.IsSecretRef(value) {
+			continue
+		}
+		_, isNew := newParams[param.Name]
+		if !isNew || ctx.Bool("skip-param-checks") {
+			// Saved values were already checked when they were entered, so a temporarily unreachable
+			// service doesn't prevent the bridge from starting.
+			err = param.Validate(value)
+		} else {
+			value, err = checkParam(ctx, bridge, param, value, extraParams)
+			newParams[param.Name] = value
+		}
+		if err != nil {
+			return nil, UserError{fmt.Sprintf("Invalid param: %v", err)}
+		}
+		extraParams[param.Name] = value
+	}
+	if readOnly {
+		return extraParams, nil
+	}
+	return extraParams, saveChangedParams(ctx, bridge, meta, savedParams, newParams)
+}
+
+// paramCheckContext returns the context for param validators, which resolve relative paths against the bridge directory.
+func paramCheckContext(ctx *cli.Context, bridge string) context.Context {
+	bridgeDir := filepath.Join(GetEnvConfig(ctx).BridgeDataDir, bridge)
+	if ctx.Bool("local-dev") {
+		if wd, err := os.Getwd(); err == nil {
+			bridgeDir = wd
+		}
+	}
+	return bridgeconfig.WithBridgeDir(ctx.Context, bridgeDir)
+}
+
+// checkParam runs the validator of a newly entered param. If it fails and bbctl is running interactively,
+// the user is asked for a new value until it passes.
+func checkParam(ctx *cli.Context, bridge string, param *bridgeconfig.Param, value string, params map[string]string) (string, error) {
+	checkCtx := paramCheckContext(ctx, bridge)
+	for {
+		err := param.Check(checkCtx, value, params)
+		if err == nil || !stdinIsTerminal() {
+			return value, err
+		}
+		log.Printf("[red]%v[reset]", err)
+		value, err = askParam(param)
+		if err != nil {
+			return "", err
+		}
+		params[param.Name] = value
+	}
+}
+
+// resolveParamRefs replaces secret params that reference secrets (env:, file: or cmd:) with the referenced values.
+// This is done right before generating the config, so the values aren't saved or printed anywhere else.
+func resolveParamRefs(bridgeType string, params map[string]string) error {
+	meta := bridgeconfig.GetMetadata(bridgeType)
+	for key, value := range params {
+		param := meta.GetParam(key)
+		if !param.IsSecretRef(value) {
+			continue
+		}
+		resolved, err := bridgeconfig.ResolveSecretRef(value)
+		if err != nil {
+			return UserError{fmt.Sprintf("Failed to resolve secret reference for param %s: %v", key, err)}
+		}
+		err = param.Validate(resolved)
+		if err != nil {
+			return UserError{fmt.Sprintf("Invalid param: %v", err)}
+		}
+		params[key] = resolved
+	}
+	return nil
+}
+
+// saveChangedParams saves the params that differ from the previously saved values.
+func saveChangedParams(ctx *cli.Context, bridge string, meta *bridgeconfig.Metadata, savedParams, newParams map[string]string) error {
+	changed := make(map[string]string)
+	for key, value := range newParams {
+		if savedValue, ok := savedParams[key]; !ok || savedValue != value {
+			changed[key] = value
+		}
+	}
+	if len(changed) == 0 {
+		return nil
+	}
+	err := saveBridgeParams(ctx, bridge, meta, changed)
+	if err != nil {
+		return fmt.Errorf("failed to save params: %w", err)
+	}
+	keys := maps.Keys(changed)
+	sort.Strings(keys)
+	log.Printf("Saved [cyan]%s[reset] for future runs, use `bbctl params` to view or change saved params", strings.Join(keys, ", "))
+	return nil
+}
+
+func listBridgeParams(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return UserError{"You must specify exactly one bridge type"}
+	}
+	bridgeType := ctx.Args().Get(0)
+	if !bridgeconfig.IsSupported(bridgeType) {
+		return UserError{fmt.Sprintf("Unsupported bridge type %s", bridgeType)}
+	}
+	meta := bridgeconfig.GetMetadata(bridgeType)
+	if !meta.DeclaresParams() {
+		fmt.Printf("The %s template doesn't declare its params\n", bridgeType)
+		return nil
+	} else if len(meta.Params) == 0 {
+		fmt.Printf("%s bridges don't have any params\n", bridgeType)
+		return nil
+	}
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "NAME\tTYPE\tREQUIRED\tDEFAULT\tDESCRIPTION")
+	for _, param := range meta.Params {
+		required := "no"
+		if param.Required && len(param.When) > 0 {
+			conditions := make([]string, 0, len(param.When))
+			for name, values := range param.When {
+				conditions = append(conditions, fmt.Sprintf("%s=%s", name, strings.Join(values, "|")))
+			}
+			sort.Strings(conditions)
+			required = "if " + strings.Join(conditions, ", ")
+		} else if param.Required {
+			required = "yes"
+		}
+		paramType := string(param.Type)
+		if len(param.Values) > 0 {
+			paramType = strings.Join(param.Values, "|")
+		} else if param.Secret {
+			paramType += " (secret)"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\n", param.Name, paramType, required, param.Default, param.Help)
+	}
+	return tw.Flush()
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+)
+
+const testParamBridge = "sh-imessagego"
+
+var testParamFlags = []cli.Flag{
+	&cli.StringFlag{Name: "env", Value: "prod"},
+	&cli.StringFlag{Name: "credential-store", Value: "file"},
+	&cli.StringSliceFlag{Name: "param"},
+	skipParamChecksFlag,
+}
+
+// newParamTestContext creates a context for an imessagego bridge with the given saved params,
+// secret params in the file credential store and --param flags.
+func newParamTestContext(t *testing.T, saved, secrets map[string]string, params ...string) *cli.Context {
+	t.Helper()
+	args := []string{"--skip-param-checks"}
+	for _, param := range params {
+		args = append(args, "--param", param)
+	}
+	ctx := newTestContext(t, &EnvConfig{}, testParamFlags, args...)
+	settings := GetEnvConfig(ctx).Bridges.Get(testParamBridge)
+	settings.Type = "imessagego"
+	settings.Params = saved
+	if len(secrets) > 0 {
+		store, err := openCredentialStore(ctx, "file")
+		if err != nil {
+			t.Fatal(err)
+		}
+		for name, value := range secrets {
+			if err = store.Set(bridgeCredentialKey(ctx, testParamBridge, name), value); err != nil {
+				t.Fatal(err)
+			}
+			settings.SecretParams = append(settings.SecretParams, name)
+		}
+		useBridgeCredentialStore(ctx, testParamBridge, store)
+	}
+	return ctx
+}
+
+func TestResolveBridgeParams_Precedence(t *testing.T) {
+	t.Setenv("BBCTL_TEST_NAC_TOKEN", "token-from-env")
+	const defaultURL = "https://registration-relay.beeper.com"
+	const defaultDevice = "Beeper (self-hosted)"
+	tests := []struct {
+		name    string
+		saved   map[string]string
+		secrets map[string]string
+		params  []string
+		want    map[string]string
+		wantErr string
+	}{
+		{
+			name:    "defaults for missing optional params",
+			secrets: map[string]string{"nac_token": "saved-token"},
+			want:    map[string]string{"nac_token": "saved-token", "nac_url": defaultURL, "device_name": defaultDevice},
+		},
+		{
+			name:    "saved param over default",
+			saved:   map[string]string{"nac_url": "https://saved.example.com"},
+			secrets: map[string]string{"nac_token": "saved-token"},
+			want:    map[string]string{"nac_token": "saved-token", "nac_url": "https://saved.example.com", "device_name": defaultDevice},
+		},
+		{
+			name:    "--param over saved param",
+			saved:   map[string]string{"nac_url": "https://saved.example.com"},
+			secrets: map[string]string{"nac_token": "saved-token"},
+			params:  []string{"nac_url=https://flag.example.com"},
+			want:    map[string]string{"nac_token": "saved-token", "nac_url": "https://flag.example.com", "device_name": defaultDevice},
+		},
+		{
+			name:    "--param over credential store",
+			secrets: map[string]string{"nac_token": "saved-token"},
+			params:  []string{"nac_token=flag-token"},
+			want:    map[string]string{"nac_token": "flag-token", "nac_url": defaultURL, "device_name": defaultDevice},
+		},
+		{
+			name:    "env reference in credential store",
+			secrets: map[string]string{"nac_token": "env:BBCTL_TEST_NAC_TOKEN"},
+			want:    map[string]string{"nac_token": "token-from-env", "nac_url": defaultURL, "device_name": defaultDevice},
+		},
+		{
+			name:    "env reference in --param over credential store",
+			secrets: map[string]string{"nac_token": "saved-token"},
+			params:  []string{"nac_token=env:BBCTL_TEST_NAC_TOKEN"},
+			want:    map[string]string{"nac_token": "token-from-env", "nac_url": defaultURL, "device_name": defaultDevice},
+		},
+		{
+			name:    "env reference in non-secret param isn't resolved",
+			secrets: map[string]string{"nac_token": "saved-token"},
+			params:  []string{"device_name=env:BBCTL_TEST_NAC_TOKEN"},
+			want:    map[string]string{"nac_token": "saved-token", "nac_url": defaultURL, "device_name": "env:BBCTL_TEST_NAC_TOKEN"},
+		},
+		{
+			name:    "--param names are case-insensitive",
+			secrets: map[string]string{"nac_token": "saved-token"},
+			params:  []string{"NAC_URL=https://flag.example.com"},
+			want:    map[string]string{"nac_token": "saved-token", "nac_url": "https://flag.example.com", "device_name": defaultDevice},
+		},
+		{
+			name:    "unknown saved param is ignored",
+			saved:   map[string]string{"removed_param": "value"},
+			secrets: map[string]string{"nac_token": "saved-token"},
+			want:    map[string]string{"nac_token": "saved-token", "nac_url": defaultURL, "device_name": defaultDevice},
+		},
+		{
+			name:    "unknown --param",
+			secrets: map[string]string{"nac_token": "saved-token"},
+			params:  []string{"removed_param=value"},
+			wantErr: "Unknown param removed_param",
+		},
+		{
+			name:    "invalid --param",
+			secrets: map[string]string{"nac_token": "saved-token"},
+			params:  []string{"nac_url"},
+			wantErr: "Invalid param",
+		},
+		{
+			name:    "pickle key in --param",
+			secrets: map[string]string{"nac_token": "saved-token"},
+			params:  []string{"PICKLE_KEY=abc"},
+			wantErr: "pickle_key param can't be passed with --param",
+		},
+		{
+			name:    "missing env reference",
+			secrets: map[string]string{"nac_token": "env:BBCTL_TEST_MISSING"},
+			wantErr: "BBCTL_TEST_MISSING is not set",
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			ctx := newParamTestContext(t, test.saved, test.secrets, test.params...)
+			got, err := resolveBridgeParams(ctx, testParamBridge, "imessagego", true)
+			if err == nil {
+				err = resolveParamRefs("imessagego", got)
+			}
+			if test.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+					t.Errorf("expected error containing %q, got %v", test.wantErr, err)
+				}
+				return
+			} else if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestResolveBridgeParams_SavesSecretsInCredentialStore(t *testing.T) {
+	ctx := newParamTestContext(t, nil, nil, "nac_token=flag-token", "device_name=My Mac")
+	_, err := resolveBridgeParams(ctx, testParamBridge, "imessagego", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	settings := GetEnvConfig(ctx).Bridges[testParamBridge]
+	if _, ok := settings.Params["nac_token"]; ok {
+		t.Errorf("secret param was saved in the config: %v", settings.Params)
+	} else if settings.Params["device_name"] != "My Mac" {
+		t.Errorf("device_name wasn't saved in the config: %v", settings.Params)
+	}
+	if !reflect.DeepEqual(settings.SecretParams, []string{"nac_token"}) || settings.CredentialStore != "file" {
+		t.Errorf("secret params = %v in %q, want [nac_token] in file", settings.SecretParams, settings.CredentialStore)
+	}
+	// Defaults aren't saved, so changes to them in the template apply to existing bridges
+	if _, ok := settings.Params["nac_url"]; ok {
+		t.Errorf("default nac_url was saved: %v", settings.Params)
+	}
+
+	saved, err := loadSavedParams(ctx, testParamBridge)
+	if err != nil {
+		t.Fatal(err)
+	} else if saved["nac_token"] != "flag-token" {
+		t.Errorf("nac_token in credential store = %q, want flag-token", saved["nac_token"])
+	}
+}
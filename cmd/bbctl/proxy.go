@@ -38,6 +38,7 @@ var proxyCommand = &cli.Command{
 			Usage:    "The path to the registration file to read the as_token, hs_token and local appservice URL from",
 		},
 	},
+	Before: RequiresAuth,
 	Action: proxyAppserviceWebsocket,
 }
 
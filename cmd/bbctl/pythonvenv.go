@@ -0,0 +1,284 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/beeper/bridge-manager/log"
+)
+
+type pythonBridge struct {
+	Package string
+	// Extra requirements files to install in local dev mode in addition to requirements.txt
+	DevRequirements []string
+	Module          string
+	MinPython       [2]int
+}
+
+var pythonBridges = map[string]pythonBridge{
+	"heisenbridge": {
+		Package:   "heisenbridge",
+		Module:    "heisenbridge",
+		MinPython: [2]int{3, 10},
+	},
+	"googlechat": {
+		Package:         "mautrix-googlechat[all]",
+		DevRequirements: []string{"optional-requirements.txt"},
+		Module:          "mautrix_googlechat",
+		MinPython:       [2]int{3, 9},
+	},
+}
+
+func isPythonBridge(bridgeType string) bool {
+	_, ok := pythonBridges[bridgeType]
+	return ok
+}
+
+// pythonVenvOptions control which versions are installed into the venv of a Python bridge.
+type pythonVenvOptions struct {
+	// Exact version of the bridge package to install. Empty means the latest version.
+	Pin string
+	// Path to a requirements file with exact versions (and optionally hashes) of all dependencies.
+	LockFile string
+	// Reinstall packages even if the venv is up to date, which upgrades unpinned packages.
+	Upgrade bool
+}
+
+const pythonVenvStateFile = "bbctl-venv.json"
+
+// pythonVenvState is stored inside the venv to detect whether it needs to be recreated.
+type pythonVenvState struct {
+	Python       string    `json:"python"`
+	Packages     []string  `json:"packages"`
+	Requirements string    `json:"requirements_sha256,omitempty"`
+	InstalledAt  time.Time `json:"installed_at"`
+}
+
+func (pvs *pythonVenvState) matches(other *pythonVenvState) bool {
+	return pvs.Python == other.Python && pvs.Requirements == other.Requirements && slices.Equal(pvs.Packages, other.Packages)
+}
+
+func readPythonVenvState(venvPath string) *pythonVenvState {
+	data, err := os.ReadFile(filepath.Join(venvPath, pythonVenvStateFile))
+	if err != nil {
+		return nil
+	}
+	var state pythonVenvState
+	if json.Unmarshal(data, &state) != nil {
+		return nil
+	}
+	return &state
+}
+
+func getPythonBridgeSettings(ctx *cli.Context, bridgeName string) pythonVenvOptions {
+	settings, ok := GetEnvConfig(ctx).Bridges[bridgeName]
+	if !ok {
+		return pythonVenvOptions{}
+	}
+	return pythonVenvOptions{Pin: settings.PythonPin, LockFile: settings.PythonLockFile}
+}
+
+// getPythonVenvOptions returns the saved venv options of a Python bridge, updated with --python-pin and --python-lock-file.
+func getPythonVenvOptions(ctx *cli.Context, bridgeName string) (pythonVenvOptions, error) {
+	opts := getPythonBridgeSettings(ctx, bridgeName)
+	if !ctx.IsSet("python-pin") && !ctx.IsSet("python-lock-file") {
+		return opts, nil
+	}
+	settings := GetEnvConfig(ctx).Bridges.Get(bridgeName)
+	if ctx.IsSet("python-pin") {
+		settings.PythonPin = ctx.String("python-pin")
+		if settings.PythonPin == "latest" {
+			settings.PythonPin = ""
+		}
+	}
+	if ctx.IsSet("python-lock-file") {
+		settings.PythonLockFile = ctx.String("python-lock-file")
+		if settings.PythonLockFile != "" {
+			absPath, err := filepath.Abs(settings.PythonLockFile)
+			if err != nil {
+				return opts, err
+			} else if _, err = os.Stat(absPath); err != nil {
+				return opts, UserError{fmt.Sprintf("Lock file %s doesn't exist", settings.PythonLockFile)}
+			}
+			settings.PythonLockFile = absPath
+		}
+	}
+	if settings.PythonPin != "" && settings.PythonLockFile != "" {
+		return opts, UserError{"A Python bridge can't have both a pinned version and a lock file"}
+	}
+	err := GetConfig(ctx).Save()
+	if err != nil {
+		return opts, fmt.Errorf("failed to save config: %w", err)
+	}
+	return pythonVenvOptions{Pin: settings.PythonPin, LockFile: settings.PythonLockFile}, nil
+}
+
+// checkPythonVersion returns the version of the given Python interpreter and checks that it's new enough for the bridge.
+func checkPythonVersion(ctx context.Context, python string, bridge pythonBridge) (string, error) {
+	output, err := exec.CommandContext(ctx, python, "-c", "import sys; print('%d.%d.%d' % sys.version_info[:3])").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s version: %w", python, err)
+	}
+	version := strings.TrimSpace(string(output))
+	var major, minor, patch int
+	_, err = fmt.Sscanf(version, "%d.%d.%d", &major, &minor, &patch)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse %s version %q: %w", python, version, err)
+	}
+	if major < bridge.MinPython[0] || (major == bridge.MinPython[0] && minor < bridge.MinPython[1]) {
+		return "", UserError{fmt.Sprintf("%s requires Python %d.%d or higher, but %s is version %s", bridge.Package, bridge.MinPython[0], bridge.MinPython[1], python, version)}
+	}
+	return version, nil
+}
+
+// pythonPackageName strips extras from a package requirement, e.g. mautrix-googlechat[all] -> mautrix-googlechat.
+func pythonPackageName(requirement string) string {
+	name, _, _ := strings.Cut(requirement, "[")
+	return name
+}
+
+// getPythonPackageVersion returns the version of a package installed in a virtualenv.
+func getPythonPackageVersion(ctx context.Context, venvPython, packageName string) (string, error) {
+	output, err := exec.CommandContext(ctx, venvPython, "-c", "import sys, importlib.metadata; print(importlib.metadata.version(sys.argv[1]))", packageName).Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to get %s version: %w", packageName, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+func hashRequirementFiles(dir string, files []string) (string, error) {
+	hasher := sha256.New()
+	for _, file := range files {
+		if !filepath.IsAbs(file) {
+			file = filepath.Join(dir, file)
+		}
+		data, err := os.ReadFile(file)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		} else if err != nil {
+			return "", err
+		}
+		hasher.Write(data)
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// createPythonVenv creates a new venv at the given path, installs the packages and checks that the bridge module can be imported.
+func createPythonVenv(ctx context.Context, bridgeDir, venvPath string, bridge pythonBridge, state *pythonVenvState) error {
+	log.Printf("Creating Python virtualenv at [magenta]%s[reset]", venvPath)
+	venvArgs := []string{"-m", "venv", "--clear"}
+	if os.Getenv("SYSTEM_SITE_PACKAGES") == "true" {
+		venvArgs = append(venvArgs, "--system-site-packages")
+	}
+	venvArgs = append(venvArgs, venvPath)
+	err := makeCmd(ctx, bridgeDir, "python3", venvArgs...).Run()
+	if err != nil {
+		return fmt.Errorf("failed to create venv: %w", err)
+	}
+	log.Printf("Installing [cyan]%s[reset] into virtualenv", strings.Join(state.Packages, " "))
+	// pip is called through the interpreter rather than the bin/pip3 script,
+	// because the venv may be moved after creation, which breaks script shebangs.
+	venvPython := filepath.Join(venvPath, "bin", "python3")
+	installArgs := append([]string{"-m", "pip", "install", "--upgrade"}, state.Packages...)
+	err = makeCmd(ctx, bridgeDir, venvPython, installArgs...).Run()
+	if err != nil {
+		return fmt.Errorf("failed to install package: %w", err)
+	}
+	err = makeCmd(ctx, bridgeDir, venvPython, "-c", "import "+bridge.Module).Run()
+	if err != nil {
+		return fmt.Errorf("failed to import %s after installation: %w", bridge.Module, err)
+	}
+	state.InstalledAt = time.Now().UTC()
+	data, err := json.Marshal(state)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(venvPath, pythonVenvStateFile), data, 0600)
+}
+
+// setupPythonVenv makes sure the venv of a Python bridge has the requested packages installed.
+// The existing venv is reused if nothing has changed. Otherwise, a new venv is built next to it and only swapped in
+// if the bridge can be imported, so a failed upgrade leaves the previous venv in place.
+func setupPythonVenv(ctx context.Context, bridgeDir, bridgeType string, localDev bool, opts pythonVenvOptions) (string, error) {
+	bridge, ok := pythonBridges[bridgeType]
+	if !ok {
+		return "", fmt.Errorf("unknown python bridge type %s", bridgeType)
+	}
+	pythonVersion, err := checkPythonVersion(ctx, "python3", bridge)
+	if err != nil {
+		return "", err
+	}
+	desired := &pythonVenvState{Python: pythonVersion}
+	var requirementFiles []string
+	var venvPath string
+	if localDev {
+		venvPath = filepath.Join(bridgeDir, ".venv")
+		requirementFiles = append([]string{"requirements.txt"}, bridge.DevRequirements...)
+	} else {
+		venvPath = filepath.Join(bridgeDir, "venv")
+		if opts.LockFile != "" {
+			requirementFiles = []string{opts.LockFile}
+		} else if opts.Pin != "" {
+			desired.Packages = []string{bridge.Package + "==" + opts.Pin}
+		} else {
+			desired.Packages = []string{bridge.Package}
+		}
+	}
+	for _, file := range requirementFiles {
+		desired.Packages = append(desired.Packages, "-r", file)
+	}
+	if len(requirementFiles) > 0 {
+		desired.Requirements, err = hashRequirementFiles(bridgeDir, requirementFiles)
+		if err != nil {
+			return "", fmt.Errorf("failed to hash requirements: %w", err)
+		}
+	}
+
+	current := readPythonVenvState(venvPath)
+	if current != nil && current.matches(desired) && !opts.Upgrade {
+		log.Printf("Python virtualenv at [magenta]%s[reset] is up to date", venvPath)
+		return venvPath, nil
+	} else if current == nil {
+		// No previous venv (or one created by an older bbctl version without a state file), so there's nothing to roll back to
+		err = createPythonVenv(ctx, bridgeDir, venvPath, bridge, desired)
+		if err != nil {
+			return venvPath, err
+		}
+		log.Printf("[green]Installation complete[reset]")
+		return venvPath, nil
+	}
+
+	newVenvPath := venvPath + ".new"
+	previousVenvPath := venvPath + ".previous"
+	err = createPythonVenv(ctx, bridgeDir, newVenvPath, bridge, desired)
+	if err != nil {
+		_ = os.RemoveAll(newVenvPath)
+		log.Printf("[yellow]Failed to upgrade Python virtualenv, keeping previous version: %v[reset]", err)
+		return venvPath, nil
+	}
+	_ = os.RemoveAll(previousVenvPath)
+	err = os.Rename(venvPath, previousVenvPath)
+	if err != nil {
+		return venvPath, fmt.Errorf("failed to move previous venv: %w", err)
+	}
+	err = os.Rename(newVenvPath, venvPath)
+	if err != nil {
+		_ = os.Rename(previousVenvPath, venvPath)
+		return venvPath, fmt.Errorf("failed to move new venv into place: %w", err)
+	}
+	log.Printf("[green]Installation complete[reset] (previous virtualenv kept at [magenta]%s[reset])", previousVenvPath)
+	return venvPath, nil
+}
@@ -0,0 +1,83 @@
+package main
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// fakePython is installed as python3 in $PATH. Creating a venv copies it into the venv,
+// where `-m pip` exits with $FAKE_PIP_EXIT.
+const fakePython = `#!/bin/sh
+case "$1" in
+-c)
+	case "$2" in
+	"import sys;"*) echo 3.12.1 ;;
+	esac
+	exit 0
+	;;
+-m)
+	if [ "$2" = "venv" ]; then
+		eval "venv=\${$#}"
+		mkdir -p "$venv/bin"
+		cp "$0" "$venv/bin/python3"
+		exit 0
+	elif [ "$2" = "pip" ]; then
+		exit "${FAKE_PIP_EXIT:-0}"
+	fi
+	;;
+esac
+exit 1
+`
+
+func TestSetupPythonVenv_Rollback(t *testing.T) {
+	binDir := t.TempDir()
+	err := os.WriteFile(filepath.Join(binDir, "python3"), []byte(fakePython), 0755)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Setenv("PATH", binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+
+	tests := []struct {
+		name        string
+		pipExit     string
+		wantPackage string
+		wantBackup  bool
+	}{
+		{"failed pip install keeps previous venv", "1", "heisenbridge==1.0.0", false},
+		{"successful install replaces venv", "0", "heisenbridge==2.0.0", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			bridgeDir := t.TempDir()
+			venvPath := filepath.Join(bridgeDir, "venv")
+			err := createPythonVenv(context.Background(), bridgeDir, venvPath, pythonBridges["heisenbridge"], &pythonVenvState{
+				Python:   "3.12.1",
+				Packages: []string{"heisenbridge==1.0.0"},
+			})
+			if err != nil {
+				t.Fatalf("failed to create initial venv: %v", err)
+			}
+			t.Setenv("FAKE_PIP_EXIT", test.pipExit)
+
+			path, err := setupPythonVenv(context.Background(), bridgeDir, "heisenbridge", false, pythonVenvOptions{Pin: "2.0.0"})
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			} else if path != venvPath {
+				t.Errorf("got venv path %s, want %s", path, venvPath)
+			}
+			state := readPythonVenvState(venvPath)
+			if state == nil || len(state.Packages) != 1 || state.Packages[0] != test.wantPackage {
+				t.Errorf("venv has state %+v, want package %s", state, test.wantPackage)
+			}
+			if _, err = os.Stat(venvPath + ".new"); !os.IsNotExist(err) {
+				t.Errorf("temporary venv wasn't removed")
+			}
+			previous := readPythonVenvState(venvPath + ".previous")
+			if (previous != nil) != test.wantBackup {
+				t.Errorf("previous venv state is %+v, want backup: %t", previous, test.wantBackup)
+			}
+		})
+	}
+}
@@ -22,7 +22,7 @@ var registerCommand = &cli.Command{
 	Usage:     "Register a 3rd party bridge and print the appservice registration file",
 	ArgsUsage: "BRIDGE",
 	Action:    registerBridge,
-	Before:    RequiresAuth,
+	Before:    RequiresAuthOrStandalone,
 	Flags: []cli.Flag{
 		&cli.StringFlag{
 			Name:    "address",
@@ -94,6 +94,9 @@ func toCloudBridgeType(typeName string) string {
 }
 
 func doRegisterBridge(ctx *cli.Context, bridge, bridgeType string, onlyGet bool) (*RegisterJSON, error) {
+	if GetEnvConfig(ctx).IsStandalone() {
+		return registerStandaloneBridge(ctx, bridge, bridgeType, onlyGet)
+	}
 	whoami, err := getCachedWhoami(ctx)
 	if err != nil {
 		return nil, fmt.Errorf("failed to get whoami: %w", err)
@@ -148,9 +151,13 @@ func doRegisterBridge(ctx *cli.Context, bridge, bridgeType string, onlyGet bool)
 			return nil, fmt.Errorf("failed to mark bridge as RUNNING: %w", err)
 		}
 	}
+	homeserverURL := hungryAPI.HomeserverURL.String()
+	if ctx.Bool("direct-hungryserv") {
+		homeserverURL = getHungryAddress(ctx, whoami)
+	}
 	output := &RegisterJSON{
 		Registration:     &resp,
-		HomeserverURL:    hungryAPI.HomeserverURL.String(),
+		HomeserverURL:    homeserverURL,
 		HomeserverDomain: "beeper.local",
 		YourUserID:       hungryAPI.UserID,
 	}
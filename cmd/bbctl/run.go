@@ -11,15 +11,19 @@ import (
 	"os/signal"
 	"path/filepath"
 	"runtime"
+	"strconv"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"syscall"
 	"time"
 
 	"github.com/urfave/cli/v2"
 	"maunium.net/go/mautrix/appservice"
+	"maunium.net/go/mautrix/bridgev2/status"
 
 	"github.com/beeper/bridge-manager/api/gitlab"
+	"github.com/beeper/bridge-manager/artifacts"
 	"github.com/beeper/bridge-manager/log"
 )
 
@@ -27,7 +31,7 @@ var runCommand = &cli.Command{
 	Name:      "run",
 	Usage:     "Run an official Beeper bridge",
 	ArgsUsage: "BRIDGE",
-	Before:    RequiresAuth,
+	Before:    RequiresAuthOrStandalone,
 	Flags: []cli.Flag{
 		&cli.StringFlag{
 			Name:    "type",
@@ -40,12 +44,30 @@ var runCommand = &cli.Command{
 			Aliases: []string{"p"},
 			Usage:   "Set a bridge-specific config generation option. Can be specified multiple times for different keys. Format: key=value",
 		},
+		skipParamChecksFlag,
+		configSetFlag,
+		databaseURIFlag,
+		&cli.StringFlag{
+			Name:    "config-overlay",
+			EnvVars: []string{"BEEPER_BRIDGE_CONFIG_OVERLAY"},
+			Usage:   "Path to a YAML file to deep-merge into the generated config on every start. Defaults to config-overlay.yaml in the bridge directory.",
+		},
 		&cli.BoolFlag{
 			Name:    "no-update",
 			Aliases: []string{"n"},
 			Usage:   "Don't update the bridge even if it is out of date.",
 			EnvVars: []string{"BEEPER_BRIDGE_NO_UPDATE"},
 		},
+		&cli.StringFlag{
+			Name:    "channel",
+			Usage:   "Follow builds from the given `BRANCH` of the bridge repo instead of the default branch, or default to go back to the default branch. Saved for future runs.",
+			EnvVars: []string{"BEEPER_BRIDGE_CHANNEL"},
+		},
+		&cli.StringFlag{
+			Name:    "pin",
+			Usage:   "Pin the bridge to the build of a specific release tag or full commit hash. Saved for future runs, use --channel to unpin.",
+			EnvVars: []string{"BEEPER_BRIDGE_PIN"},
+		},
 		&cli.BoolFlag{
 			Name:    "local-dev",
 			Aliases: []string{"l"},
@@ -57,6 +79,36 @@ var runCommand = &cli.Command{
 			Usage:   "Clone the bridge repository and compile it locally instead of downloading a binary from CI. Useful for architectures that aren't built in CI. Not meant for development/modifying the bridge, use --local-dev for that instead.",
 			EnvVars: []string{"BEEPER_BRIDGE_COMPILE"},
 		},
+		compileRepoFlag,
+		compileRefFlag,
+		compilePatchesFlag,
+		artifactSourceFlag,
+		&cli.StringFlag{
+			Name:    "python-pin",
+			Usage:   "Install a specific `VERSION` of a Python bridge package, or latest to unpin. Saved for future runs.",
+			EnvVars: []string{"BEEPER_BRIDGE_PYTHON_PIN"},
+		},
+		&cli.StringFlag{
+			Name:    "python-lock-file",
+			Usage:   "Install the dependencies of a Python bridge from a requirements file with exact versions. Saved for future runs.",
+			EnvVars: []string{"BEEPER_BRIDGE_PYTHON_LOCK_FILE"},
+		},
+		&cli.BoolFlag{
+			Name:    "auto-update",
+			Usage:   "Periodically check for new builds while the bridge is running and restart the bridge to apply them. Only supported for official Go bridge binaries.",
+			EnvVars: []string{"BEEPER_BRIDGE_AUTO_UPDATE"},
+		},
+		&cli.DurationFlag{
+			Name:    "auto-update-interval",
+			Value:   1 * time.Hour,
+			Usage:   "How often to check for new builds when using --auto-update.",
+			EnvVars: []string{"BEEPER_BRIDGE_AUTO_UPDATE_INTERVAL"},
+		},
+		&cli.StringFlag{
+			Name:    "maintenance-window",
+			Usage:   "Daily time range in local time (HH:MM-HH:MM) when --auto-update is allowed to restart the bridge. Defaults to restarting immediately.",
+			EnvVars: []string{"BEEPER_BRIDGE_MAINTENANCE_WINDOW"},
+		},
 		&cli.StringFlag{
 			Name:    "config-file",
 			Aliases: []string{"c"},
@@ -69,6 +121,12 @@ var runCommand = &cli.Command{
 			Usage:   "Don't override the config file if it already exists. Defaults to true with --local-dev mode, otherwise false (always override)",
 			EnvVars: []string{"BEEPER_BRIDGE_NO_OVERRIDE_CONFIG"},
 		},
+		homeserverYesFlag,
+		&cli.BoolFlag{
+			Name:    "skip-compat-check",
+			Usage:   "Start the bridge even if its version isn't supported by the config template in this version of bbctl.",
+			EnvVars: []string{"BEEPER_BRIDGE_SKIP_COMPAT_CHECK"},
+		},
 		&cli.StringFlag{
 			Name:    "custom-startup-command",
 			Usage:   "A custom binary or script to run for startup. Disables checking for updates entirely.",
@@ -105,8 +163,21 @@ type VersionJSONOutput struct {
 	}
 }
 
-func updateGoBridge(ctx context.Context, binaryPath, bridgeType string, v2, noUpdate bool) error {
+func getBridgeVersion(binaryPath string) (*VersionJSONOutput, error) {
+	currentVersionBytes, err := exec.Command(binaryPath, "--version-json").Output()
+	if err != nil {
+		return nil, err
+	}
 	var currentVersion VersionJSONOutput
+	err = json.Unmarshal(currentVersionBytes, &currentVersion)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse version: %w", err)
+	}
+	return &currentVersion, nil
+}
+
+func updateGoBridge(ctx context.Context, binaryPath, bridgeType string, v2, noUpdate bool, channel gitlab.Channel, src artifacts.Source) error {
+	var currentCommit string
 
 	err := os.MkdirAll(filepath.Dir(binaryPath), 0700)
 	if err != nil {
@@ -114,98 +185,93 @@ func updateGoBridge(ctx context.Context, binaryPath, bridgeType string, v2, noUp
 	}
 
 	if _, err = os.Stat(binaryPath); err == nil || !errors.Is(err, fs.ErrNotExist) {
-		if currentVersionBytes, err := exec.Command(binaryPath, "--version-json").Output(); err != nil {
+		if currentVersion, err := getBridgeVersion(binaryPath); err != nil {
 			log.Printf("Failed to get current bridge version: [red]%v[reset] - reinstalling", err)
-		} else if err = json.Unmarshal(currentVersionBytes, &currentVersion); err != nil {
-			log.Printf("Failed to get parse bridge version: [red]%v[reset] - reinstalling", err)
+		} else {
+			currentCommit = currentVersion.Commit
 		}
 	}
-	return gitlab.DownloadMautrixBridgeBinary(ctx, bridgeType, binaryPath, v2, noUpdate, "", currentVersion.Commit)
-}
-
-func compileGoBridge(ctx context.Context, buildDir, binaryPath, bridgeType string, noUpdate bool) error {
-	buildDirParent := filepath.Dir(buildDir)
-	err := os.MkdirAll(buildDirParent, 0700)
-	if err != nil {
-		return err
+	if src != nil {
+		return artifacts.Install(ctx, src, bridgeType, gitlab.HostPlatform(), binaryPath, noUpdate, currentCommit)
 	}
+	return gitlab.DownloadMautrixBridgeBinary(ctx, bridgeType, binaryPath, v2, noUpdate, channel, currentCommit)
+}
 
-	if _, err = os.Stat(buildDir); err != nil && errors.Is(err, fs.ErrNotExist) {
-		repo := fmt.Sprintf("https://github.com/mautrix/%s.git", bridgeType)
-		if bridgeType == "imessagego" {
-			repo = "https://github.com/beeper/imessage.git"
+// getBridgeChannel returns the release channel to use for the given bridge.
+// If --channel or --pin were specified, the new channel is also saved in the config for future runs.
+func getBridgeChannel(ctx *cli.Context, bridgeName string) (gitlab.Channel, error) {
+	settings := GetEnvConfig(ctx).Bridges.Get(bridgeName)
+	var channel gitlab.Channel
+	if pin := ctx.String("pin"); pin != "" {
+		if ctx.IsSet("channel") {
+			return channel, UserError{"--channel and --pin can't be used at the same time"}
 		}
-		log.Printf("Cloning [cyan]%s[reset] to [cyan]%s[reset]", repo, buildDir)
-		err = makeCmd(ctx, buildDirParent, "git", "clone", repo, buildDir).Run()
+		var err error
+		channel, err = gitlab.PinChannel(pin)
 		if err != nil {
-			return fmt.Errorf("failed to clone repo: %w", err)
+			return channel, UserError{err.Error()}
 		}
+	} else if ctx.IsSet("channel") {
+		channel = gitlab.BranchChannel(ctx.String("channel"))
 	} else {
-		if _, err = os.Stat(binaryPath); err == nil || !errors.Is(err, fs.ErrNotExist) {
-			if _, err = exec.Command(binaryPath, "--version-json").Output(); err != nil {
-				log.Printf("Failed to get current bridge version: [red]%v[reset] - reinstalling", err)
-			} else if noUpdate {
-				log.Printf("Not updating bridge because --no-update was specified")
-				return nil
-			}
-		}
-		log.Printf("Pulling [cyan]%s[reset]", buildDir)
-		err = makeCmd(ctx, buildDir, "git", "pull").Run()
+		var err error
+		channel, err = gitlab.ParseChannel(settings.Channel)
 		if err != nil {
-			return fmt.Errorf("failed to pull repo: %w", err)
+			return channel, fmt.Errorf("failed to parse saved channel for %s: %w", bridgeName, err)
 		}
+		return channel, nil
 	}
-	buildScript := "./build.sh"
-	log.Printf("Compiling bridge with %s", buildScript)
-	err = makeCmd(ctx, buildDir, buildScript).Run()
-	if err != nil {
-		return fmt.Errorf("failed to compile bridge: %w", err)
+	if newChannel := channel.String(); settings.Channel != newChannel && (settings.Channel != "" || !channel.IsDefault()) {
+		log.Printf("Switching [cyan]%s[reset] to channel [cyan]%s[reset]", bridgeName, newChannel)
+		if channel.IsDefault() {
+			settings.Channel = ""
+		} else {
+			settings.Channel = newChannel
+		}
+		err := GetConfig(ctx).Save()
+		if err != nil {
+			return channel, fmt.Errorf("failed to save config: %w", err)
+		}
 	}
-	log.Printf("Successfully compiled bridge")
-	return nil
+	return channel, nil
 }
 
-func setupPythonVenv(ctx context.Context, bridgeDir, bridgeType string, localDev bool) (string, error) {
-	var installPackage string
-	localRequirements := []string{"-r", "requirements.txt"}
-	switch bridgeType {
-	case "heisenbridge":
-		installPackage = "heisenbridge"
-	case "googlechat":
-		installPackage = "mautrix-googlechat[all]"
-		localRequirements = append(localRequirements, "-r", "optional-requirements.txt")
-	default:
-		return "", fmt.Errorf("unknown python bridge type %s", bridgeType)
-	}
-	var venvPath string
-	if localDev {
-		venvPath = filepath.Join(bridgeDir, ".venv")
-	} else {
-		venvPath = filepath.Join(bridgeDir, "venv")
+// compileGoBridge checks out the requested source of the bridge and runs its build script.
+// If env is non-nil, it's used as the environment of the build script, e.g. for cross-compiling.
+func compileGoBridge(ctx context.Context, buildDir, binaryPath, bridgeType string, noUpdate bool, env []string, src compileSource, target string) error {
+	err := os.MkdirAll(filepath.Dir(buildDir), 0700)
+	if err != nil {
+		return err
 	}
-	log.Printf("Creating Python virtualenv at [magenta]%s[reset]", venvPath)
-	venvArgs := []string{"-m", "venv"}
-	if os.Getenv("SYSTEM_SITE_PACKAGES") == "true" {
-		venvArgs = append(venvArgs, "--system-site-packages")
+
+	if _, err = os.Stat(binaryPath); noUpdate && (err == nil || !errors.Is(err, fs.ErrNotExist)) {
+		if _, err = exec.Command(binaryPath, "--version-json").Output(); err != nil {
+			log.Printf("Failed to get current bridge version: [red]%v[reset] - reinstalling", err)
+		} else {
+			log.Printf("Not updating bridge because --no-update was specified")
+			return nil
+		}
 	}
-	venvArgs = append(venvArgs, venvPath)
-	err := makeCmd(ctx, bridgeDir, "python3", venvArgs...).Run()
+	record, err := checkoutCompileSource(ctx, buildDir, bridgeType, src)
 	if err != nil {
-		return venvPath, fmt.Errorf("failed to create venv: %w", err)
+		return err
 	}
-	packages := []string{installPackage}
-	if localDev {
-		packages = localRequirements
+	buildScript := "./build.sh"
+	log.Printf("Compiling bridge with %s", buildScript)
+	buildCmd := makeCmd(ctx, buildDir, buildScript)
+	buildCmd.Env = env
+	err = buildCmd.Run()
+	if err != nil {
+		return fmt.Errorf("failed to compile bridge: %w", err)
 	}
-	log.Printf("Installing [cyan]%s[reset] into virtualenv", strings.Join(packages, " "))
-	pipPath := filepath.Join(venvPath, "bin", "pip3")
-	installArgs := append([]string{"install", "--upgrade"}, packages...)
-	err = makeCmd(ctx, bridgeDir, pipPath, installArgs...).Run()
+	record.Target = target
+	record.BuiltAt = time.Now().UTC()
+	err = record.Save(binaryPath)
 	if err != nil {
-		return venvPath, fmt.Errorf("failed to install package: %w", err)
+		return fmt.Errorf("failed to save build record: %w", err)
 	}
-	log.Printf("[green]Installation complete[reset]")
-	return venvPath, nil
+	log.Printf("Successfully compiled bridge from [cyan]%s[reset] (%d patches applied)", shortHash(record.Commit), len(record.Patches))
+	return nil
 }
 
 func makeCmd(ctx context.Context, pwd, path string, args ...string) *exec.Cmd {
@@ -217,6 +283,66 @@ func makeCmd(ctx context.Context, pwd, path string, args ...string) *exec.Cmd {
 	return cmd
 }
 
+// bridgeProcess tracks the running bridge process, which is replaced when the bridge is restarted for an update.
+// It's shared between the restart loop and the signal handler, so all access goes through the lock.
+type bridgeProcess struct {
+	lock     sync.Mutex
+	cmd      *exec.Cmd
+	stopping bool
+}
+
+// Start starts the given command as the current bridge process.
+// If the bridge is already being stopped, the command isn't started and false is returned.
+func (bp *bridgeProcess) Start(cmd *exec.Cmd) (bool, error) {
+	bp.lock.Lock()
+	defer bp.lock.Unlock()
+	if bp.stopping {
+		return false, nil
+	}
+	err := cmd.Start()
+	if err != nil {
+		return false, err
+	}
+	bp.cmd = cmd
+	return true, nil
+}
+
+// Exited clears the current process after it has exited.
+func (bp *bridgeProcess) Exited() {
+	bp.lock.Lock()
+	bp.cmd = nil
+	bp.lock.Unlock()
+}
+
+// Stop prevents new processes from being started and returns the current process, if one is running.
+func (bp *bridgeProcess) Stop() *os.Process {
+	bp.lock.Lock()
+	defer bp.lock.Unlock()
+	bp.stopping = true
+	if bp.cmd == nil {
+		return nil
+	}
+	return bp.cmd.Process
+}
+
+// stopBridgeForRestart asks the bridge to shut down and waits for it to exit, killing it if it takes too long.
+func stopBridgeForRestart(proc *os.Process, exited <-chan error) {
+	err := proc.Signal(syscall.SIGTERM)
+	if err != nil {
+		log.Printf("Failed to send SIGTERM to bridge: %v", err)
+	}
+	select {
+	case <-exited:
+	case <-time.After(30 * time.Second):
+		log.Printf("Bridge didn't exit in 30 seconds, killing process")
+		err = proc.Kill()
+		if err != nil {
+			log.Printf("Failed to kill bridge: %v", err)
+		}
+		<-exited
+	}
+}
+
 func runBridge(ctx *cli.Context) error {
 	if ctx.NArg() == 0 {
 		return UserError{"You must specify a bridge to run"}
@@ -225,10 +351,19 @@ func runBridge(ctx *cli.Context) error {
 	}
 	bridgeName := ctx.Args().Get(0)
 
-	var err error
+	updateWindow, err := parseMaintenanceWindow(ctx.String("maintenance-window"))
+	if err != nil {
+		return UserError{err.Error()}
+	} else if ctx.Duration("auto-update-interval") < time.Minute {
+		return UserError{"--auto-update-interval must be at least one minute"}
+	}
 	dataDir := GetEnvConfig(ctx).BridgeDataDir
 	var bridgeDir string
 	compile := ctx.Bool("compile")
+	compileSrc, err := getCompileSource(ctx)
+	if err != nil {
+		return err
+	}
 	localDev := ctx.Bool("local-dev")
 	if localDev {
 		if compile {
@@ -254,6 +389,12 @@ func runBridge(ctx *cli.Context) error {
 	configFileName := ctx.String("config-file")
 	configPath := filepath.Join(bridgeDir, configFileName)
 	noOverrideConfig := ctx.Bool("no-override-config") || localDev
+	if pinned, err := readConfigPin(configPath); err != nil {
+		return fmt.Errorf("failed to check if config is pinned: %w", err)
+	} else if pinned != 0 {
+		log.Printf("Config was reverted to revision %d, not regenerating it - run `bbctl config unpin %s` to regenerate it again", pinned, bridgeName)
+		noOverrideConfig = true
+	}
 	doWriteConfig := true
 	if noOverrideConfig {
 		_, err = os.Stat(configPath)
@@ -261,7 +402,24 @@ func runBridge(ctx *cli.Context) error {
 	}
 
 	var cfg *generatedBridgeConfig
-	if !doWriteConfig {
+	standalone := GetEnvConfig(ctx).IsStandalone()
+	if !doWriteConfig && standalone {
+		bridgeType, err := getStandaloneBridgeType(ctx, bridgeName)
+		if err != nil {
+			return err
+		}
+		reg, err := doRegisterBridge(ctx, bridgeName, bridgeType, true)
+		if err != nil {
+			log.Printf("Failed to get existing bridge registration: %v", err)
+			log.Printf("Falling back to generating new config")
+			doWriteConfig = true
+		} else {
+			cfg = &generatedBridgeConfig{
+				BridgeType:   bridgeType,
+				RegisterJSON: reg,
+			}
+		}
+	} else if !doWriteConfig {
 		whoami, err := getCachedWhoami(ctx)
 		if err != nil {
 			return fmt.Errorf("failed to get whoami: %w", err)
@@ -283,16 +441,31 @@ func runBridge(ctx *cli.Context) error {
 	}
 
 	if doWriteConfig {
-		cfg, err = doGenerateBridgeConfig(ctx, bridgeName)
+		cfg, err = doGenerateBridgeConfig(ctx, bridgeName, false)
+		if err != nil {
+			return err
+		}
+		err = applyBridgeConfigOverlay(ctx, cfg, bridgeDir)
 		if err != nil {
 			return err
 		}
-		err = os.WriteFile(configPath, []byte(cfg.Config), 0600)
+		err = writeBridgeConfig(configPath, cfg.Config, newConfigRevision("bbctl run", cfg))
 		if err != nil {
 			return fmt.Errorf("failed to save config: %w", err)
 		}
+		saveLastGeneratedConfig(configPath, cfg.Config)
 	} else {
 		log.Printf("Config already exists, not overriding - if you want to regenerate it, delete [cyan]%s[reset]", configPath)
+		if len(ctx.StringSlice("set")) > 0 {
+			log.Printf("[yellow]--set has no effect when the existing config isn't overridden[reset]")
+		}
+	}
+	if settings := GetEnvConfig(ctx).Bridges.Get(bridgeName); !localDev && settings.Type != cfg.BridgeType {
+		settings.Type = cfg.BridgeType
+		err = GetConfig(ctx).Save()
+		if err != nil {
+			log.Printf("Failed to save bridge type to config: [red]%v[reset]", err)
+		}
 	}
 
 	overrideBridgeCmd := ctx.String("custom-startup-command")
@@ -307,19 +480,27 @@ func runBridge(ctx *cli.Context) error {
 	var bridgeCmd string
 	var bridgeArgs []string
 	var needsWebsocketProxy bool
+	var updater *autoUpdater
 	switch cfg.BridgeType {
 	case "imessage", "imessagego", "whatsapp", "discord", "slack", "gmessages", "gvoice",
 		"signal", "meta", "instagram", "twitter", "bluesky", "linkedin", "telegram":
-		ciBridgeType := cfg.BridgeType
-		binaryName := fmt.Sprintf("mautrix-%s", cfg.BridgeType)
+		ciBridgeType, binaryName, _ := getGoBridgeBinary(cfg.BridgeType)
 		ciV2 := false
-		switch cfg.BridgeType {
-		case "imessagego":
-			binaryName = "beeper-imessage"
-		case "instagram":
-			ciBridgeType = "meta"
+		var channel gitlab.Channel
+		channel, err = getBridgeChannel(ctx, bridgeName)
+		if err != nil {
+			return err
 		}
-		bridgeCmd = filepath.Join(dataDir, "binaries", binaryName)
+		var src artifacts.Source
+		src, err = getArtifactSource(ctx)
+		if err != nil {
+			return err
+		}
+		if (localDev || compile || src != nil || overrideBridgeCmd != "") && !channel.IsDefault() {
+			log.Printf("Channel [cyan]%s[reset] is only used for binaries downloaded from CI", channel)
+			channel = gitlab.Channel{}
+		}
+		bridgeCmd = filepath.Join(dataDir, "binaries", channel.DirName(), binaryName)
 		if localDev && overrideBridgeCmd == "" {
 			bridgeCmd = filepath.Join(bridgeDir, binaryName)
 			buildScript := "./build.sh"
@@ -329,43 +510,103 @@ func runBridge(ctx *cli.Context) error {
 				return fmt.Errorf("failed to compile bridge: %w", err)
 			}
 		} else if compile && overrideBridgeCmd == "" {
-			buildDir := filepath.Join(dataDir, "compile", binaryName)
-			bridgeCmd = filepath.Join(buildDir, binaryName)
-			err = compileGoBridge(ctx.Context, buildDir, bridgeCmd, ciBridgeType, ctx.Bool("no-update"))
+			bridgeCmd, err = compileGoBridgeForTarget(ctx.Context, dataDir, ciBridgeType, binaryName, hostCompileTarget(), ctx.Bool("no-update"), compileSrc)
 			if err != nil {
 				return fmt.Errorf("failed to compile bridge: %w", err)
 			}
 		} else if overrideBridgeCmd == "" {
-			err = updateGoBridge(ctx.Context, bridgeCmd, ciBridgeType, ciV2, ctx.Bool("no-update"))
+			err = updateGoBridge(ctx.Context, bridgeCmd, ciBridgeType, ciV2, ctx.Bool("no-update"), channel, src)
 			if errors.Is(err, gitlab.ErrNotBuiltInCI) {
-				return UserError{fmt.Sprintf("Binaries for %s are not built in the CI. Use --compile to tell bbctl to build the bridge locally.", binaryName)}
+				return UserError{fmt.Sprintf("Binaries for %s are not built in the CI. Use --compile to tell bbctl to build the bridge locally, or --artifact-source %s to extract the binary from the bridge's container image.", binaryName, artifacts.DefaultOCISource)}
 			} else if err != nil {
 				return fmt.Errorf("failed to update bridge: %w", err)
 			}
+			if ctx.Bool("auto-update") {
+				updater = &autoUpdater{
+					BridgeName:   bridgeName,
+					BridgeType:   cfg.BridgeType,
+					CIBridgeType: ciBridgeType,
+					BinaryPath:   bridgeCmd,
+					Channel:      channel,
+					Source:       src,
+					Interval:     ctx.Duration("auto-update-interval"),
+					Window:       updateWindow,
+					Homeserver:   ctx.String("homeserver"),
+					NoState:      standalone || ctx.Bool("no-state"),
+					Username:     GetEnvConfig(ctx).Username,
+					AppToken:     cfg.Registration.AppToken,
+					Restart:      make(chan string),
+				}
+				if version, err := getBridgeVersion(bridgeCmd); err == nil {
+					updater.RunningCommit = version.Commit
+				}
+			}
+		}
+		if overrideBridgeCmd == "" && !ctx.Bool("skip-compat-check") {
+			err = checkTemplateCompat(cfg.BridgeType, bridgeCmd)
+			if err != nil {
+				return err
+			}
 		}
 		bridgeArgs = []string{"-c", configFileName}
 	case "googlechat":
 		if overrideBridgeCmd == "" {
 			var venvPath string
-			venvPath, err = setupPythonVenv(ctx.Context, bridgeDir, cfg.BridgeType, localDev)
+			var venvOpts pythonVenvOptions
+			venvOpts, err = getPythonVenvOptions(ctx, bridgeName)
+			if err != nil {
+				return err
+			}
+			venvPath, err = setupPythonVenv(ctx.Context, bridgeDir, cfg.BridgeType, localDev, venvOpts)
 			if err != nil {
 				return fmt.Errorf("failed to update bridge: %w", err)
 			}
 			bridgeCmd = filepath.Join(venvPath, "bin", "python3")
+			if !localDev && !ctx.Bool("skip-compat-check") {
+				err = checkPythonTemplateCompat(ctx.Context, cfg.BridgeType, bridgeCmd)
+				if err != nil {
+					return err
+				}
+			}
 		}
 		bridgeArgs = []string{"-m", "mautrix_" + cfg.BridgeType, "-c", configFileName}
-		needsWebsocketProxy = true
+		// Standalone homeservers push events to the bridge directly
+		needsWebsocketProxy = !standalone
 	case "heisenbridge":
 		if overrideBridgeCmd == "" {
 			var venvPath string
-			venvPath, err = setupPythonVenv(ctx.Context, bridgeDir, cfg.BridgeType, localDev)
+			var venvOpts pythonVenvOptions
+			venvOpts, err = getPythonVenvOptions(ctx, bridgeName)
+			if err != nil {
+				return err
+			}
+			venvPath, err = setupPythonVenv(ctx.Context, bridgeDir, cfg.BridgeType, localDev, venvOpts)
 			if err != nil {
 				return fmt.Errorf("failed to update bridge: %w", err)
 			}
 			bridgeCmd = filepath.Join(venvPath, "bin", "python3")
+			if !localDev && !ctx.Bool("skip-compat-check") {
+				err = checkPythonTemplateCompat(ctx.Context, cfg.BridgeType, bridgeCmd)
+				if err != nil {
+					return err
+				}
+			}
+		}
+		if standalone {
+			var listenAddress string
+			var listenPort uint16
+			listenAddress, listenPort, err = parseAppserviceURL(cfg.Registration.URL)
+			if err != nil {
+				return UserError{fmt.Sprintf("Invalid registration for %s: %v", bridgeName, err)}
+			}
+			bridgeArgs = []string{
+				"-m", "heisenbridge", "-c", configFileName, "-o", cfg.YourUserID.String(),
+				"-l", listenAddress, "-p", strconv.Itoa(int(listenPort)), cfg.HomeserverURL,
+			}
+		} else {
+			heisenHomeserverURL := strings.Replace(cfg.HomeserverURL, "https://", "wss://", 1)
+			bridgeArgs = []string{"-m", "heisenbridge", "-c", configFileName, "-o", cfg.YourUserID.String(), heisenHomeserverURL}
 		}
-		heisenHomeserverURL := strings.Replace(cfg.HomeserverURL, "https://", "wss://", 1)
-		bridgeArgs = []string{"-m", "heisenbridge", "-c", configFileName, "-o", cfg.YourUserID.String(), heisenHomeserverURL}
 	default:
 		if overrideBridgeCmd == "" {
 			return UserError{"Unsupported bridge type for bbctl run"}
@@ -374,14 +615,20 @@ func runBridge(ctx *cli.Context) error {
 	if overrideBridgeCmd != "" {
 		bridgeCmd = overrideBridgeCmd
 	}
+	if ctx.Bool("auto-update") && updater == nil {
+		log.Printf("--auto-update is only supported for official Go bridge binaries, bridge won't be updated automatically")
+	}
 
-	cmd := makeCmd(ctx.Context, bridgeDir, bridgeCmd, bridgeArgs...)
-	if runtime.GOOS == "linux" {
-		cmd.SysProcAttr = &syscall.SysProcAttr{
-			// Don't pass through signals to the bridge, we'll send a sigterm when we want to stop it.
-			// Causes weird issues on macOS, so limited to Linux.
-			Setpgid: true,
+	newBridgeCmd := func() *exec.Cmd {
+		cmd := makeCmd(ctx.Context, bridgeDir, bridgeCmd, bridgeArgs...)
+		if runtime.GOOS == "linux" {
+			cmd.SysProcAttr = &syscall.SysProcAttr{
+				// Don't pass through signals to the bridge, we'll send a sigterm when we want to stop it.
+				// Causes weird issues on macOS, so limited to Linux.
+				Setpgid: true,
+			}
 		}
+		return cmd
 	}
 	var as *appservice.AppService
 	var wg sync.WaitGroup
@@ -410,13 +657,14 @@ func runBridge(ctx *cli.Context) error {
 	log.Printf("Starting [cyan]%s[reset]", cfg.BridgeType)
 
 	c := make(chan os.Signal, 1)
-	interrupted := false
+	var interrupted atomic.Bool
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
+	bridgeProc := &bridgeProcess{}
 	go func() {
 		select {
 		case <-c:
-			interrupted = true
+			interrupted.Store(true)
 			fmt.Println()
 		case <-wsProxyClosed:
 			log.Printf("Websocket proxy exited, shutting down bridge")
@@ -425,25 +673,63 @@ func runBridge(ctx *cli.Context) error {
 		if as != nil && as.StopWebsocket != nil {
 			as.StopWebsocket(appservice.ErrWebsocketManualStop)
 		}
-		proc := cmd.Process
-		// On non-Linux, assume setpgid wasn't set, so the signal will be automatically sent to both processes.
-		if proc != nil && runtime.GOOS == "linux" {
-			err := proc.Signal(syscall.SIGTERM)
+		// The process may not exist if the bridge is being restarted for an update
+		if proc := bridgeProc.Stop(); proc != nil {
+			// On non-Linux, assume setpgid wasn't set, so the signal will be automatically sent to both processes.
+			if runtime.GOOS == "linux" {
+				err := proc.Signal(syscall.SIGTERM)
+				if err != nil {
+					log.Printf("Failed to send SIGTERM to bridge: %v", err)
+				}
+			}
+			time.Sleep(3 * time.Second)
+			log.Printf("Killing process")
+			err := proc.Kill()
 			if err != nil {
-				log.Printf("Failed to send SIGTERM to bridge: %v", err)
+				log.Printf("Failed to kill bridge: %v", err)
 			}
 		}
-		time.Sleep(3 * time.Second)
-		log.Printf("Killing process")
-		err := proc.Kill()
-		if err != nil {
-			log.Printf("Failed to kill bridge: %v", err)
-		}
 		os.Exit(1)
 	}()
 
-	err = cmd.Run()
-	if !interrupted {
+	var restart chan string
+	stopUpdater := func() {}
+	if updater != nil {
+		restart = updater.Restart
+		log.Printf("Checking for updates every [cyan]%s[reset]", updater.Interval)
+		var updaterCtx context.Context
+		updaterCtx, stopUpdater = context.WithCancel(ctx.Context)
+		defer stopUpdater()
+		go updater.Run(updaterCtx)
+	}
+	for {
+		cmd := newBridgeCmd()
+		var started bool
+		started, err = bridgeProc.Start(cmd)
+		if err != nil || !started {
+			break
+		}
+		exited := make(chan error, 1)
+		go func(cmd *exec.Cmd) {
+			exited <- cmd.Wait()
+		}(cmd)
+		var newCommit string
+		select {
+		case err = <-exited:
+		case newCommit = <-restart:
+		}
+		if newCommit == "" {
+			break
+		}
+		log.Printf("Restarting [cyan]%s[reset] to update to [cyan]%s[reset]", cfg.BridgeType, shortHash(newCommit))
+		updater.postState(status.StateBridgeUnreachable, "SELF_HOST_UPDATING", map[string]any{"commit": newCommit})
+		stopBridgeForRestart(cmd.Process, exited)
+		bridgeProc.Exited()
+		updater.postState(status.StateStarting, "SELF_HOST_UPDATED", map[string]any{"commit": newCommit})
+	}
+	// Nothing is receiving restart requests anymore
+	stopUpdater()
+	if !interrupted.Load() {
 		log.Printf("Bridge exited")
 	}
 	if as != nil && as.StopWebsocket != nil {
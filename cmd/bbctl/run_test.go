@@ -0,0 +1,59 @@
+package main
+
+import (
+	"os"
+	"os/exec"
+	"testing"
+	"time"
+)
+
+func TestBridgeProcess_StopDuringRestart(t *testing.T) {
+	bp := &bridgeProcess{}
+	stopped := make(chan *os.Process, 1)
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		stopped <- bp.Stop()
+	}()
+	// Keep restarting the bridge like the update loop until the shutdown handler stops it
+	var lastCmd *exec.Cmd
+	for {
+		cmd := exec.Command("sleep", "10")
+		started, err := bp.Start(cmd)
+		if err != nil {
+			t.Fatal(err)
+		} else if !started {
+			break
+		}
+		lastCmd = cmd
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+		bp.Exited()
+	}
+	proc := <-stopped
+	if proc != nil && (lastCmd == nil || proc != lastCmd.Process) {
+		t.Errorf("Stop returned a process that isn't the last one started")
+	}
+	started, err := bp.Start(exec.Command("sleep", "10"))
+	if started || err != nil {
+		t.Errorf("bridge was started after being stopped (error: %v)", err)
+	}
+}
+
+func TestBridgeProcess_Stop(t *testing.T) {
+	bp := &bridgeProcess{}
+	if proc := bp.Stop(); proc != nil {
+		t.Errorf("Stop returned %v before anything was started", proc)
+	}
+	bp = &bridgeProcess{}
+	cmd := exec.Command("sleep", "10")
+	if started, err := bp.Start(cmd); !started || err != nil {
+		t.Fatalf("failed to start process: %v", err)
+	}
+	defer func() {
+		_ = cmd.Process.Kill()
+		_ = cmd.Wait()
+	}()
+	if proc := bp.Stop(); proc != cmd.Process {
+		t.Errorf("Stop returned %v, want the running process", proc)
+	}
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+	"golang.org/x/exp/maps"
+
+	"github.com/beeper/bridge-manager/bridgeconfig"
+	"github.com/beeper/bridge-manager/log"
+)
+
+var paramsCommand = &cli.Command{
+	Name:  "params",
+	Usage: "Manage the bridge-specific params that are remembered between runs",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "get",
+			Usage:     "Show the saved params of a bridge",
+			ArgsUsage: "BRIDGE [NAME]",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "show-secrets",
+					Usage: "Show the values of secret params instead of hiding them.",
+				},
+			},
+			Action: getSavedParams,
+		},
+		{
+			Name:      "set",
+			Usage:     "Save params for a bridge, which are used the next time the config is generated",
+			ArgsUsage: "BRIDGE NAME=VALUE...",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "type",
+					Aliases: []string{"t"},
+					EnvVars: []string{"BEEPER_BRIDGE_TYPE"},
+					Usage:   "The type of bridge, if it can't be guessed from the name.",
+				},
+				skipParamChecksFlag,
+			},
+			Action: setSavedParams,
+		},
+		{
+			Name:      "unset",
+			Usage:     "Forget saved params of a bridge",
+			ArgsUsage: "BRIDGE NAME...",
+			Action:    unsetSavedParams,
+		},
+	},
+}
+
+// loadSavedParams returns the params that were saved for a bridge, including secret params from the credential store.
+func loadSavedParams(ctx *cli.Context, bridge string) (map[string]string, error) {
+	params := make(map[string]string)
+	settings, ok := GetEnvConfig(ctx).Bridges[bridge]
+	if !ok || settings == nil {
+		return params, nil
+	}
+	maps.Copy(params, settings.Params)
+	if len(settings.SecretParams) == 0 {
+		return params, nil
+	}
+	store, err := getBridgeCredentialStore(ctx, bridge)
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range settings.SecretParams {
+		value, err := store.Get(bridgeCredentialKey(ctx, bridge, name))
+		if err != nil {
+			return nil, err
+		} else if value == "" {
+			log.Printf("[yellow]Saved param [cyan]%s[yellow] of %s wasn't found in %s[reset]", name, bridge, store.Name())
+			continue
+		}
+		params[name] = value
+	}
+	return params, nil
+}
+
+// saveBridgeParams saves params for a bridge. Params that the template declares as secret are stored in the credential store.
+func saveBridgeParams(ctx *cli.Context, bridge string, meta *bridgeconfig.Metadata, params map[string]string) error {
+	settings := GetEnvConfig(ctx).Bridges.Get(bridge)
+	var store credentialStore
+	var err error
+	for name, value := range params {
+		if param := meta.GetParam(name); param != nil && param.Secret {
+			if store == nil {
+				store, err = getBridgeCredentialStore(ctx, bridge)
+				if err != nil {
+					return err
+				}
+			}
+			err = store.Set(bridgeCredentialKey(ctx, bridge, name), value)
+			if err != nil {
+				return err
+			}
+			useBridgeCredentialStore(ctx, bridge, store)
+			delete(settings.Params, name)
+			if !slices.Contains(settings.SecretParams, name) {
+				settings.SecretParams = append(settings.SecretParams, name)
+				sort.Strings(settings.SecretParams)
+			}
+		} else {
+			if settings.Params == nil {
+				settings.Params = make(map[string]string)
+			}
+			settings.Params[name] = value
+		}
+	}
+	return GetConfig(ctx).Save()
+}
+
+// forgetBridgeParams removes saved params of a bridge from the config and the credential store.
+// The config must be saved separately.
+func forgetBridgeParams(ctx *cli.Context, bridge string, names []string) error {
+	settings, ok := GetEnvConfig(ctx).Bridges[bridge]
+	if !ok || settings == nil {
+		return nil
+	}
+	var store credentialStore
+	for _, name := range names {
+		delete(settings.Params, name)
+		if !slices.Contains(settings.SecretParams, name) {
+			continue
+		}
+		if store == nil {
+			var err error
+			store, err = getBridgeCredentialStore(ctx, bridge)
+			if err != nil {
+				return err
+			}
+		}
+		err := store.Delete(bridgeCredentialKey(ctx, bridge, name))
+		if err != nil {
+			return err
+		}
+		settings.SecretParams = slices.DeleteFunc(settings.SecretParams, func(item string) bool {
+			return item == name
+		})
+	}
+	return nil
+}
+
+// deleteBridgeSettings removes the local settings of a bridge, including secrets in the credential store.
+// The config must be saved separately.
+func deleteBridgeSettings(ctx *cli.Context, bridge string) {
+	settings, ok := GetEnvConfig(ctx).Bridges[bridge]
+	if !ok {
+		return
+	}
+	if settings != nil {
+		err := forgetBridgeParams(ctx, bridge, settings.SecretParams)
+		if err == nil {
+			err = deleteBridgeSecrets(ctx, bridge)
+		}
+		if err != nil {
+			log.Printf("[yellow]Failed to remove secrets of %s from credential store: %v[reset]", bridge, err)
+		}
+	}
+	delete(GetEnvConfig(ctx).Bridges, bridge)
+}
+
+// getSavedBridgeType returns the type of a bridge for validating params without contacting the server.
+func getSavedBridgeType(ctx *cli.Context, bridge string) (string, error) {
+	bridgeType := ctx.String("type")
+	if bridgeType == "" {
+		if settings, ok := GetEnvConfig(ctx).Bridges[bridge]; ok && settings != nil {
+			bridgeType = settings.Type
+		}
+	}
+	if bridgeType == "" {
+		bridgeType = guessBridgeType(bridge)
+	}
+	if bridgeType == "" {
+		return "", UserError{fmt.Sprintf("Couldn't guess the type of %s, please specify it with --type", bridge)}
+	} else if !bridgeconfig.IsSupported(bridgeType) {
+		return "", UserError{fmt.Sprintf("Unsupported bridge type %s", bridgeType)}
+	}
+	return bridgeType, nil
+}
+
+func getSavedParams(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return UserError{"You must specify a bridge"}
+	} else if ctx.NArg() > 2 {
+		return UserError{"Too many arguments specified (flags must come before arguments)"}
+	}
+	bridge := ctx.Args().Get(0)
+	params, err := loadSavedParams(ctx, bridge)
+	if err != nil {
+		return err
+	}
+	if ctx.NArg() == 2 {
+		value, ok := params[ctx.Args().Get(1)]
+		if !ok {
+			return UserError{fmt.Sprintf("%s doesn't have a saved %s param", bridge, ctx.Args().Get(1))}
+		}
+		fmt.Println(value)
+		return nil
+	} else if len(params) == 0 {
+		fmt.Printf("%s doesn't have any saved params\n", bridge)
+		return nil
+	}
+	secretParams := GetEnvConfig(ctx).Bridges[bridge].SecretParams
+	names := maps.Keys(params)
+	sort.Strings(names)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "NAME\tVALUE")
+	for _, name := range names {
+		value := params[name]
+		if slices.Contains(secretParams, name) && !ctx.Bool("show-secrets") {
+			value = "<hidden>"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\n", name, value)
+	}
+	return tw.Flush()
+}
+
+func setSavedParams(ctx *cli.Context) error {
+	if ctx.NArg() < 2 {
+		return UserError{"You must specify a bridge and at least one param to set"}
+	}
+	bridge := ctx.Args().Get(0)
+	if err := validateBridgeName(ctx, bridge); err != nil {
+		return err
+	}
+	bridgeType, err := getSavedBridgeType(ctx, bridge)
+	if err != nil {
+		return err
+	}
+	meta := bridgeconfig.GetMetadata(bridgeType)
+	params := make(map[string]string)
+	for _, item := range ctx.Args().Tail() {
+		parts := strings.SplitN(item, "=", 2)
+		if len(parts) != 2 {
+			return UserError{fmt.Sprintf("Invalid param %q (format: name=value)", item)}
+		}
+		name := strings.ToLower(parts[0])
+		if meta.DeclaresParams() {
+			param := meta.GetParam(name)
+			if param == nil {
+				return UserError{fmt.Sprintf("Unknown param %s for %s bridges, see `bbctl config params %s` for valid params", name, bridgeType, bridgeType)}
+			} else if err = param.Validate(parts[1]); err != nil {
+				return UserError{fmt.Sprintf("Invalid param: %v", err)}
+			}
+		}
+		params[name] = parts[1]
+	}
+	if !ctx.Bool("skip-param-checks") {
+		// Validators may need the other params, e.g. the BlueBubbles password is checked against the saved URL
+		allParams, err := loadSavedParams(ctx, bridge)
+		if err != nil {
+			return fmt.Errorf("failed to load saved params: %w", err)
+		}
+		maps.Copy(allParams, params)
+		checkCtx := paramCheckContext(ctx, bridge)
+		for name, value := range params {
+			if param := meta.GetParam(name); param != nil && !param.IsSecretRef(value) {
+				if err = param.Check(checkCtx, value, allParams); err != nil {
+					return UserError{fmt.Sprintf("Invalid param: %v", err)}
+				}
+			}
+		}
+	}
+	err = saveBridgeParams(ctx, bridge, meta, params)
+	if err != nil {
+		return fmt.Errorf("failed to save params: %w", err)
+	}
+	log.Printf("Saved %d params for [cyan]%s[reset], they'll be used the next time the config is generated", len(params), bridge)
+	return nil
+}
+
+func unsetSavedParams(ctx *cli.Context) error {
+	if ctx.NArg() < 2 {
+		return UserError{"You must specify a bridge and at least one param to unset"}
+	}
+	bridge := ctx.Args().Get(0)
+	names := ctx.Args().Tail()
+	for i, name := range names {
+		names[i] = strings.ToLower(name)
+	}
+	err := forgetBridgeParams(ctx, bridge, names)
+	if err != nil {
+		return err
+	}
+	err = GetConfig(ctx).Save()
+	if err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	log.Printf("Removed [cyan]%s[reset] from the saved params of [cyan]%s[reset]", strings.Join(names, ", "), bridge)
+	return nil
+}
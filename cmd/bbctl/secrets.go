@@ -0,0 +1,269 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"slices"
+
+	"github.com/urfave/cli/v2"
+	"go.mau.fi/util/random"
+
+	"github.com/beeper/bridge-manager/bridgeconfig"
+	"github.com/beeper/bridge-manager/log"
+)
+
+var secretsCommand = &cli.Command{
+	Name:  "secrets",
+	Usage: "Manage the secrets bbctl generates for bridges",
+	Subcommands: []*cli.Command{
+		{
+			Name:      "rotate",
+			Usage:     "Generate a new provisioning secret for a bridge",
+			ArgsUsage: "BRIDGE",
+			Before:    RequiresAuthOrStandalone,
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "config-file",
+					Aliases: []string{"c"},
+					Value:   "config.yaml",
+					EnvVars: []string{"BEEPER_BRIDGE_CONFIG_FILE"},
+					Usage:   "File name of the existing config in the bridge directory, which is updated with the new secret.",
+				},
+			},
+			Action: rotateBridgeSecrets,
+		},
+	},
+}
+
+// The names of secrets that bbctl generates for bridges, stored in the credential store like secret params.
+const (
+	secretProvisioning = "provisioning_secret"
+	// The pickle key is a secret param declared by the bridgev2 template rather than a generated secret,
+	// so custom templates can override it. It's kept in the credential store with the other secret params.
+	paramPickleKey = "pickle_key"
+)
+
+// loadBridgeSecret returns a generated secret of a bridge, or an empty string if it hasn't been generated.
+func loadBridgeSecret(ctx *cli.Context, bridge, name string) (string, error) {
+	settings, ok := GetEnvConfig(ctx).Bridges[bridge]
+	if !ok || settings == nil || !slices.Contains(settings.Secrets, name) {
+		return "", nil
+	}
+	store, err := getBridgeCredentialStore(ctx, bridge)
+	if err != nil {
+		return "", err
+	}
+	value, err := store.Get(bridgeCredentialKey(ctx, bridge, name))
+	if err != nil {
+		return "", err
+	} else if value == "" {
+		log.Printf("[yellow]Generated %s of %s wasn't found in %s[reset]", name, bridge, store.Name())
+	}
+	return value, nil
+}
+
+// saveBridgeSecret stores a generated secret of a bridge in the credential store.
+// If the config can't be saved afterwards, the previous value is put back in the credential store.
+func saveBridgeSecret(ctx *cli.Context, bridge, name, value string) error {
+	store, err := getBridgeCredentialStore(ctx, bridge)
+	if err != nil {
+		return err
+	}
+	key := bridgeCredentialKey(ctx, bridge, name)
+	previous, err := store.Get(key)
+	if err != nil {
+		return err
+	}
+	err = store.Set(key, value)
+	if err != nil {
+		return err
+	}
+	settings := GetEnvConfig(ctx).Bridges.Get(bridge)
+	if slices.Contains(settings.Secrets, name) && settings.CredentialStore == store.Kind() {
+		return nil
+	}
+	previousStore, previousSecrets := settings.CredentialStore, settings.Secrets
+	useBridgeCredentialStore(ctx, bridge, store)
+	if !slices.Contains(settings.Secrets, name) {
+		settings.Secrets = append(slices.Clip(settings.Secrets), name)
+	}
+	err = GetConfig(ctx).Save()
+	if err != nil {
+		settings.CredentialStore, settings.Secrets = previousStore, previousSecrets
+		var rollbackErr error
+		if previous == "" {
+			rollbackErr = store.Delete(key)
+		} else {
+			rollbackErr = store.Set(key, previous)
+		}
+		if rollbackErr != nil {
+			log.Printf("[red]Failed to restore the previous %s of %s in %s: %v[reset]", name, bridge, store.Name(), rollbackErr)
+		}
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	return nil
+}
+
+// getProvisioningSecret returns the provisioning secret of a bridge. New bridges get a random secret, while existing
+// bridges keep using the account-wide login token until the secret is rotated with `bbctl secrets rotate`.
+// If readOnly is set, a new secret is generated, but not saved.
+func getProvisioningSecret(ctx *cli.Context, bridge string, isNew bool, legacySecret string, readOnly bool) (string, error) {
+	secret, err := loadBridgeSecret(ctx, bridge, secretProvisioning)
+	if err != nil {
+		return "", fmt.Errorf("failed to load provisioning secret: %w", err)
+	} else if secret != "" {
+		return secret, nil
+	} else if !isNew {
+		log.Printf("[yellow]%s uses the account-wide provisioning secret, run `bbctl secrets rotate %s` to switch to a per-bridge secret[reset]", bridge, bridge)
+		return legacySecret, nil
+	}
+	secret = random.String(64)
+	if readOnly {
+		return secret, nil
+	}
+	err = saveBridgeSecret(ctx, bridge, secretProvisioning, secret)
+	if err != nil {
+		return "", fmt.Errorf("failed to save provisioning secret: %w", err)
+	}
+	return secret, nil
+}
+
+// ensurePickleKey generates a random encryption pickle key for new bridges. Existing bridges keep the default key of
+// the template, because the key can't be changed without losing the encryption keys stored in the bridge database.
+func ensurePickleKey(ctx *cli.Context, bridge, bridgeType string, isNew bool) error {
+	meta := bridgeconfig.GetMetadata(bridgeType)
+	if !isNew || meta.GetParam(paramPickleKey) == nil {
+		return nil
+	}
+	savedParams, err := loadSavedParams(ctx, bridge)
+	if err != nil {
+		return fmt.Errorf("failed to load saved params: %w", err)
+	} else if _, ok := savedParams[paramPickleKey]; ok {
+		return nil
+	}
+	err = saveBridgeParams(ctx, bridge, meta, map[string]string{paramPickleKey: random.String(64)})
+	if err != nil {
+		return fmt.Errorf("failed to save pickle key: %w", err)
+	}
+	return nil
+}
+
+// deleteBridgeSecrets removes the generated secrets of a bridge from the credential store.
+// The config must be saved separately.
+func deleteBridgeSecrets(ctx *cli.Context, bridge string) error {
+	settings, ok := GetEnvConfig(ctx).Bridges[bridge]
+	if !ok || settings == nil || len(settings.Secrets) == 0 {
+		return nil
+	}
+	store, err := getBridgeCredentialStore(ctx, bridge)
+	if err != nil {
+		return err
+	}
+	for _, name := range settings.Secrets {
+		err = store.Delete(bridgeCredentialKey(ctx, bridge, name))
+		if err != nil {
+			return err
+		}
+	}
+	settings.Secrets = nil
+	return nil
+}
+
+// The config option that contains the provisioning secret. Some bridges have it in a parent section.
+const provisioningSecretPath = "provisioning.shared_secret"
+
+// replaceProvisioningSecretInFile replaces the provisioning secret in a config file if it's the old secret.
+// Missing files are ignored.
+func replaceProvisioningSecretInFile(path, oldSecret, newSecret string) (bool, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return false, nil
+	} else if err != nil {
+		return false, err
+	}
+	updated, count, err := bridgeconfig.ReplaceValuesAt(string(data), provisioningSecretPath, map[string]string{oldSecret: newSecret})
+	if err != nil {
+		return false, err
+	} else if count == 0 {
+		return false, nil
+	}
+	tmpPath := path + ".tmp"
+	err = os.WriteFile(tmpPath, []byte(updated), 0600)
+	if err != nil {
+		return false, err
+	}
+	err = os.Rename(tmpPath, path)
+	if err != nil {
+		_ = os.Remove(tmpPath)
+		return false, err
+	}
+	return true, nil
+}
+
+func rotateBridgeSecrets(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return UserError{"You must specify a bridge to rotate the secrets of"}
+	} else if ctx.NArg() > 1 {
+		return UserError{"Too many arguments specified (flags must come before arguments)"}
+	}
+	bridge := ctx.Args().Get(0)
+	if err := validateBridgeName(ctx, bridge); err != nil {
+		return err
+	}
+	oldSecret, err := loadBridgeSecret(ctx, bridge, secretProvisioning)
+	if err != nil {
+		return fmt.Errorf("failed to load provisioning secret: %w", err)
+	} else if oldSecret == "" && !GetEnvConfig(ctx).IsStandalone() {
+		whoami, err := getCachedWhoami(ctx)
+		if err != nil {
+			return err
+		}
+		oldSecret = whoami.User.AsmuxData.LoginToken
+	}
+	if oldSecret == "" {
+		return UserError{fmt.Sprintf("Couldn't determine the current provisioning secret of %s, so the existing config can't be updated", bridge)}
+	}
+	newSecret := random.String(64)
+
+	// Update the existing config too, so the secret changes even if the config isn't regenerated on start.
+	// The new secret is only saved after the files are updated, and the files are restored if anything fails.
+	configPath := filepath.Join(GetEnvConfig(ctx).BridgeDataDir, bridge, ctx.String("config-file"))
+	var updatedFiles []string
+	for _, path := range []string{configPath, lastGeneratedConfigPath(configPath)} {
+		var updated bool
+		updated, err = replaceProvisioningSecretInFile(path, oldSecret, newSecret)
+		if err != nil {
+			err = fmt.Errorf("failed to update %s: %w", path, err)
+			break
+		} else if updated {
+			updatedFiles = append(updatedFiles, path)
+		}
+	}
+	if err == nil {
+		err = saveBridgeSecret(ctx, bridge, secretProvisioning, newSecret)
+		if err != nil {
+			err = fmt.Errorf("failed to save new provisioning secret: %w", err)
+		}
+	}
+	if err != nil {
+		for _, path := range updatedFiles {
+			if _, rollbackErr := replaceProvisioningSecretInFile(path, newSecret, oldSecret); rollbackErr != nil {
+				log.Printf("[red]Failed to restore the old provisioning secret in %s: %v[reset]", path, rollbackErr)
+			}
+		}
+		return err
+	}
+	for _, path := range updatedFiles {
+		log.Printf("Updated provisioning secret in [magenta]%s[reset]", path)
+		if path == configPath {
+			if content, err := os.ReadFile(path); err == nil {
+				recordConfigRevision(path, string(content), &configRevision{Source: "bbctl secrets rotate"})
+			}
+		}
+	}
+	log.Printf("[green]Rotated the provisioning secret of %s.[reset] Restart the bridge to start using it.", bridge)
+	return nil
+}
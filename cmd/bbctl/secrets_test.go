@@ -0,0 +1,109 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/beeper/bridge-manager/api/beeperapi"
+)
+
+func TestRotateBridgeSecrets_Rollback(t *testing.T) {
+	const bridge = "sh-signal"
+	const legacySecret = "legacy-secret"
+	const storedSecret = "stored-secret"
+	cachedWhoami = &beeperapi.RespWhoami{User: beeperapi.WhoamiUser{AsmuxData: beeperapi.WhoamiAsmuxData{LoginToken: legacySecret}}}
+	t.Cleanup(func() {
+		cachedWhoami = nil
+	})
+	tests := []struct {
+		name string
+		// The secret in the credential store before rotating, empty for bridges using the legacy secret
+		stored string
+		// Make writing the bbctl config or the bridge config fail
+		failConfigSave bool
+		failBridgeFile bool
+		wantErr        string
+	}{
+		{name: "legacy secret", stored: ""},
+		{name: "stored secret", stored: storedSecret},
+		{name: "bbctl config write fails", stored: "", failConfigSave: true, wantErr: "failed to save config"},
+		{name: "bridge config write fails", stored: storedSecret, failBridgeFile: true, wantErr: "failed to update"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			dataDir := t.TempDir()
+			ctx := newTestContext(t, &EnvConfig{BridgeDataDir: dataDir}, []cli.Flag{
+				&cli.StringFlag{Name: "env", Value: "prod"},
+				&cli.StringFlag{Name: "credential-store", Value: "file"},
+				&cli.StringFlag{Name: "config-file", Value: "config.yaml"},
+			}, bridge)
+			oldSecret := test.stored
+			if oldSecret == "" {
+				oldSecret = legacySecret
+			}
+			configPath := filepath.Join(dataDir, bridge, "config.yaml")
+			oldConfig := "provisioning:\n    shared_secret: " + oldSecret + "\n"
+			if err := os.MkdirAll(filepath.Dir(configPath), 0700); err != nil {
+				t.Fatal(err)
+			} else if err = os.WriteFile(configPath, []byte(oldConfig), 0600); err != nil {
+				t.Fatal(err)
+			}
+			if test.stored != "" {
+				if err := saveBridgeSecret(ctx, bridge, secretProvisioning, test.stored); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.failConfigSave {
+				// Opening a directory for writing fails even when running as root
+				cfg := GetConfig(ctx)
+				if err := os.Mkdir(cfg.Path, 0700); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if test.failBridgeFile {
+				if err := os.Mkdir(configPath+".tmp", 0700); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			err := rotateBridgeSecrets(ctx)
+			gotSecret, loadErr := loadBridgeSecret(ctx, bridge, secretProvisioning)
+			if loadErr != nil {
+				t.Fatal(loadErr)
+			}
+			gotConfig, readErr := os.ReadFile(configPath)
+			if readErr != nil {
+				t.Fatal(readErr)
+			}
+			if test.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				} else if gotSecret == "" || gotSecret == oldSecret {
+					t.Errorf("secret wasn't rotated: %q", gotSecret)
+				} else if string(gotConfig) != "provisioning:\n    shared_secret: "+gotSecret+"\n" {
+					t.Errorf("config doesn't have the new secret:\n%s", gotConfig)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", test.wantErr, err)
+			}
+			if gotSecret != test.stored {
+				t.Errorf("credential store has %q after failed rotation, want %q", gotSecret, test.stored)
+			}
+			store, storeErr := openCredentialStore(ctx, "file")
+			if storeErr != nil {
+				t.Fatal(storeErr)
+			} else if value, _ := store.Get(bridgeCredentialKey(ctx, bridge, secretProvisioning)); value != test.stored {
+				t.Errorf("credential store entry is %q after failed rotation, want %q", value, test.stored)
+			}
+			if string(gotConfig) != oldConfig {
+				t.Errorf("config wasn't restored after failed rotation:\n%s", gotConfig)
+			}
+		})
+	}
+}
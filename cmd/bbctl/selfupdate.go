@@ -0,0 +1,299 @@
+package main
+
+import (
+	"bufio"
+	"cmp"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/schollz/progressbar/v3"
+	"github.com/urfave/cli/v2"
+
+	"github.com/beeper/bridge-manager/api/github"
+	"github.com/beeper/bridge-manager/cli/hyper"
+	"github.com/beeper/bridge-manager/log"
+)
+
+var selfUpdateCommand = &cli.Command{
+	Name:  "self-update",
+	Usage: "Update bbctl to the latest release",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:  "check",
+			Usage: "Only check if an update is available, don't install it.",
+		},
+		&cli.BoolFlag{
+			Name:  "force",
+			Usage: "Reinstall the latest release even if it's not newer than the current version.",
+		},
+	},
+	Action: selfUpdate,
+}
+
+const updateCheckInterval = 24 * time.Hour
+
+// selfUpdateDisabledReason returns a non-empty string if bbctl shouldn't update itself,
+// e.g. because it was installed with a package manager.
+func selfUpdateDisabledReason() string {
+	if PackageManager != "" {
+		return fmt.Sprintf("bbctl was installed with %s, please use it to update bbctl", PackageManager)
+	} else if os.Getenv("BBCTL_DISABLE_SELF_UPDATE") != "" {
+		return "self-update is disabled with BBCTL_DISABLE_SELF_UPDATE"
+	}
+	return ""
+}
+
+func getReleaseAssetName() string {
+	goos := runtime.GOOS
+	if goos == "darwin" {
+		goos = "macos"
+	}
+	return fmt.Sprintf("bbctl-%s-%s", goos, runtime.GOARCH)
+}
+
+// parseVersion parses a vX.Y.Z version string. Missing minor or patch numbers are treated as zero,
+// and any build metadata or prerelease suffix is ignored.
+func parseVersion(version string) (parts [3]int, ok bool) {
+	version = strings.TrimPrefix(version, "v")
+	if idx := strings.IndexAny(version, "+-"); idx >= 0 {
+		version = version[:idx]
+	}
+	split := strings.Split(version, ".")
+	if len(split) > 3 {
+		return parts, false
+	}
+	for i, part := range split {
+		var err error
+		parts[i], err = strconv.Atoi(part)
+		if err != nil {
+			return parts, false
+		}
+	}
+	return parts, true
+}
+
+// compareVersions compares the first n components of two versions like cmp.Compare.
+// ok is false if either version can't be parsed.
+func compareVersions(a, b string, n int) (result int, ok bool) {
+	aParts, aOK := parseVersion(a)
+	bParts, bOK := parseVersion(b)
+	if !aOK || !bOK {
+		return 0, false
+	}
+	for i := 0; i < n && i < len(aParts); i++ {
+		if aParts[i] != bParts[i] {
+			return cmp.Compare(aParts[i], bParts[i]), true
+		}
+	}
+	return 0, true
+}
+
+// isNewerVersion returns true if latest is a higher version than current.
+func isNewerVersion(latest, current string) bool {
+	if _, ok := parseVersion(latest); !ok {
+		return false
+	}
+	result, ok := compareVersions(latest, current, 3)
+	return !ok || result > 0
+}
+
+// The release asset that contains the SHA-256 checksums of the binaries for all platforms.
+const releaseChecksumAsset = "sha256sums.txt"
+
+func findChecksum(ctx context.Context, checksumAsset *github.Asset, assetName string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, checksumAsset.DownloadURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to prepare request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download checksums: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download checksums: unexpected response status %d", resp.StatusCode)
+	}
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == assetName {
+			return strings.ToLower(fields[0]), nil
+		}
+	}
+	if err = scanner.Err(); err != nil {
+		return "", fmt.Errorf("failed to read checksums: %w", err)
+	}
+	return "", nil
+}
+
+func getReleaseChecksum(ctx context.Context, release *github.Release, assetName string) (string, error) {
+	for _, asset := range release.Assets {
+		if asset.Name != releaseChecksumAsset {
+			continue
+		}
+		checksum, err := findChecksum(ctx, asset, assetName)
+		if err != nil {
+			return "", err
+		} else if checksum == "" {
+			return "", fmt.Errorf("%s in release %s doesn't have a checksum for %s", releaseChecksumAsset, release.TagName, assetName)
+		}
+		return checksum, nil
+	}
+	return "", fmt.Errorf("release %s doesn't have %s", release.TagName, releaseChecksumAsset)
+}
+
+// downloadRelease downloads the given asset next to the target path and verifies its checksum.
+// The returned temp file must be moved into place or removed by the caller.
+func downloadRelease(ctx context.Context, asset *github.Asset, checksum, targetPath string) (string, error) {
+	file, err := os.CreateTemp(filepath.Dir(targetPath), "tmp-bbctl-*")
+	if err != nil {
+		return "", fmt.Errorf("failed to open temp file: %w", err)
+	}
+	ok := false
+	defer func() {
+		_ = file.Close()
+		if !ok {
+			_ = os.Remove(file.Name())
+		}
+	}()
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, asset.DownloadURL, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to prepare download request: %w", err)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to download release: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to download release: unexpected response status %d", resp.StatusCode)
+	}
+	bar := progressbar.DefaultBytes(resp.ContentLength, fmt.Sprintf("Downloading %s", color.CyanString(asset.Name)))
+	hasher := sha256.New()
+	_, err = io.Copy(io.MultiWriter(file, bar, hasher), resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to write file: %w", err)
+	}
+	if actual := hex.EncodeToString(hasher.Sum(nil)); actual != checksum {
+		return "", fmt.Errorf("checksum mismatch for %s: expected %s, got %s", asset.Name, checksum, actual)
+	}
+	_ = file.Close()
+	err = os.Chmod(file.Name(), 0755)
+	if err != nil {
+		return "", fmt.Errorf("failed to chmod binary: %w", err)
+	}
+	ok = true
+	return file.Name(), nil
+}
+
+func selfUpdate(ctx *cli.Context) error {
+	if reason := selfUpdateDisabledReason(); reason != "" && !ctx.Bool("check") {
+		return UserError{reason}
+	}
+	release, err := github.GetLatestRelease(ctx.Context, github.BridgeManagerRepo)
+	if err != nil {
+		return fmt.Errorf("failed to get latest release: %w", err)
+	}
+	saveUpdateCheck(ctx, release.TagName)
+	if !isNewerVersion(release.TagName, Version) && !ctx.Bool("force") {
+		log.Printf("bbctl is up to date (current version: [cyan]%s[reset], latest release: [cyan]%s[reset])", Version, release.TagName)
+		return nil
+	} else if ctx.Bool("check") {
+		log.Printf("bbctl [cyan]%s[reset] is available (current version: [cyan]%s[reset]): %s", release.TagName, Version, hyper.Link(release.HTMLURL, release.HTMLURL, false))
+		return nil
+	}
+	assetName := getReleaseAssetName()
+	asset := release.FindAsset(assetName)
+	if asset == nil {
+		return UserError{fmt.Sprintf("Release %s doesn't have a binary for %s/%s", release.TagName, runtime.GOOS, runtime.GOARCH)}
+	}
+	checksum, err := getReleaseChecksum(ctx.Context, release, assetName)
+	if err != nil {
+		return err
+	}
+	executable, err := os.Executable()
+	if err != nil {
+		return fmt.Errorf("failed to find current executable: %w", err)
+	}
+	executable, err = filepath.EvalSymlinks(executable)
+	if err != nil {
+		return fmt.Errorf("failed to resolve current executable path: %w", err)
+	}
+	tempPath, err := downloadRelease(ctx.Context, asset, checksum, executable)
+	if err != nil {
+		return err
+	}
+	// Make sure the new binary actually runs on this system before replacing the old one
+	if output, err := exec.CommandContext(ctx.Context, tempPath, "--version").CombinedOutput(); err != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("downloaded binary failed to run: %w (output: %s)", err, strings.TrimSpace(string(output)))
+	}
+	// Renaming over the executable is atomic and works even while it's running
+	err = os.Rename(tempPath, executable)
+	if err != nil {
+		_ = os.Remove(tempPath)
+		return fmt.Errorf("failed to replace %s: %w", executable, err)
+	}
+	log.Printf("[green]Updated bbctl from %s to %s[reset]", Version, release.TagName)
+	return nil
+}
+
+type updateCheckState struct {
+	CheckedAt     time.Time `json:"checked_at"`
+	LatestVersion string    `json:"latest_version"`
+}
+
+func getUpdateCheckStatePath(ctx *cli.Context) string {
+	return filepath.Join(filepath.Dir(GetConfig(ctx).Path), "update-check.json")
+}
+
+// saveUpdateCheck stores the time of the last update check. It's stored separately from the main config,
+// because the check runs in the background and must not race with commands that save the config.
+func saveUpdateCheck(ctx *cli.Context, latestVersion string) {
+	data, err := json.Marshal(&updateCheckState{CheckedAt: time.Now(), LatestVersion: latestVersion})
+	if err == nil {
+		_ = os.WriteFile(getUpdateCheckStatePath(ctx), data, 0600)
+	}
+}
+
+// startUpdateCheck checks for new bbctl releases in the background at most once a day
+// and prints a notice if the current version is outdated.
+func startUpdateCheck(ctx *cli.Context) {
+	if ctx.Bool("no-update-check") || selfUpdateDisabledReason() != "" {
+		return
+	}
+	switch ctx.Args().First() {
+	case "self-update", "help", "h", "":
+		return
+	}
+	var state updateCheckState
+	data, err := os.ReadFile(getUpdateCheckStatePath(ctx))
+	if err == nil && json.Unmarshal(data, &state) == nil && time.Since(state.CheckedAt) < updateCheckInterval {
+		return
+	}
+	go func() {
+		checkCtx, cancel := context.WithTimeout(ctx.Context, 10*time.Second)
+		defer cancel()
+		release, err := github.GetLatestRelease(checkCtx, github.BridgeManagerRepo)
+		if err != nil {
+			return
+		}
+		saveUpdateCheck(ctx, release.TagName)
+		if isNewerVersion(release.TagName, Version) {
+			log.Printf("[yellow]A new version of bbctl is available: %s (current version: %s). Run `bbctl self-update` to update.[reset]", release.TagName, Version)
+		}
+	}()
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/beeper/bridge-manager/api/github"
+)
+
+func TestGetReleaseChecksum(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/sha256sums.txt":
+			_, _ = w.Write([]byte("AAAA  bbctl-linux-amd64\nbbbb *bbctl-macos-arm64\n"))
+		case "/sha256sums-linux.txt":
+			_, _ = w.Write([]byte("cccc  bbctl-linux-amd64\n"))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer server.Close()
+	allPlatforms := &github.Asset{Name: "sha256sums.txt", DownloadURL: server.URL + "/sha256sums.txt"}
+	linuxOnly := &github.Asset{Name: "sha256sums-linux.txt", DownloadURL: server.URL + "/sha256sums-linux.txt"}
+	missing := &github.Asset{Name: "sha256sums.txt", DownloadURL: server.URL + "/missing"}
+	tests := []struct {
+		name      string
+		assets    []*github.Asset
+		assetName string
+		want      string
+		wantErr   string
+	}{
+		{"linux", []*github.Asset{linuxOnly, allPlatforms}, "bbctl-linux-amd64", "aaaa", ""},
+		{"macos", []*github.Asset{allPlatforms}, "bbctl-macos-arm64", "bbbb", ""},
+		{"not in checksums", []*github.Asset{allPlatforms}, "bbctl-macos-amd64", "", "doesn't have a checksum for bbctl-macos-amd64"},
+		{"only per-platform file", []*github.Asset{linuxOnly}, "bbctl-linux-amd64", "", "doesn't have sha256sums.txt"},
+		{"download fails", []*github.Asset{missing}, "bbctl-linux-amd64", "", "unexpected response status 404"},
+	}
+	for _, test := range tests {
+		release := &github.Release{TagName: "v1.0.0", Assets: test.assets}
+		got, err := getReleaseChecksum(context.Background(), release, test.assetName)
+		if test.wantErr != "" {
+			if err == nil || !strings.Contains(err.Error(), test.wantErr) {
+				t.Errorf("%s: expected error containing %q, got %v", test.name, test.wantErr, err)
+			}
+		} else if err != nil {
+			t.Errorf("%s: unexpected error: %v", test.name, err)
+		} else if got != test.want {
+			t.Errorf("%s: got %q, want %q", test.name, got, test.want)
+		}
+	}
+}
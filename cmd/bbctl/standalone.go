@@ -0,0 +1,202 @@
+package main
+
+import (
+	"cmp"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+	"maunium.net/go/mautrix/appservice"
+	"maunium.net/go/mautrix/id"
+
+	"github.com/beeper/bridge-manager/log"
+)
+
+var standaloneCommand = &cli.Command{
+	Name:  "standalone",
+	Usage: "Use bridges with a standard Matrix homeserver instead of Beeper",
+	Subcommands: []*cli.Command{
+		{
+			Name:  "setup",
+			Usage: "Configure the current env to register bridges to a standalone homeserver",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:  "homeserver-url",
+					Usage: "The address bridges use to connect to the homeserver, e.g. http://localhost:8008",
+				},
+				&cli.StringFlag{
+					Name:  "domain",
+					Usage: "The server name of the homeserver, i.e. the part after the colon in user IDs. Defaults to the server name of --admin.",
+				},
+				&cli.StringFlag{
+					Name:  "admin",
+					Usage: "Your Matrix user ID, which is given admin access to the bridges",
+				},
+				&cli.StringFlag{
+					Name:  "bridge-host",
+					Usage: "The address bridges listen on for requests from the homeserver. Must be reachable from the homeserver.",
+					Value: "127.0.0.1",
+				},
+			},
+			Action: setupStandaloneHomeserver,
+		},
+	},
+}
+
+// The name of the appservice registration file that is generated in the bridge directory in standalone mode.
+const standaloneRegistrationFile = "registration.yaml"
+
+func setupStandaloneHomeserver(ctx *cli.Context) error {
+	env := ctx.String("env")
+	if _, ok := envs[env]; ok {
+		return UserError{fmt.Sprintf("%s is a Beeper env, use a different name for standalone homeservers (e.g. `bbctl --env myserver standalone setup`)", env)}
+	}
+	envConfig := GetEnvConfig(ctx)
+	standalone := envConfig.Standalone
+	if standalone == nil {
+		standalone = &StandaloneConfig{}
+	}
+	standalone.HomeserverURL = cmp.Or(ctx.String("homeserver-url"), standalone.HomeserverURL)
+	standalone.AdminUserID = id.UserID(cmp.Or(ctx.String("admin"), string(standalone.AdminUserID)))
+	if ctx.IsSet("bridge-host") || standalone.BridgeHost == "" {
+		standalone.BridgeHost = ctx.String("bridge-host")
+	}
+	if standalone.HomeserverURL == "" {
+		return UserError{"You must specify the homeserver address with --homeserver-url"}
+	} else if parsedURL, err := url.Parse(standalone.HomeserverURL); err != nil || (parsedURL.Scheme != "http" && parsedURL.Scheme != "https") || parsedURL.Host == "" {
+		return UserError{fmt.Sprintf("Invalid homeserver URL %q, expected something like http://localhost:8008", standalone.HomeserverURL)}
+	}
+	if standalone.AdminUserID == "" {
+		return UserError{"You must specify your Matrix user ID with --admin"}
+	}
+	_, adminServer, err := standalone.AdminUserID.Parse()
+	if err != nil {
+		return UserError{fmt.Sprintf("Invalid user ID %q: %v", standalone.AdminUserID, err)}
+	}
+	standalone.Domain = cmp.Or(ctx.String("domain"), standalone.Domain, adminServer)
+	envConfig.Standalone = standalone
+	err = GetConfig(ctx).Save()
+	if err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+	log.Printf("[green]Configured[reset] the [cyan]%s[reset] env to use [cyan]%s[reset] (%s)", env, standalone.Domain, standalone.HomeserverURL)
+	log.Printf("Run bridges with [cyan]bbctl --env %s run <name>[reset] and add the generated registration.yaml to your homeserver config", env)
+	return nil
+}
+
+func getStandaloneRegistrationPath(ctx *cli.Context, bridge string) string {
+	return filepath.Join(GetEnvConfig(ctx).BridgeDataDir, bridge, standaloneRegistrationFile)
+}
+
+// standaloneBridgeExists checks if a bridge has been registered in standalone mode.
+func standaloneBridgeExists(ctx *cli.Context, bridge string) bool {
+	_, err := os.Stat(getStandaloneRegistrationPath(ctx, bridge))
+	return err == nil
+}
+
+// getStandaloneBridgeType returns the type of a bridge in standalone mode, where there's no server to ask.
+func getStandaloneBridgeType(ctx *cli.Context, bridge string) (string, error) {
+	if settings, ok := GetEnvConfig(ctx).Bridges[bridge]; ok && settings != nil && settings.Type != "" {
+		return settings.Type, nil
+	}
+	return guessOrAskBridgeType(bridge, ctx.String("type"))
+}
+
+// registerStandaloneBridge loads the registration of a bridge in standalone mode,
+// or generates a new one with random tokens if it doesn't exist yet.
+func registerStandaloneBridge(ctx *cli.Context, bridge, bridgeType string, onlyGet bool) (*RegisterJSON, error) {
+	standalone := GetEnvConfig(ctx).Standalone
+	regPath := getStandaloneRegistrationPath(ctx, bridge)
+	reg, err := appservice.LoadRegistration(regPath)
+	if errors.Is(err, fs.ErrNotExist) {
+		if onlyGet {
+			return nil, UserError{fmt.Sprintf("You don't have a %s bridge.", color.CyanString(bridge))}
+		}
+		reg = appservice.CreateRegistration()
+		reg.ID = bridge
+		reg.SenderLocalpart = bridge + "bot"
+		reg.Namespaces.UserIDs.Register(regexp.MustCompile(fmt.Sprintf(
+			"^@%s_.+:%s$", regexp.QuoteMeta(bridge), regexp.QuoteMeta(standalone.Domain),
+		)), true)
+		rateLimited := false
+		reg.RateLimited = &rateLimited
+		reg.SoruEphemeralEvents = true
+		reg.EphemeralEvents = true
+		reg.URL = ctx.String("address")
+		if reg.URL == "" {
+			_, port, _ := getBridgeWebsocketProxyConfig(bridge, bridgeType)
+			reg.URL = fmt.Sprintf("http://%s", net.JoinHostPort(cmp.Or(standalone.BridgeHost, "127.0.0.1"), strconv.Itoa(int(port))))
+		}
+		err = os.MkdirAll(filepath.Dir(regPath), 0700)
+		if err != nil {
+			return nil, fmt.Errorf("failed to create bridge directory: %w", err)
+		}
+		err = reg.Save(regPath)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save registration: %w", err)
+		}
+		log.Printf("Generated appservice registration at [magenta]%s[reset]", regPath)
+		log.Printf("[yellow]Add it to the app_service_config_files list in your homeserver config and restart the homeserver[reset]")
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to load registration: %w", err)
+	}
+	return &RegisterJSON{
+		Registration:     reg,
+		HomeserverURL:    standalone.HomeserverURL,
+		HomeserverDomain: standalone.Domain,
+		YourUserID:       standalone.AdminUserID,
+	}, nil
+}
+
+// parseAppserviceURL returns the host and port that a bridge should listen on based on its registration.
+func parseAppserviceURL(addr string) (string, uint16, error) {
+	parsedURL, err := url.Parse(addr)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid appservice URL %q: %w", addr, err)
+	}
+	port := parsedURL.Port()
+	if port == "" {
+		return "", 0, fmt.Errorf("appservice URL %q doesn't have a port", addr)
+	}
+	portNum, err := strconv.ParseUint(port, 10, 16)
+	if err != nil {
+		return "", 0, fmt.Errorf("invalid port in appservice URL %q: %w", addr, err)
+	}
+	return parsedURL.Hostname(), uint16(portNum), nil
+}
+
+func printStandaloneInfo(ctx *cli.Context) error {
+	standalone := GetEnvConfig(ctx).Standalone
+	if ctx.Bool("raw") {
+		data, err := json.MarshalIndent(standalone, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to marshal JSON: %w", err)
+		}
+		fmt.Println(string(data))
+		return nil
+	}
+	names, err := listBridgeDataDirs(GetEnvConfig(ctx).BridgeDataDir)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Homeserver: %s (%s, %s)\n", color.CyanString(standalone.Domain), standalone.HomeserverURL, color.HiGreenString("standalone"))
+	fmt.Printf("Admin: %s\n", color.GreenString(standalone.AdminUserID.String()))
+	fmt.Println("Bridges:")
+	for _, name := range names {
+		if !standaloneBridgeExists(ctx, name) {
+			continue
+		}
+		bridgeType := cmp.Or(savedBridgeType(ctx, name), guessBridgeType(name), "unknown type")
+		fmt.Printf("* %s (%s) - %s\n", color.CyanString(name), bridgeType, getStandaloneRegistrationPath(ctx, name))
+	}
+	return nil
+}
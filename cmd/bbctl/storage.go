@@ -0,0 +1,556 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"github.com/AlecAivazis/survey/v2"
+	"github.com/urfave/cli/v2"
+
+	"github.com/beeper/bridge-manager/log"
+)
+
+var duCommand = &cli.Command{
+	Name:   "du",
+	Usage:  "Show disk space used by bridges, binaries and build directories",
+	Action: showDiskUsage,
+}
+
+var pruneCommand = &cli.Command{
+	Name:  "prune",
+	Usage: "Remove unused binaries, build directories, old logs and other leftover files",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "dry-run",
+			Aliases: []string{"n"},
+			Usage:   "Only list the files that would be removed.",
+		},
+		&cli.StringFlag{
+			Name:  "binary-age",
+			Value: "30d",
+			Usage: "Minimum age of unused binaries, build directories and previous Python virtualenvs to remove, e.g. 30d or 12h.",
+		},
+		&cli.StringFlag{
+			Name:  "log-age",
+			Value: "14d",
+			Usage: "Minimum age of rotated log files to remove.",
+		},
+		&cli.BoolFlag{
+			Name:  "deleted-bridges",
+			Usage: "Also remove the data directories (including databases) of bridges that no longer exist on the server.",
+		},
+		&cli.BoolFlag{
+			Name:    "yes",
+			Aliases: []string{"y"},
+			Usage:   "Don't ask for confirmation before removing the data of deleted bridges.",
+		},
+	},
+	Action: pruneBridgeData,
+}
+
+// Files next to binaries that belong to the binary with the same name without the suffix.
+var binarySidecarSuffixes = []string{".build.json", ".build-id"}
+
+// Temporary files from interrupted downloads and builds are only removed after this long,
+// so that prune doesn't break an install that is currently running.
+const tempFileMinAge = time.Hour
+
+func parseAge(val string) (time.Duration, error) {
+	if days, ok := strings.CutSuffix(val, "d"); ok {
+		n, err := strconv.Atoi(days)
+		if err != nil || n < 0 {
+			return 0, UserError{fmt.Sprintf("Invalid age %q", val)}
+		}
+		return time.Duration(n) * 24 * time.Hour, nil
+	}
+	dur, err := time.ParseDuration(val)
+	if err != nil || dur < 0 {
+		return 0, UserError{fmt.Sprintf("Invalid age %q", val)}
+	}
+	return dur, nil
+}
+
+func formatSize(bytes int64) string {
+	const unit = 1024
+	if bytes < unit {
+		return fmt.Sprintf("%d B", bytes)
+	}
+	div, exp := int64(unit), 0
+	for n := bytes / unit; n >= unit; n /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(bytes)/float64(div), "KMGTPE"[exp])
+}
+
+// diskUsage returns the total size of the regular files in the given path, which may be a file or a directory.
+func diskUsage(path string) (int64, error) {
+	var total int64
+	err := filepath.WalkDir(path, func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		} else if !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		total += info.Size()
+		return nil
+	})
+	return total, err
+}
+
+func isDatabaseFile(name string) bool {
+	return strings.HasSuffix(name, ".db") || strings.HasSuffix(name, ".db-wal") || strings.HasSuffix(name, ".db-shm")
+}
+
+func isVenvDir(name string) bool {
+	return name == "venv" || name == "venv.new" || name == "venv.previous"
+}
+
+type bridgeDiskUsage struct {
+	Name     string
+	Database int64
+	Logs     int64
+	Venv     int64
+	Other    int64
+}
+
+func (bdu *bridgeDiskUsage) Total() int64 {
+	return bdu.Database + bdu.Logs + bdu.Venv + bdu.Other
+}
+
+func getBridgeDiskUsage(bridgeDir string) (*bridgeDiskUsage, error) {
+	entries, err := os.ReadDir(bridgeDir)
+	if err != nil {
+		return nil, err
+	}
+	usage := &bridgeDiskUsage{Name: filepath.Base(bridgeDir)}
+	for _, entry := range entries {
+		size, err := diskUsage(filepath.Join(bridgeDir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case entry.Name() == "logs":
+			usage.Logs += size
+		case isVenvDir(entry.Name()):
+			usage.Venv += size
+		case isDatabaseFile(entry.Name()):
+			usage.Database += size
+		default:
+			usage.Other += size
+		}
+	}
+	return usage, nil
+}
+
+// listBridgeDataDirs returns the names of all bridge directories in the bridge data dir, including ones with unknown types.
+func listBridgeDataDirs(dataDir string) ([]string, error) {
+	entries, err := os.ReadDir(dataDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read bridge data directory: %w", err)
+	}
+	var names []string
+	for _, entry := range entries {
+		if entry.IsDir() && !nonBridgeDataDirs[entry.Name()] {
+			names = append(names, entry.Name())
+		}
+	}
+	return names, nil
+}
+
+// getRemoteBridges returns the set of bridges that exist on the server, or nil if they can't be fetched.
+func getRemoteBridges(ctx *cli.Context) map[string]bool {
+	if !GetEnvConfig(ctx).HasCredentials() {
+		return nil
+	}
+	whoami, err := getCachedWhoami(ctx)
+	if err != nil {
+		log.Printf("[yellow]Failed to get bridge list from server: %v[reset]", err)
+		return nil
+	}
+	remote := make(map[string]bool, len(whoami.User.Bridges))
+	for name := range whoami.User.Bridges {
+		remote[name] = true
+	}
+	return remote
+}
+
+func showDiskUsage(ctx *cli.Context) error {
+	dataDir := GetEnvConfig(ctx).BridgeDataDir
+	names, err := listBridgeDataDirs(dataDir)
+	if err != nil {
+		return err
+	}
+	remote := getRemoteBridges(ctx)
+	var total int64
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "BRIDGE\tDATABASE\tLOGS\tVENV\tOTHER\tTOTAL\t")
+	for _, name := range names {
+		usage, err := getBridgeDiskUsage(filepath.Join(dataDir, name))
+		if err != nil {
+			return fmt.Errorf("failed to get disk usage of %s: %w", name, err)
+		}
+		total += usage.Total()
+		note := ""
+		if remote != nil && !remote[name] {
+			note = "not on server"
+		}
+		_, _ = fmt.Fprintf(
+			tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n", name, formatSize(usage.Database), formatSize(usage.Logs),
+			formatSize(usage.Venv), formatSize(usage.Other), formatSize(usage.Total()), note,
+		)
+	}
+	for _, dir := range []string{"binaries", "compile"} {
+		size, err := diskUsage(filepath.Join(dataDir, dir))
+		if err != nil {
+			return fmt.Errorf("failed to get disk usage of %s: %w", dir, err)
+		}
+		total += size
+		_, _ = fmt.Fprintf(tw, "%s/\t\t\t\t\t%s\t\n", dir, formatSize(size))
+	}
+	_, _ = fmt.Fprintf(tw, "TOTAL\t\t\t\t\t%s\t\n", formatSize(total))
+	err = tw.Flush()
+	if err != nil {
+		return err
+	}
+	if remote != nil {
+		for _, name := range names {
+			if !remote[name] {
+				log.Printf("Use [cyan]bbctl prune --deleted-bridges[reset] to remove the data of bridges that are not on the server")
+				break
+			}
+		}
+	}
+	return nil
+}
+
+type pruneCandidate struct {
+	Paths  []string
+	Reason string
+	Size   int64
+}
+
+type pruner struct {
+	DataDir   string
+	BinaryAge time.Duration
+	LogAge    time.Duration
+	Now       time.Time
+
+	Candidates []*pruneCandidate
+}
+
+func (p *pruner) add(reason string, paths ...string) error {
+	var size int64
+	for _, path := range paths {
+		pathSize, err := diskUsage(path)
+		if err != nil {
+			return err
+		}
+		size += pathSize
+	}
+	p.Candidates = append(p.Candidates, &pruneCandidate{Paths: paths, Reason: reason, Size: size})
+	return nil
+}
+
+func (p *pruner) olderThan(info fs.FileInfo, age time.Duration) bool {
+	return p.Now.Sub(info.ModTime()) >= age
+}
+
+// findUnusedBinaries finds binaries that aren't used by any bridge in the data directory,
+// as well as temporary files left behind by interrupted downloads.
+func (p *pruner) findUnusedBinaries(usedBinaries map[string]bool) error {
+	return filepath.WalkDir(filepath.Join(p.DataDir, "binaries"), func(path string, d fs.DirEntry, err error) error {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		} else if err != nil {
+			return err
+		} else if !d.Type().IsRegular() || d.Name() == "libolm.3.dylib" {
+			return nil
+		}
+		for _, suffix := range binarySidecarSuffixes {
+			if strings.HasSuffix(d.Name(), suffix) {
+				return nil
+			}
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		if strings.HasPrefix(d.Name(), "tmp-") {
+			if p.olderThan(info, tempFileMinAge) {
+				return p.add("incomplete download", path)
+			}
+			return nil
+		} else if usedBinaries[path] || !p.olderThan(info, p.BinaryAge) {
+			return nil
+		}
+		paths := []string{path}
+		for _, suffix := range binarySidecarSuffixes {
+			if _, err = os.Stat(path + suffix); err == nil {
+				paths = append(paths, path+suffix)
+			}
+		}
+		return p.add("unused binary", paths...)
+	})
+}
+
+func (p *pruner) checkCompileDir(buildDir string, used bool) error {
+	if used {
+		return nil
+	}
+	// The built binary is updated on every build, unlike the directory itself
+	info, err := os.Stat(filepath.Join(buildDir, filepath.Base(buildDir)))
+	if err != nil {
+		info, err = os.Stat(buildDir)
+		if err != nil {
+			return err
+		}
+	}
+	if p.olderThan(info, p.BinaryAge) {
+		return p.add("unused build directory", buildDir)
+	}
+	return nil
+}
+
+// findUnusedCompileDirs finds build directories of bridges that aren't in the data directory.
+// Build directories for cross-compiling are only used by install and bundle, so they're pruned based on age alone.
+func (p *pruner) findUnusedCompileDirs(usedBinaryNames map[string]bool) error {
+	compileDir := filepath.Join(p.DataDir, "compile")
+	entries, err := os.ReadDir(compileDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(compileDir, entry.Name())
+		if !entry.IsDir() {
+			continue
+		} else if _, err = os.Stat(filepath.Join(path, ".git")); err == nil {
+			err = p.checkCompileDir(path, usedBinaryNames[entry.Name()])
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		targetEntries, err := os.ReadDir(path)
+		if err != nil {
+			return err
+		}
+		for _, targetEntry := range targetEntries {
+			if targetEntry.IsDir() {
+				err = p.checkCompileDir(filepath.Join(path, targetEntry.Name()), false)
+				if err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// findOldLogs finds log files older than the log age. The most recently modified file is always kept,
+// as it's the one the bridge is currently writing to.
+func (p *pruner) findOldLogs(bridgeDir string) error {
+	logDir := filepath.Join(bridgeDir, "logs")
+	entries, err := os.ReadDir(logDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var files []fs.FileInfo
+	for _, entry := range entries {
+		if !entry.Type().IsRegular() {
+			continue
+		}
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		files = append(files, info)
+	}
+	sort.Slice(files, func(i, j int) bool {
+		return files[i].ModTime().After(files[j].ModTime())
+	})
+	for i, info := range files {
+		if i > 0 && p.olderThan(info, p.LogAge) {
+			err = p.add("old log file", filepath.Join(logDir, info.Name()))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// findLeftoverBridgeFiles finds SQLite WAL and shared memory files whose database has been deleted,
+// as well as Python virtualenvs left behind by upgrades.
+// WAL files of existing databases are never removed, as they may contain data that hasn't been checkpointed yet.
+func (p *pruner) findLeftoverBridgeFiles(bridgeDir string) error {
+	entries, err := os.ReadDir(bridgeDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(bridgeDir, entry.Name())
+		info, err := entry.Info()
+		if err != nil {
+			return err
+		}
+		switch {
+		case strings.HasSuffix(entry.Name(), ".db-wal"), strings.HasSuffix(entry.Name(), ".db-shm"):
+			dbPath := strings.TrimSuffix(strings.TrimSuffix(path, "-wal"), "-shm")
+			if _, err = os.Stat(dbPath); errors.Is(err, fs.ErrNotExist) {
+				err = p.add("database doesn't exist", path)
+			}
+		case entry.Name() == "venv.new" && p.olderThan(info, tempFileMinAge):
+			err = p.add("incomplete virtualenv", path)
+		case entry.Name() == "venv.previous" && p.olderThan(info, p.BinaryAge):
+			err = p.add("previous virtualenv", path)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func pruneBridgeData(ctx *cli.Context) error {
+	binaryAge, err := parseAge(ctx.String("binary-age"))
+	if err != nil {
+		return err
+	}
+	logAge, err := parseAge(ctx.String("log-age"))
+	if err != nil {
+		return err
+	}
+	p := &pruner{
+		DataDir:   GetEnvConfig(ctx).BridgeDataDir,
+		BinaryAge: binaryAge,
+		LogAge:    logAge,
+		Now:       time.Now(),
+	}
+	names, err := listBridgeDataDirs(p.DataDir)
+	if err != nil {
+		return err
+	}
+	var remote map[string]bool
+	if ctx.Bool("deleted-bridges") {
+		if !GetEnvConfig(ctx).HasCredentials() {
+			return UserError{"You must be logged in to use --deleted-bridges"}
+		}
+		remote = getRemoteBridges(ctx)
+		if remote == nil {
+			return fmt.Errorf("failed to get bridge list from server")
+		}
+	}
+
+	bridges, err := listLocalBridges(ctx)
+	if err != nil {
+		return err
+	}
+	usedBinaries := make(map[string]bool)
+	usedBinaryNames := make(map[string]bool)
+	for _, bridge := range bridges {
+		if remote != nil && !remote[bridge.Name] {
+			continue
+		} else if _, binaryName, ok := getGoBridgeBinary(bridge.Type); !ok {
+			continue
+		} else if bin, err := findBridgeBinary(ctx, bridge.Name, bridge.Type); err != nil {
+			return err
+		} else {
+			usedBinaries[bin.Path] = true
+			usedBinaryNames[binaryName] = true
+		}
+	}
+
+	var deletedBridges []string
+	for _, name := range names {
+		bridgeDir := filepath.Join(p.DataDir, name)
+		if remote != nil && !remote[name] {
+			deletedBridges = append(deletedBridges, name)
+			err = p.add("bridge doesn't exist on server", bridgeDir)
+		} else if err = p.findOldLogs(bridgeDir); err == nil {
+			err = p.findLeftoverBridgeFiles(bridgeDir)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to check %s: %w", name, err)
+		}
+	}
+	err = p.findUnusedBinaries(usedBinaries)
+	if err != nil {
+		return fmt.Errorf("failed to check binaries: %w", err)
+	}
+	err = p.findUnusedCompileDirs(usedBinaryNames)
+	if err != nil {
+		return fmt.Errorf("failed to check build directories: %w", err)
+	}
+
+	if len(p.Candidates) == 0 {
+		log.Printf("Nothing to prune in [magenta]%s[reset]", p.DataDir)
+		return nil
+	}
+	dryRun := ctx.Bool("dry-run")
+	if len(deletedBridges) > 0 && !dryRun && !ctx.Bool("yes") {
+		if !stdinIsTerminal() {
+			return UserError{fmt.Sprintf("Pass --yes to permanently delete the local data of %s without asking", strings.Join(deletedBridges, ", "))}
+		}
+		var confirmation bool
+		err = survey.AskOne(&survey.Confirm{Message: fmt.Sprintf("Are you sure you want to permanently delete the local data of %s?", strings.Join(deletedBridges, ", "))}, &confirmation)
+		if err != nil {
+			return err
+		} else if !confirmation {
+			return fmt.Errorf("prune cancelled")
+		}
+	}
+	var freed int64
+	for _, candidate := range p.Candidates {
+		if dryRun {
+			log.Printf("Would remove [magenta]%s[reset] (%s, %s)", candidate.Paths[0], candidate.Reason, formatSize(candidate.Size))
+			freed += candidate.Size
+			continue
+		}
+		var removeErr error
+		for _, path := range candidate.Paths {
+			removeErr = errors.Join(removeErr, os.RemoveAll(path))
+		}
+		if removeErr != nil {
+			log.Printf("Failed to remove [magenta]%s[reset]: [red]%v[reset]", candidate.Paths[0], removeErr)
+			continue
+		}
+		log.Printf("Removed [magenta]%s[reset] (%s, %s)", candidate.Paths[0], candidate.Reason, formatSize(candidate.Size))
+		freed += candidate.Size
+	}
+	if dryRun {
+		log.Printf("Pruning would free [green]%s[reset]", formatSize(freed))
+		return nil
+	}
+	if len(deletedBridges) > 0 {
+		for _, name := range deletedBridges {
+			deleteBridgeSettings(ctx, name)
+		}
+		err = GetConfig(ctx).Save()
+		if err != nil {
+			log.Printf("Failed to remove local bridge settings from config: [red]%v[reset]", err)
+		}
+	}
+	log.Printf("[green]Freed %s[reset]", formatSize(freed))
+	return nil
+}
@@ -0,0 +1,145 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/urfave/cli/v2"
+
+	"github.com/beeper/bridge-manager/bridgeconfig"
+	"github.com/beeper/bridge-manager/log"
+)
+
+var templatesCommand = &cli.Command{
+	Name:  "templates",
+	Usage: "Manage bridge config templates",
+	Subcommands: []*cli.Command{
+		{
+			Name:   "list",
+			Usage:  "List available config templates and where they were loaded from",
+			Action: listTemplates,
+		},
+		{
+			Name:      "show",
+			Usage:     "Print a config template",
+			ArgsUsage: "NAME",
+			Flags: []cli.Flag{
+				&cli.BoolFlag{
+					Name:  "embedded",
+					Usage: "Show the built-in template even if it's overridden by a user template.",
+				},
+			},
+			Action: showTemplate,
+		},
+		{
+			Name:      "export",
+			Usage:     "Copy built-in templates to the user template directory so they can be customized",
+			ArgsUsage: "NAME...",
+			Flags: []cli.Flag{
+				&cli.StringFlag{
+					Name:    "output",
+					Aliases: []string{"o"},
+					Usage:   "Directory to export the templates to. Defaults to the user template directory.",
+				},
+				&cli.BoolFlag{
+					Name:    "force",
+					Aliases: []string{"f"},
+					Usage:   "Overwrite existing files.",
+				},
+			},
+			Action: exportTemplates,
+		},
+	},
+}
+
+func describeTemplateSource(info *bridgeconfig.TemplateInfo) string {
+	switch {
+	case info.Origin == bridgeconfig.OriginEmbedded:
+		return "built-in"
+	case info.Overrides:
+		return "user (overrides built-in)"
+	default:
+		return "user"
+	}
+}
+
+func listTemplates(ctx *cli.Context) error {
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "NAME\tKIND\tSOURCE\tPATH")
+	for _, info := range bridgeconfig.ListTemplates() {
+		kind := "bridge"
+		if info.Partial {
+			kind = "partial"
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n", info.Name, kind, describeTemplateSource(info), info.Path)
+	}
+	err := tw.Flush()
+	if err != nil {
+		return err
+	}
+	log.Printf("User templates are loaded from [magenta]%s[reset]", bridgeconfig.UserTemplateDir)
+	return nil
+}
+
+func showTemplate(ctx *cli.Context) error {
+	if ctx.NArg() != 1 {
+		return UserError{"You must specify exactly one template to show"}
+	}
+	name := ctx.Args().Get(0)
+	if ctx.Bool("embedded") {
+		content, ok := bridgeconfig.GetEmbeddedTemplate(name)
+		if !ok {
+			return UserError{fmt.Sprintf("There's no built-in template called %s", name)}
+		}
+		fmt.Print(content)
+		return nil
+	}
+	info := bridgeconfig.GetTemplate(name)
+	if info == nil {
+		return UserError{fmt.Sprintf("There's no template called %s", name)}
+	}
+	log.Printf("Template [cyan]%s[reset] (%s)", info.FileName, describeTemplateSource(info))
+	fmt.Print(info.Content)
+	return nil
+}
+
+func exportTemplates(ctx *cli.Context) error {
+	if ctx.NArg() == 0 {
+		return UserError{"You must specify at least one template to export"}
+	}
+	dir := ctx.String("output")
+	if dir == "" {
+		dir = bridgeconfig.UserTemplateDir
+	}
+	err := os.MkdirAll(dir, 0700)
+	if err != nil {
+		return fmt.Errorf("failed to create template directory: %w", err)
+	}
+	for _, name := range ctx.Args().Slice() {
+		content, ok := bridgeconfig.GetEmbeddedTemplate(name)
+		if !ok {
+			return UserError{fmt.Sprintf("There's no built-in template called %s", name)}
+		}
+		fileName := name
+		if !strings.HasSuffix(fileName, ".yaml") {
+			fileName += ".tpl.yaml"
+		}
+		path := filepath.Join(dir, fileName)
+		if _, err = os.Stat(path); err == nil && !ctx.Bool("force") {
+			return UserError{fmt.Sprintf("%s already exists, use --force to overwrite it", path)}
+		} else if err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		err = os.WriteFile(path, []byte(content), 0600)
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", path, err)
+		}
+		log.Printf("Exported [cyan]%s[reset] to [magenta]%s[reset]", name, path)
+	}
+	return nil
+}
@@ -0,0 +1,237 @@
+package main
+
+import (
+	"cmp"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"text/tabwriter"
+	"time"
+
+	"github.com/fatih/color"
+	"github.com/urfave/cli/v2"
+
+	"github.com/beeper/bridge-manager/api/gitlab"
+	"github.com/beeper/bridge-manager/artifacts"
+	"github.com/beeper/bridge-manager/log"
+)
+
+var outdatedCommand = &cli.Command{
+	Name:   "outdated",
+	Usage:  "Check which locally installed bridges have newer builds available",
+	Action: listOutdatedBridges,
+}
+
+var updateCommand = &cli.Command{
+	Name:      "update",
+	Usage:     "Download new versions of bridges without starting them",
+	ArgsUsage: "[BRIDGE...]",
+	Flags: []cli.Flag{
+		&cli.BoolFlag{
+			Name:    "all",
+			Aliases: []string{"a"},
+			Usage:   "Update all bridges that have a directory in the bridge data directory.",
+		},
+		artifactSourceFlag,
+	},
+	Action: updateBridges,
+}
+
+// Directories in the bridge data directory that don't belong to bridges.
+var nonBridgeDataDirs = map[string]bool{
+	"binaries": true,
+	"compile":  true,
+}
+
+type localBridge struct {
+	Name string
+	Type string
+}
+
+func savedBridgeType(ctx *cli.Context, name string) string {
+	if settings, ok := GetEnvConfig(ctx).Bridges[name]; ok {
+		return settings.Type
+	}
+	return ""
+}
+
+// listLocalBridges returns all bridges that have a directory in the bridge data dir of the current env.
+// Bridges whose type is unknown (i.e. they haven't been started since the type started being saved,
+// and the type can't be guessed from the name) are skipped.
+func listLocalBridges(ctx *cli.Context) ([]localBridge, error) {
+	dataDir := GetEnvConfig(ctx).BridgeDataDir
+	entries, err := os.ReadDir(dataDir)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, fmt.Errorf("failed to read bridge data directory: %w", err)
+	}
+	var bridges []localBridge
+	for _, entry := range entries {
+		if !entry.IsDir() || nonBridgeDataDirs[entry.Name()] {
+			continue
+		}
+		bridgeType := savedBridgeType(ctx, entry.Name())
+		if bridgeType == "" {
+			bridgeType = guessBridgeType(entry.Name())
+		}
+		if bridgeType == "" {
+			log.Printf("Skipping [cyan]%s[reset]: unknown bridge type", entry.Name())
+			continue
+		}
+		bridges = append(bridges, localBridge{Name: entry.Name(), Type: bridgeType})
+	}
+	sort.Slice(bridges, func(i, j int) bool {
+		return bridges[i].Name < bridges[j].Name
+	})
+	return bridges, nil
+}
+
+func formatAge(since time.Time) string {
+	if since.IsZero() {
+		return "?"
+	}
+	age := time.Since(since)
+	switch {
+	case age < time.Hour:
+		return fmt.Sprintf("%dm", int(age.Minutes()))
+	case age < 48*time.Hour:
+		return fmt.Sprintf("%dh", int(age.Hours()))
+	default:
+		return fmt.Sprintf("%dd", int(age.Hours()/24))
+	}
+}
+
+func listOutdatedBridges(ctx *cli.Context) error {
+	bridges, err := listLocalBridges(ctx)
+	if err != nil {
+		return err
+	} else if len(bridges) == 0 {
+		log.Printf("No bridges found in [magenta]%s[reset]", GetEnvConfig(ctx).BridgeDataDir)
+		return nil
+	}
+	latestBuilds := make(map[string]*gitlab.LastBuild)
+	tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+	_, _ = fmt.Fprintln(tw, "BRIDGE\tTYPE\tINSTALLED\tLATEST\tAGE\tCHANNEL")
+	for _, bridge := range bridges {
+		bin, err := findBridgeBinary(ctx, bridge.Name, bridge.Type)
+		if err != nil {
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t-\t-\t-\t-\n", bridge.Name, bridge.Type)
+			continue
+		}
+		installed, installedTime := color.YellowString("not installed"), time.Time{}
+		var installedCommit string
+		if version, err := getBridgeVersion(bin.Path); err == nil {
+			installedCommit = version.Commit
+			installed = shortHash(installedCommit)
+			installedTime, _ = time.Parse(time.RFC3339, version.BuildTime)
+		}
+		if bin.Compiled != nil {
+			// Compiled bridges may come from a fork or have patches, so there's nothing in CI to compare them to
+			installed = shortHash(bin.Compiled.Commit)
+			_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t-\t%s\tcompiled (%s)\n", bridge.Name, bridge.Type, installed, formatAge(bin.Compiled.BuiltAt), describeCompileRecord(bin.Compiled))
+			continue
+		}
+		cacheKey := bin.CIBridgeType + "@" + bin.Channel.String()
+		latestBuild, ok := latestBuilds[cacheKey]
+		if !ok {
+			latestBuild, err = gitlab.GetLastBridgeBuild(bin.CIBridgeType, "", false, bin.Channel)
+			if errors.Is(err, gitlab.ErrNotBuiltInCI) {
+				log.Printf("[cyan]%s[reset] is not built in the CI for this platform", bin.CIBridgeType)
+			} else if err != nil {
+				log.Printf("Failed to get latest build of [cyan]%s[reset]: [red]%v[reset]", bin.CIBridgeType, err)
+			}
+			latestBuilds[cacheKey] = latestBuild
+		}
+		latest := "?"
+		if latestBuild != nil {
+			latest = shortHash(latestBuild.Commit)
+			if latestBuild.Commit == installedCommit {
+				installed = color.GreenString(installed)
+			} else if installedCommit != "" {
+				installed = color.YellowString(installed)
+			}
+		}
+		_, _ = fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\n", bridge.Name, bridge.Type, installed, latest, formatAge(installedTime), bin.Channel)
+	}
+	return tw.Flush()
+}
+
+func updatePythonBridge(ctx *cli.Context, bridgeName, bridgeType string) error {
+	bridgeDir := filepath.Join(GetEnvConfig(ctx).BridgeDataDir, bridgeName)
+	if _, err := os.Stat(bridgeDir); err != nil {
+		log.Printf("Not updating [cyan]%s[reset]: bridge directory doesn't exist", bridgeName)
+		return nil
+	}
+	opts := getPythonBridgeSettings(ctx, bridgeName)
+	opts.Upgrade = true
+	_, err := setupPythonVenv(ctx.Context, bridgeDir, bridgeType, false, opts)
+	if err != nil {
+		return fmt.Errorf("failed to update %s: %w", bridgeName, err)
+	}
+	return nil
+}
+
+func updateBridges(ctx *cli.Context) error {
+	var bridges []localBridge
+	if ctx.Bool("all") {
+		if ctx.NArg() > 0 {
+			return UserError{"Can't specify bridge names with --all"}
+		}
+		var err error
+		bridges, err = listLocalBridges(ctx)
+		if err != nil {
+			return err
+		}
+	} else if ctx.NArg() == 0 {
+		return UserError{"You must specify bridges to update or use --all"}
+	} else {
+		for _, name := range ctx.Args().Slice() {
+			bridges = append(bridges, localBridge{Name: name, Type: savedBridgeType(ctx, name)})
+		}
+	}
+	src, err := getArtifactSource(ctx)
+	if err != nil {
+		return err
+	}
+	updated := make(map[string]bool)
+	for _, bridge := range bridges {
+		if pythonType := cmp.Or(bridge.Type, guessBridgeType(bridge.Name)); isPythonBridge(pythonType) {
+			err = updatePythonBridge(ctx, bridge.Name, pythonType)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		bin, err := findBridgeBinary(ctx, bridge.Name, bridge.Type)
+		if err != nil {
+			log.Printf("Not updating [cyan]%s[reset]: %v", bridge.Name, err)
+			continue
+		} else if updated[bin.Path] {
+			continue
+		} else if bin.Compiled != nil {
+			log.Printf("Not updating [cyan]%s[reset]: it was compiled locally from %s, use [cyan]--compile[reset] to rebuild it", bridge.Name, describeCompileRecord(bin.Compiled))
+			continue
+		} else if isInCompileDir(GetEnvConfig(ctx).BridgeDataDir, bin.Path) {
+			// Downloading over the binary in a compile checkout would break later builds there
+			log.Printf("Not updating [cyan]%s[reset]: %s was compiled locally", bridge.Name, bin.Path)
+			continue
+		}
+		updated[bin.Path] = true
+		channel := bin.Channel
+		if src != nil && !channel.IsDefault() {
+			log.Printf("Channel [cyan]%s[reset] is only used for binaries downloaded from CI", channel)
+			continue
+		}
+		err = updateGoBridge(ctx.Context, bin.Path, bin.CIBridgeType, false, false, channel, src)
+		if errors.Is(err, gitlab.ErrNotBuiltInCI) || errors.Is(err, artifacts.ErrNotInSource) {
+			log.Printf("Not updating [cyan]%s[reset]: %v", bridge.Name, err)
+		} else if err != nil {
+			return fmt.Errorf("failed to update %s: %w", filepath.Base(bin.Path), err)
+		}
+	}
+	return nil
+}
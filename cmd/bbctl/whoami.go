@@ -28,8 +28,9 @@ var whoamiCommand = &cli.Command{
 			EnvVars: []string{"BEEPER_WHOAMI_RAW"},
 			Usage:   "Get raw JSON output instead of pretty-printed bridge status",
 		},
+		homeserverYesFlag,
 	},
-	Before: RequiresAuth,
+	Before: RequiresAuthOrStandalone,
 	Action: whoamiFunction,
 }
 
@@ -156,30 +157,62 @@ func getCachedWhoami(ctx *cli.Context) (*beeperapi.RespWhoami, error) {
 		return cachedWhoami, nil
 	}
 	ec := GetEnvConfig(ctx)
+	if ec.IsStandalone() {
+		return nil, UserError{"This command is only available when using Beeper"}
+	}
 	resp, err := beeperapi.Whoami(ctx.String("homeserver"), ec.AccessToken)
 	if err != nil {
 		return nil, err
 	}
+	cachedWhoami = resp
+	updateEnvFromWhoami(ctx, resp)
+	return resp, nil
+}
+
+// updateEnvFromWhoami saves changes to the username, cluster and hungryserv address of the env and
+// checks existing bridge configs if the hungryserv address or cluster changed.
+func updateEnvFromWhoami(ctx *cli.Context, resp *beeperapi.RespWhoami) {
+	ec := GetEnvConfig(ctx)
 	changed := false
 	if ec.Username != resp.UserInfo.Username {
 		ec.Username = resp.UserInfo.Username
 		changed = true
 	}
+	addressChanged := false
 	if ec.ClusterID != resp.UserInfo.BridgeClusterID {
+		if ec.ClusterID != "" {
+			log.Printf("Noticed cluster ID changed from [cyan]%s[reset] to [cyan]%s[reset]", ec.ClusterID, resp.UserInfo.BridgeClusterID)
+		}
 		ec.ClusterID = resp.UserInfo.BridgeClusterID
 		changed = true
+		addressChanged = true
+	}
+	hungryURL := getHungryAddress(ctx, resp)
+	oldHungryURL := ec.HungryURL
+	if ec.HungryURL != hungryURL {
+		if ec.HungryURL != "" {
+			log.Printf("Noticed hungryserv address changed from [cyan]%s[reset] to [cyan]%s[reset]", ec.HungryURL, hungryURL)
+		}
+		ec.HungryURL = hungryURL
+		changed = true
+		addressChanged = true
 	}
 	if changed {
-		err = GetConfig(ctx).Save()
+		err := GetConfig(ctx).Save()
 		if err != nil {
 			log.Printf("Failed to save config after updating: %v", err)
 		}
 	}
-	cachedWhoami = resp
-	return resp, nil
+	// The first address that's stored is only remembered, as there's nothing to compare the configs to
+	if addressChanged && oldHungryURL != "" {
+		checkBridgeHomeserverAddresses(ctx, oldHungryURL, hungryURL)
+	}
 }
 
 func whoamiFunction(ctx *cli.Context) error {
+	if GetEnvConfig(ctx).IsStandalone() {
+		return printStandaloneInfo(ctx)
+	}
 	whoami, err := getCachedWhoami(ctx)
 	if err != nil {
 		return fmt.Errorf("failed to get whoami: %w", err)
@@ -192,15 +225,6 @@ func whoamiFunction(ctx *cli.Context) error {
 		fmt.Println(string(data))
 		return nil
 	}
-	if oldID := GetEnvConfig(ctx).ClusterID; whoami.UserInfo.BridgeClusterID != oldID {
-		GetEnvConfig(ctx).ClusterID = whoami.UserInfo.BridgeClusterID
-		err = GetConfig(ctx).Save()
-		if err != nil {
-			fmt.Printf("Noticed cluster ID changed from %s to %s, but failed to save change: %v\n", oldID, whoami.UserInfo.BridgeClusterID, err)
-		} else {
-			fmt.Printf("Noticed cluster ID changed from %s to %s and saved to config\n", oldID, whoami.UserInfo.BridgeClusterID)
-		}
-	}
 	homeserver := ctx.String("homeserver")
 	fmt.Printf("User ID: @%s:%s\n", color.GreenString(whoami.UserInfo.Username), coloredHomeserver(homeserver))
 	if whoami.UserInfo.Admin {